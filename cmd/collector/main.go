@@ -2,7 +2,9 @@ package main
 
 import (
 	"context"
-	"log"
+	"errors"
+	"log/slog"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
@@ -10,59 +12,193 @@ import (
 
 	"github.com/klimeurt/secflow-collector/internal/collector"
 	"github.com/klimeurt/secflow-collector/internal/config"
+	"github.com/klimeurt/secflow-collector/internal/health"
+	"github.com/klimeurt/secflow-collector/internal/logging"
+	"github.com/klimeurt/secflow-collector/internal/metrics"
+	"github.com/klimeurt/secflow-collector/internal/tracing"
 	"github.com/robfig/cron/v3"
 )
 
 func main() {
+	// Run a one-shot scan instead of the service
+	if len(os.Args) > 1 && os.Args[1] == "scan" {
+		os.Exit(runScan(os.Args[2:]))
+	}
+
 	// Load configuration
 	cfg, err := config.Load()
 	if err != nil {
-		log.Fatalf("Failed to load configuration: %v", err)
+		fatal("Failed to load configuration", err)
+	}
+	logging.Setup(collector.ServiceName, cfg.LogLevel, cfg.LogFormat)
+
+	// The root context is cancelled on SIGINT or SIGTERM, which cancels the
+	// scheduled and startup scans
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// Set up tracing
+	shutdownTracing, err := tracing.Setup(context.Background(), collector.ServiceName, collector.ServiceVersion, cfg.OTLPEndpoint, cfg.TraceSampleRatio)
+	if err != nil {
+		fatal("Failed to set up tracing", err)
 	}
 
 	// Create scanner
 	scanner, err := collector.New(cfg)
 	if err != nil {
-		log.Fatalf("Failed to create scanner: %v", err)
+		fatal("Failed to create scanner", err)
 	}
-	defer scanner.Close()
+
+	runner := collector.NewRunner(scanner)
 
 	// Create cron scheduler
 	c := cron.New()
+	var scheduled []scheduledJob
 
 	// Add job
-	_, err = c.AddFunc(cfg.CronSchedule, func() {
-		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
-		defer cancel()
-
-		if err := scanner.ScanRepositories(ctx); err != nil {
-			log.Printf("Scan failed: %v", err)
+	id, err := c.AddFunc(cfg.CronSchedule, func() {
+		if _, err := runner.Run(ctx, collector.ScanOptions{Mode: collector.ScanFull}, collector.TriggerCron); err != nil {
+			slog.Warn("Scan not started", "mode", collector.ScanFull, "error", err)
 		}
 	})
 	if err != nil {
-		log.Fatalf("Failed to add cron job: %v", err)
+		fatal("Failed to add cron job", err)
+	}
+	scheduled = append(scheduled, scheduledJob{id: id, mode: collector.ScanFull, schedule: cfg.CronSchedule})
+
+	// Add incremental scan job if configured
+	if cfg.IncrementalCronSchedule != "" {
+		id, err = c.AddFunc(cfg.IncrementalCronSchedule, func() {
+			opts := collector.ScanOptions{Mode: collector.ScanIncremental}
+			if _, err := runner.Run(ctx, opts, collector.TriggerCron); err != nil {
+				slog.Warn("Scan not started", "mode", opts.Mode, "error", err)
+			}
+		})
+		if err != nil {
+			fatal("Failed to add incremental cron job", err)
+		}
+		scheduled = append(scheduled, scheduledJob{id: id, mode: collector.ScanIncremental, schedule: cfg.IncrementalCronSchedule})
+		slog.Info("Incremental scans scheduled", "schedule", cfg.IncrementalCronSchedule)
 	}
 
 	// Start cron scheduler
 	c.Start()
-	log.Printf("Cron scheduler started with schedule: %s", cfg.CronSchedule)
+	slog.Info("Cron scheduler started", "schedule", cfg.CronSchedule)
+
+	scheduledScans := func() []collector.ScheduledScan { return schedule(c, scheduled) }
+
+	// Register the NATS service if enabled
+	var svc *collector.Service
+	if cfg.NATSService {
+		svc, err = collector.AddService(runner, scheduledScans)
+		if err != nil {
+			fatal("Failed to register NATS service", err)
+		}
+		slog.Info("NATS service registered", "name", collector.ServiceName, "subject", collector.ServiceGroup+".*")
+	} else {
+		slog.Info("NATS service disabled, set NATS_SERVICE=true to enable it")
+	}
+
+	// Start the HTTP server for the metrics, the health probes and the admin
+	// API
+	mux := http.NewServeMux()
+	mux.Handle("GET "+metrics.Path, metrics.Handler(scanner.Collectors()...))
+	mux.Handle("GET "+health.LivenessPath, health.Handler(health.Check{Name: "scan", Check: runner.CheckStuck}))
+	mux.Handle("GET "+health.ReadinessPath, health.Handler(scanner.ReadinessChecks()...))
+	if cfg.AdminToken != "" {
+		mux.Handle("/", collector.NewAdminHandler(runner, cfg.AdminToken, scheduledScans))
+		slog.Info("Admin API enabled", "addr", cfg.HTTPAddr)
+	} else {
+		slog.Info("Admin API disabled, set ADMIN_TOKEN to enable it")
+	}
+	server := &http.Server{Addr: cfg.HTTPAddr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fatal("Failed to serve HTTP", err)
+		}
+	}()
+	slog.Info("Serving metrics", "addr", cfg.HTTPAddr, "path", metrics.Path)
 
 	// Run immediately on startup if configured
 	if cfg.RunOnStartup {
-		log.Println("Running initial scan on startup...")
-		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
-		defer cancel()
-
-		if err := scanner.ScanRepositories(ctx); err != nil {
-			log.Printf("Initial scan failed: %v", err)
+		slog.Info("Running initial scan on startup")
+		if _, err := runner.Run(ctx, collector.ScanOptions{Mode: collector.ScanFull}, collector.TriggerStartup); err != nil {
+			slog.Warn("Initial scan not started", "error", err)
 		}
 	}
 
 	// Wait for interrupt signal
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-	<-sigChan
+	<-ctx.Done()
+	stop()
+	slog.Info("Shutting down", "grace_period", cfg.ShutdownGracePeriod.String())
+
+	// Stop taking requests and scheduling scans, cancel the running scan and
+	// wait for it, then flush the messages still buffered. Work that does
+	// not finish within the grace period is abandoned.
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownGracePeriod)
+	defer cancel()
+	abandoned := false
+	if svc != nil {
+		if err := svc.Stop(); err != nil {
+			slog.Error("Failed to stop NATS service", "error", err)
+		}
+	}
+	cronDone := c.Stop()
+	if err := runner.Shutdown(shutdownCtx); err != nil {
+		slog.Error("Abandoned the running scan", "error", err)
+		abandoned = true
+	}
+	select {
+	case <-cronDone.Done():
+	case <-shutdownCtx.Done():
+		slog.Error("Abandoned the scheduled scans", "error", shutdownCtx.Err())
+		abandoned = true
+	}
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Error("Failed to shut down HTTP server", "error", err)
+	}
+	if err := scanner.Drain(shutdownCtx); err != nil {
+		slog.Error("Abandoned unflushed messages", "error", err)
+		abandoned = true
+	}
+
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelFlush()
+	if err := shutdownTracing(flushCtx); err != nil {
+		slog.Error("Failed to flush traces", "error", err)
+	}
+
+	if abandoned {
+		slog.Error("Shut down before in-flight work finished")
+		os.Exit(1)
+	}
+	slog.Info("Shut down gracefully")
+}
+
+// scheduledJob is a scan registered with the cron scheduler
+type scheduledJob struct {
+	id       cron.EntryID
+	mode     collector.ScanMode
+	schedule string
+}
+
+// schedule returns the next and previous runs of the scheduled scans
+func schedule(c *cron.Cron, jobs []scheduledJob) []collector.ScheduledScan {
+	scans := make([]collector.ScheduledScan, 0, len(jobs))
+	for _, job := range jobs {
+		entry := c.Entry(job.id)
+		scans = append(scans, collector.ScheduledScan{
+			Mode:     job.mode,
+			Schedule: job.schedule,
+			Next:     entry.Next,
+			Prev:     entry.Prev,
+		})
+	}
+	return scans
+}
 
-	log.Println("Shutting down...")
-	c.Stop()
+// fatal logs err and exits with a non-zero status
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
 }
\ No newline at end of file
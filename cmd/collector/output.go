@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/klimeurt/secflow-collector/internal/collector"
+	"github.com/klimeurt/secflow-collector/internal/config"
+)
+
+// Output formats of the scan subcommand
+const (
+	formatJSONL = "jsonl"
+	formatCSV   = "csv"
+	formatTable = "table"
+)
+
+// record is a repository published by a scan, or that JetStream discarded
+// as a duplicate of a message published by an earlier run
+type record struct {
+	Subject    string               `json:"subject"`
+	Repository collector.Repository `json:"repository"`
+	Duplicate  bool                 `json:"duplicate,omitempty"`
+}
+
+// repoWriter writes the repositories published by a scan
+type repoWriter interface {
+	// Write writes a repository record
+	Write(rec record) error
+	// Flush writes any buffered output
+	Flush() error
+}
+
+// validateFormat returns an error if format is not an output format
+func validateFormat(format string) error {
+	switch format {
+	case formatJSONL, formatCSV, formatTable:
+		return nil
+	default:
+		return fmt.Errorf("invalid format %q: must be %q, %q or %q", format, formatJSONL, formatCSV, formatTable)
+	}
+}
+
+// newRepoWriter returns a writer of the given format to w
+func newRepoWriter(w io.Writer, format string) (repoWriter, error) {
+	switch format {
+	case formatJSONL:
+		return &jsonlWriter{enc: json.NewEncoder(w)}, nil
+	case formatCSV:
+		return &csvWriter{w: csv.NewWriter(w)}, nil
+	case formatTable:
+		return &tableWriter{w: tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)}, nil
+	default:
+		return nil, validateFormat(format)
+	}
+}
+
+// jsonlWriter writes every record as a JSON object, one per line, with the
+// repository message as published
+type jsonlWriter struct {
+	enc *json.Encoder
+}
+
+func (j *jsonlWriter) Write(rec record) error {
+	return j.enc.Encode(rec)
+}
+
+func (j *jsonlWriter) Flush() error {
+	return nil
+}
+
+// csvHeader names the columns of the CSV output
+var csvHeader = []string{
+	"subject", "provider", "org", "full_name", "id", "visibility", "archived",
+	"fork", "default_branch", "language", "pushed_at", "clone_url", "duplicate",
+}
+
+// csvWriter writes a row per repository after a header row
+type csvWriter struct {
+	w      *csv.Writer
+	header bool
+}
+
+func (c *csvWriter) Write(rec record) error {
+	if !c.header {
+		c.header = true
+		if err := c.w.Write(csvHeader); err != nil {
+			return err
+		}
+	}
+	repo := rec.Repository
+	return c.w.Write([]string{
+		rec.Subject, provider(repo), repo.Org, repo.FullName, strconv.FormatInt(repo.ID, 10),
+		repo.Visibility, strconv.FormatBool(repo.Archived), strconv.FormatBool(repo.Fork),
+		repo.DefaultBranch, repo.Language, formatTime(repo.PushedAt), repo.CloneURL,
+		strconv.FormatBool(rec.Duplicate),
+	})
+}
+
+func (c *csvWriter) Flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// tableWriter writes aligned columns for reading in a terminal
+type tableWriter struct {
+	w      *tabwriter.Writer
+	header bool
+}
+
+func (t *tableWriter) Write(rec record) error {
+	if !t.header {
+		t.header = true
+		if _, err := fmt.Fprintln(t.w, "SUBJECT\tREPOSITORY\tVISIBILITY\tLANGUAGE\tPUSHED\tDUPLICATE"); err != nil {
+			return err
+		}
+	}
+	repo := rec.Repository
+	language := repo.Language
+	if language == "" {
+		language = "-"
+	}
+	duplicate := "no"
+	if rec.Duplicate {
+		duplicate = "yes"
+	}
+	_, err := fmt.Fprintf(t.w, "%s\t%s\t%s\t%s\t%s\t%s\n", rec.Subject, repo.FullName, repo.Visibility, language,
+		formatTime(repo.PushedAt), duplicate)
+	return err
+}
+
+func (t *tableWriter) Flush() error {
+	return t.w.Flush()
+}
+
+// provider returns the provider of repo, which is GitHub when empty
+func provider(repo collector.Repository) string {
+	if repo.Provider == "" {
+		return config.ProviderGitHub
+	}
+	return repo.Provider
+}
+
+// formatTime formats t as RFC 3339, or returns an empty string for the zero
+// time
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
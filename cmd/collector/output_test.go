@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/klimeurt/secflow-collector/internal/collector"
+)
+
+func testRepos() []collector.Repository {
+	return []collector.Repository{
+		{
+			ID:            1,
+			Name:          "api",
+			FullName:      "acme/api",
+			CloneURL:      "https://github.com/acme/api.git",
+			DefaultBranch: "main",
+			Visibility:    "private",
+			Language:      "Go",
+			PushedAt:      time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+			Org:           "acme",
+		},
+		{
+			ID:         2,
+			Name:       "docs",
+			FullName:   "platform/docs",
+			Visibility: "internal",
+			Org:        "platform",
+			Provider:   "gitlab",
+		},
+	}
+}
+
+func writeRepos(t *testing.T, format string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := newRepoWriter(&buf, format)
+	if err != nil {
+		t.Fatalf("newRepoWriter(%q) error = %v", format, err)
+	}
+	for i, repo := range testRepos() {
+		rec := record{Subject: "secflow.repos." + repo.Org, Repository: repo, Duplicate: i == 1}
+		if err := w.Write(rec); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	return buf.String()
+}
+
+func TestJSONLWriter(t *testing.T) {
+	lines := strings.Split(strings.TrimSuffix(writeRepos(t, formatJSONL), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2", len(lines))
+	}
+	for i, line := range lines {
+		var rec record
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("line %d is not JSON: %v", i, err)
+		}
+		want := testRepos()[i]
+		if rec.Repository.FullName != want.FullName {
+			t.Errorf("line %d full_name = %q, want %q", i, rec.Repository.FullName, want.FullName)
+		}
+		if rec.Subject != "secflow.repos."+want.Org {
+			t.Errorf("line %d subject = %q, want %q", i, rec.Subject, "secflow.repos."+want.Org)
+		}
+		if rec.Duplicate != (i == 1) {
+			t.Errorf("line %d duplicate = %v, want %v", i, rec.Duplicate, i == 1)
+		}
+	}
+	// Only duplicates are marked
+	if strings.Contains(lines[0], `"duplicate"`) {
+		t.Errorf("line 0 = %s, want no duplicate field", lines[0])
+	}
+}
+
+func TestCSVWriter(t *testing.T) {
+	records, err := csv.NewReader(strings.NewReader(writeRepos(t, formatCSV))).ReadAll()
+	if err != nil {
+		t.Fatalf("output is not CSV: %v", err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("got %d records, want header and 2 rows", len(records))
+	}
+	if strings.Join(records[0], ",") != strings.Join(csvHeader, ",") {
+		t.Errorf("header = %v, want %v", records[0], csvHeader)
+	}
+
+	want := []string{"secflow.repos.acme", "github", "acme", "acme/api", "1", "private", "false", "false", "main", "Go", "2024-05-01T12:00:00Z", "https://github.com/acme/api.git", "false"}
+	if strings.Join(records[1], ",") != strings.Join(want, ",") {
+		t.Errorf("row = %v, want %v", records[1], want)
+	}
+	if records[2][1] != "gitlab" || records[2][10] != "" || records[2][12] != "true" {
+		t.Errorf("provider, pushed_at, duplicate = %q, %q, %q, want gitlab, empty and true", records[2][1], records[2][10], records[2][12])
+	}
+}
+
+func TestTableWriter(t *testing.T) {
+	lines := strings.Split(strings.TrimSuffix(writeRepos(t, formatTable), "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("got %d lines, want header and 2 rows", len(lines))
+	}
+	if got := strings.Fields(lines[0]); strings.Join(got, " ") != "SUBJECT REPOSITORY VISIBILITY LANGUAGE PUSHED DUPLICATE" {
+		t.Errorf("header = %q", lines[0])
+	}
+	// Columns are aligned
+	if strings.Index(lines[1], "acme/api") != strings.Index(lines[2], "platform/docs") {
+		t.Errorf("columns not aligned:\n%s\n%s", lines[1], lines[2])
+	}
+	if got := strings.Fields(lines[2]); got[3] != "-" {
+		t.Errorf("empty language shown as %q, want -", got[3])
+	}
+	if got := strings.Fields(lines[1]); got[len(got)-1] != "no" {
+		t.Errorf("duplicate shown as %q, want no", got[len(got)-1])
+	}
+	if got := strings.Fields(lines[2]); got[len(got)-1] != "yes" {
+		t.Errorf("duplicate shown as %q, want yes", got[len(got)-1])
+	}
+}
+
+func TestNewRepoWriterInvalidFormat(t *testing.T) {
+	if _, err := newRepoWriter(&bytes.Buffer{}, "xml"); err == nil {
+		t.Error("newRepoWriter(xml) error = nil, want error")
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/klimeurt/secflow-collector/internal/collector"
+	"github.com/klimeurt/secflow-collector/internal/config"
+	"github.com/klimeurt/secflow-collector/internal/logging"
+)
+
+// Exit statuses of the scan subcommand
+const (
+	exitOK     = 0
+	exitFailed = 1
+	exitUsage  = 2
+)
+
+// runScan runs the scan subcommand: a single full scan outside the scheduler
+// that writes the repositories it publishes to stdout or a file. It neither
+// loads nor records scan state and publishes no lifecycle or scan events.
+// With -dry-run nothing is published and NATS is not used. It returns the
+// exit status.
+func runScan(args []string) int {
+	fs := flag.NewFlagSet("scan", flag.ContinueOnError)
+	format := fs.String("format", formatJSONL, "output format: jsonl, csv or table")
+	output := fs.String("output", "-", "file to write the repositories to, - for stdout")
+	dryRun := fs.Bool("dry-run", false, "list and filter repositories without publishing them")
+	orgs := fs.String("orgs", "", "comma-separated organizations to scan, by name or as provider/name (default all)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s scan [flags]\n\nScan the configured organizations once and write the repositories published.\n\nFlags:\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(fs.Output(), "unexpected argument %q\n", fs.Arg(0))
+		fs.Usage()
+		return exitUsage
+	}
+
+	if err := validateFormat(*format); err != nil {
+		fmt.Fprintln(fs.Output(), err)
+		fs.Usage()
+		return exitUsage
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		slog.Error("Failed to load configuration", "error", err)
+		return exitFailed
+	}
+	logging.Setup(collector.ServiceName, cfg.LogLevel, cfg.LogFormat)
+
+	// A one-shot scan is started by hand, so it does not wait for the
+	// replica holding the scan lock, and leaves the state of scheduled scans
+	// alone. Without state no lifecycle events are emitted.
+	cfg.ScanLock = false
+	cfg.StateBackend = ""
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	var scanner *collector.Scanner
+	if *dryRun {
+		scanner, err = collector.NewDryRun(cfg)
+	} else {
+		scanner, err = collector.New(cfg)
+	}
+	if err != nil {
+		slog.Error("Failed to create scanner", "error", err)
+		return exitFailed
+	}
+
+	// Open the output only once the scanner is ready, so a bad configuration
+	// leaves an earlier output alone, but before scanning so a bad path
+	// fails early
+	var out io.Writer = os.Stdout
+	var file *os.File
+	if *output != "-" {
+		f, err := os.Create(*output)
+		if err != nil {
+			fmt.Fprintf(fs.Output(), "failed to create output file: %v\n", err)
+			scanner.Close()
+			return exitUsage
+		}
+		file = f
+		out = f
+	}
+	w, err := newRepoWriter(out, *format)
+	if err != nil {
+		fmt.Fprintln(fs.Output(), err)
+		scanner.Close()
+		return exitUsage
+	}
+
+	var writeErr error
+	write := func(rec record) {
+		if writeErr == nil {
+			writeErr = w.Write(rec)
+		}
+	}
+	subjects := make(map[string]int)
+	opts := collector.ScanOptions{
+		Mode:           collector.ScanFull,
+		Orgs:           splitList(*orgs),
+		SkipScanEvents: true,
+		Published: func(subject string, repo collector.Repository) {
+			subjects[subject]++
+			write(record{Subject: subject, Repository: repo})
+		},
+		// Repositories JetStream already holds are written too, so the
+		// output lists every repository that passed the filters
+		Duplicate: func(subject string, repo collector.Repository) {
+			write(record{Subject: subject, Repository: repo, Duplicate: true})
+		},
+	}
+	result, scanErr := scanner.Scan(ctx, opts)
+
+	status := exitOK
+	if scanErr != nil {
+		slog.Error("Scan failed", "error", scanErr)
+		status = exitFailed
+	} else if result.Failed > 0 {
+		slog.Error("Scan finished with failures", "failed", result.Failed)
+		status = exitFailed
+	}
+
+	if err := w.Flush(); err != nil && writeErr == nil {
+		writeErr = err
+	}
+	if file != nil {
+		if err := file.Close(); err != nil && writeErr == nil {
+			writeErr = err
+		}
+	}
+	if writeErr != nil {
+		slog.Error("Failed to write output", "error", writeErr)
+		status = exitFailed
+	}
+
+	if *dryRun {
+		logDryRun(subjects)
+		scanner.Close()
+		return status
+	}
+
+	// Wait for the messages published to be sent before exiting
+	drainCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownGracePeriod)
+	defer cancel()
+	if err := scanner.Drain(drainCtx); err != nil {
+		slog.Error("Failed to drain NATS connection", "error", err)
+		status = exitFailed
+	}
+	return status
+}
+
+// logDryRun logs how many repositories a dry run would have published to
+// each subject
+func logDryRun(subjects map[string]int) {
+	names := make([]string, 0, len(subjects))
+	total := 0
+	for subject, n := range subjects {
+		names = append(names, subject)
+		total += n
+	}
+	sort.Strings(names)
+	for _, subject := range names {
+		slog.Info("Would publish repositories", "subject", subject, "count", subjects[subject])
+	}
+	slog.Info("Dry run finished, nothing published", "count", total)
+}
+
+// splitList splits a comma-separated list, dropping empty items
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
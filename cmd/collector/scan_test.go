@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunScanDryRun(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if !strings.HasSuffix(r.URL.Path, "/orgs/acme/repos") {
+			_, _ = w.Write([]byte(`{}`))
+			return
+		}
+		_, _ = w.Write([]byte(`[{"id":1,"name":"api","full_name":"acme/api"},{"id":2,"name":"docs","full_name":"acme/docs"}]`))
+	}))
+	defer server.Close()
+
+	t.Setenv("GITHUB_ORG", "acme")
+	t.Setenv("GITHUB_TOKEN", "token")
+	t.Setenv("GITHUB_API_URL", server.URL+"/")
+	t.Setenv("NATS_SUBJECT", "secflow.repos")
+
+	output := filepath.Join(t.TempDir(), "repos.jsonl")
+	if status := runScan([]string{"-dry-run", "-output", output}); status != exitOK {
+		t.Fatalf("runScan() = %d, want %d", status, exitOK)
+	}
+
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatalf("Failed to read output: %v", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2:\n%s", len(lines), data)
+	}
+	// Every line shows the subject the repository would be published on
+	for i, line := range lines {
+		var rec record
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("line %d is not JSON: %v", i, err)
+		}
+		if rec.Subject != "secflow.repos" || rec.Repository.ID != int64(i+1) || rec.Duplicate {
+			t.Errorf("line %d = %s, want repository %d on secflow.repos", i, line, i+1)
+		}
+	}
+}
+
+func TestRunScanInvalidConfig(t *testing.T) {
+	t.Setenv("GITHUB_ORG", "")
+	t.Setenv("GITHUB_ORGS", "")
+	t.Setenv("GITLAB_GROUPS", "")
+
+	output := filepath.Join(t.TempDir(), "repos.jsonl")
+	if err := os.WriteFile(output, []byte("previous\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write output: %v", err)
+	}
+	if status := runScan([]string{"-output", output}); status != exitFailed {
+		t.Errorf("runScan() = %d, want %d", status, exitFailed)
+	}
+
+	// The output of an earlier run is kept
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatalf("Failed to read output: %v", err)
+	}
+	if string(data) != "previous\n" {
+		t.Errorf("output = %q, want previous\\n", data)
+	}
+}
@@ -1,12 +1,21 @@
 package main
 
 import (
-	"log"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
+	"github.com/klimeurt/secflow-collector/internal/collector"
 	"github.com/klimeurt/secflow-collector/internal/config"
+	"github.com/klimeurt/secflow-collector/internal/health"
+	"github.com/klimeurt/secflow-collector/internal/logging"
+	"github.com/klimeurt/secflow-collector/internal/metrics"
+	"github.com/klimeurt/secflow-collector/internal/tracing"
 	"github.com/klimeurt/secflow-collector/internal/validator"
 )
 
@@ -14,26 +23,78 @@ func main() {
 	// Load configuration
 	cfg, err := config.Load()
 	if err != nil {
-		log.Fatalf("Failed to load configuration: %v", err)
+		fatal("Failed to load configuration", err)
+	}
+	logging.Setup("secflow-validator", cfg.LogLevel, cfg.LogFormat)
+
+	// The root context is cancelled on SIGINT or SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// Set up tracing
+	shutdownTracing, err := tracing.Setup(context.Background(), "secflow-validator", collector.ServiceVersion, cfg.OTLPEndpoint, cfg.TraceSampleRatio)
+	if err != nil {
+		fatal("Failed to set up tracing", err)
 	}
 
 	// Create validator service
 	v, err := validator.New(cfg)
 	if err != nil {
-		log.Fatalf("Failed to create validator: %v", err)
+		fatal("Failed to create validator", err)
 	}
 
 	// Start the validator service
 	if err := v.Start(); err != nil {
-		log.Fatalf("Failed to start validator: %v", err)
+		fatal("Failed to start validator", err)
 	}
-	defer v.Stop()
 
-	// Set up signal handling for graceful shutdown
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	// Serve the metrics and the health probes
+	mux := http.NewServeMux()
+	mux.Handle("GET "+metrics.Path, metrics.Handler(v.Collectors()...))
+	mux.Handle("GET "+health.LivenessPath, health.Handler())
+	mux.Handle("GET "+health.ReadinessPath, health.Handler(v.ReadinessChecks()...))
+	server := &http.Server{Addr: cfg.HTTPAddr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fatal("Failed to serve HTTP", err)
+		}
+	}()
+	slog.Info("Serving metrics", "addr", cfg.HTTPAddr, "path", metrics.Path)
 
 	// Wait for shutdown signal
-	<-sigChan
-	log.Println("Received shutdown signal, stopping validator...")
+	<-ctx.Done()
+	stop()
+	slog.Info("Received shutdown signal, stopping validator", "grace_period", cfg.ShutdownGracePeriod.String())
+
+	// Stop receiving messages and wait for those in flight, serving the
+	// probes and metrics meanwhile. Messages that are not processed within
+	// the grace period are abandoned.
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownGracePeriod)
+	defer cancel()
+	abandoned := false
+	if err := v.Stop(shutdownCtx); err != nil {
+		slog.Error("Abandoned in-flight messages", "error", err)
+		abandoned = true
+	}
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Error("Failed to shut down HTTP server", "error", err)
+	}
+
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelFlush()
+	if err := shutdownTracing(flushCtx); err != nil {
+		slog.Error("Failed to flush traces", "error", err)
+	}
+
+	if abandoned {
+		slog.Error("Shut down before in-flight work finished")
+		os.Exit(1)
+	}
+	slog.Info("Shut down gracefully")
+}
+
+// fatal logs err and exits with a non-zero status
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
 }
\ No newline at end of file
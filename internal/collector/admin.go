@@ -0,0 +1,170 @@
+package collector
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ScheduledScan describes a scan scheduled by cron
+type ScheduledScan struct {
+	Mode     ScanMode  `json:"mode"`
+	Schedule string    `json:"schedule"`
+	Next     time.Time `json:"next"`
+	// Prev is the zero time until the scan has run once
+	Prev time.Time `json:"prev,omitzero"`
+}
+
+// scanRequest is the body of a request to start a scan
+type scanRequest struct {
+	// Mode defaults to a full scan
+	Mode ScanMode `json:"mode"`
+	// Org limits the scan to one organization, by name or as provider/name
+	Org string `json:"org"`
+}
+
+// Errors of the admin API
+var (
+	errInvalidRequest = errors.New("invalid request")
+	errNoScanRunning  = errors.New("no scan is running")
+)
+
+// parseScanRequest parses the body of a request to start a scan. An empty
+// body starts a full scan of every organization.
+func parseScanRequest(data []byte) (ScanOptions, error) {
+	var req scanRequest
+	if len(bytes.TrimSpace(data)) > 0 {
+		if err := json.Unmarshal(data, &req); err != nil {
+			return ScanOptions{}, fmt.Errorf("%w: %v", errInvalidRequest, err)
+		}
+	}
+
+	opts := ScanOptions{Mode: req.Mode}
+	switch req.Mode {
+	case "":
+		opts.Mode = ScanFull
+	case ScanFull, ScanIncremental:
+	default:
+		return ScanOptions{}, fmt.Errorf("%w: unsupported scan mode %q", errInvalidRequest, req.Mode)
+	}
+	if req.Org != "" {
+		opts.Orgs = []string{req.Org}
+	}
+	return opts, nil
+}
+
+// errorStatus returns the HTTP status code for an error of the admin API
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, errInvalidRequest), errors.Is(err, ErrUnknownOrg):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrRepoNotFound), errors.Is(err, errNoScanRunning):
+		return http.StatusNotFound
+	case errors.Is(err, ErrScanRunning), errors.Is(err, ErrNotLeader):
+		return http.StatusConflict
+	case errors.Is(err, ErrRepoFiltered):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, ErrShuttingDown):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// scansResponse is the body of a scan status response
+type scansResponse struct {
+	Current *ScanStatus `json:"current"`
+	Last    *ScanStatus `json:"last"`
+}
+
+// errorResponse is the body of a failed request
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// NewAdminHandler returns the admin API of the collector. Every request must
+// carry token as a bearer token. schedule lists the scans scheduled by cron.
+//
+//	POST /scans          starts a scan, {"mode": "full", "org": "name"}
+//	POST /scans/cancel   cancels the running scan
+//	GET  /scans          returns the running and the last scan
+//	GET  /schedule       returns the scheduled scans
+func NewAdminHandler(runner *Runner, token string, schedule func() []ScheduledScan) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("POST /scans", func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1<<20))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("%w: %v", errInvalidRequest, err))
+			return
+		}
+		opts, err := parseScanRequest(body)
+		if err == nil {
+			var status ScanStatus
+			if status, err = runner.Start(opts, TriggerAPI); err == nil {
+				slog.Info("Scan requested through the admin API", "run_id", status.ID, "mode", status.Mode)
+				writeJSON(w, http.StatusAccepted, status)
+				return
+			}
+		}
+		writeError(w, errorStatus(err), err)
+	})
+
+	mux.HandleFunc("POST /scans/cancel", func(w http.ResponseWriter, r *http.Request) {
+		status, ok := runner.Cancel()
+		if !ok {
+			writeError(w, http.StatusNotFound, errNoScanRunning)
+			return
+		}
+		writeJSON(w, http.StatusAccepted, status)
+	})
+
+	mux.HandleFunc("GET /scans", func(w http.ResponseWriter, r *http.Request) {
+		current, last := runner.Status()
+		writeJSON(w, http.StatusOK, scansResponse{Current: current, Last: last})
+	})
+
+	mux.HandleFunc("GET /schedule", func(w http.ResponseWriter, r *http.Request) {
+		scans := schedule()
+		if scans == nil {
+			scans = []ScheduledScan{}
+		}
+		writeJSON(w, http.StatusOK, scans)
+	})
+
+	return requireToken(token, mux)
+}
+
+// requireToken rejects requests that do not carry token as a bearer token
+func requireToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, errors.New("unauthorized"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// writeJSON writes v as a JSON response
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Warn("Failed to write response", "error", err)
+	}
+}
+
+// writeError writes err as a JSON error response
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, errorResponse{Error: err.Error()})
+}
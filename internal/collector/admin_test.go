@@ -0,0 +1,75 @@
+package collector
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAdminHandler(t *testing.T) {
+	src := newBlockingSource()
+	runner := newTestRunner(t, src)
+	next := time.Date(2024, 1, 7, 0, 0, 0, 0, time.UTC)
+	handler := NewAdminHandler(runner, "secret", func() []ScheduledScan {
+		return []ScheduledScan{{Mode: ScanFull, Schedule: "0 0 * * 0", Next: next}}
+	})
+
+	do := func(method, path, body, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		token  string
+		want   int
+	}{
+		{"missing token", http.MethodGet, "/scans", "", "", http.StatusUnauthorized},
+		{"wrong token", http.MethodGet, "/scans", "", "wrong", http.StatusUnauthorized},
+		{"no scans", http.MethodGet, "/scans", "", "secret", http.StatusOK},
+		{"cancel without scan", http.MethodPost, "/scans/cancel", "", "secret", http.StatusNotFound},
+		{"unsupported mode", http.MethodPost, "/scans", `{"mode":"partial"}`, "secret", http.StatusBadRequest},
+		{"unknown org", http.MethodPost, "/scans", `{"org":"other"}`, "secret", http.StatusBadRequest},
+		{"invalid body", http.MethodPost, "/scans", `{`, "secret", http.StatusBadRequest},
+		{"start", http.MethodPost, "/scans", `{"mode":"full","org":"testorg"}`, "secret", http.StatusAccepted},
+		{"already running", http.MethodPost, "/scans", "", "secret", http.StatusConflict},
+		{"cancel", http.MethodPost, "/scans/cancel", "", "secret", http.StatusAccepted},
+		{"wrong method", http.MethodDelete, "/scans", "", "secret", http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		if rec := do(tt.method, tt.path, tt.body, tt.token); rec.Code != tt.want {
+			t.Errorf("%s: %s %s = %d %s, want %d", tt.name, tt.method, tt.path, rec.Code, rec.Body, tt.want)
+		}
+	}
+
+	last := waitForLast(t, runner)
+	var scans scansResponse
+	if err := json.Unmarshal(do(http.MethodGet, "/scans", "", "secret").Body.Bytes(), &scans); err != nil {
+		t.Fatalf("Failed to decode scans: %v", err)
+	}
+	if scans.Current != nil || scans.Last == nil || scans.Last.ID != last.ID || scans.Last.State != ScanStateCancelled {
+		t.Errorf("GET /scans = %+v, want the cancelled scan as last", scans)
+	}
+	if scans.Last.Trigger != TriggerAPI || len(scans.Last.Orgs) != 1 || scans.Last.Orgs[0] != "testorg" {
+		t.Errorf("GET /scans last = %+v, want an API scan of testorg", scans.Last)
+	}
+
+	var schedule []ScheduledScan
+	if err := json.Unmarshal(do(http.MethodGet, "/schedule", "", "secret").Body.Bytes(), &schedule); err != nil {
+		t.Fatalf("Failed to decode schedule: %v", err)
+	}
+	if len(schedule) != 1 || !schedule[0].Next.Equal(next) {
+		t.Errorf("GET /schedule = %+v, want the full scan at %v", schedule, next)
+	}
+}
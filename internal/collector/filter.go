@@ -0,0 +1,205 @@
+package collector
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/klimeurt/secflow-collector/internal/config"
+)
+
+// Names of the filter rules, used to report how many repositories each rule
+// dropped
+const (
+	FilterArchived   = "archived"
+	FilterFork       = "fork"
+	FilterTemplate   = "template"
+	FilterVisibility = "visibility"
+	FilterLanguage   = "language"
+	FilterTopic      = "topic"
+	FilterName       = "name"
+	FilterSize       = "size"
+	FilterPushedAge  = "pushed_age"
+)
+
+// Filter decides which repositories are published. Rules are evaluated in a
+// fixed order and a repository is dropped by the first rule it fails.
+type Filter struct {
+	rules []filterRule
+}
+
+// filterRule is a single named rule
+type filterRule struct {
+	name string
+	// keep reports whether a repository passes the rule
+	keep func(repo Repository, now time.Time) bool
+}
+
+// NewFilter builds a filter from the configured rules. A filter without rules
+// keeps every repository.
+func NewFilter(cfg config.FilterConfig) (*Filter, error) {
+	f := &Filter{}
+
+	if cfg.ExcludeArchived {
+		f.add(FilterArchived, func(repo Repository, _ time.Time) bool { return !repo.Archived })
+	}
+	if cfg.ExcludeForks {
+		f.add(FilterFork, func(repo Repository, _ time.Time) bool { return !repo.Fork })
+	}
+	if cfg.ExcludeTemplates {
+		f.add(FilterTemplate, func(repo Repository, _ time.Time) bool { return !repo.Template })
+	}
+
+	if len(cfg.Visibility) > 0 {
+		visibilities := lowerSet(cfg.Visibility)
+		f.add(FilterVisibility, func(repo Repository, _ time.Time) bool {
+			return visibilities[strings.ToLower(repo.Visibility)]
+		})
+	}
+
+	if len(cfg.Languages) > 0 || len(cfg.ExcludeLanguages) > 0 {
+		include, exclude := lowerSet(cfg.Languages), lowerSet(cfg.ExcludeLanguages)
+		f.add(FilterLanguage, func(repo Repository, _ time.Time) bool {
+			// GitLab does not report a primary language in project
+			// listings, so the rule does not apply to its projects
+			if repo.Provider == config.ProviderGitLab {
+				return true
+			}
+			language := strings.ToLower(repo.Language)
+			if len(include) > 0 && !include[language] {
+				return false
+			}
+			return !exclude[language]
+		})
+	}
+
+	if len(cfg.Topics) > 0 || len(cfg.ExcludeTopics) > 0 {
+		include, exclude := lowerSet(cfg.Topics), lowerSet(cfg.ExcludeTopics)
+		f.add(FilterTopic, func(repo Repository, _ time.Time) bool {
+			matched := false
+			for _, topic := range repo.Topics {
+				topic = strings.ToLower(topic)
+				if exclude[topic] {
+					return false
+				}
+				matched = matched || include[topic]
+			}
+			return len(include) == 0 || matched
+		})
+	}
+
+	if len(cfg.NameInclude) > 0 || len(cfg.NameExclude) > 0 || cfg.NameRegex != "" || cfg.NameExcludeRegex != "" {
+		rule, err := nameRule(cfg)
+		if err != nil {
+			return nil, err
+		}
+		f.add(FilterName, rule)
+	}
+
+	if cfg.MinSizeKB > 0 || cfg.MaxSizeKB > 0 {
+		f.add(FilterSize, func(repo Repository, _ time.Time) bool {
+			// Repositories of unknown size are kept rather than taken
+			// for empty ones
+			if repo.SizeUnknown {
+				return true
+			}
+			if repo.Size < cfg.MinSizeKB {
+				return false
+			}
+			return cfg.MaxSizeKB == 0 || repo.Size <= cfg.MaxSizeKB
+		})
+	}
+
+	if cfg.MaxPushedAge > 0 {
+		f.add(FilterPushedAge, func(repo Repository, now time.Time) bool {
+			// Repositories that were never pushed to are empty
+			return !repo.PushedAt.IsZero() && now.Sub(repo.PushedAt) <= cfg.MaxPushedAge
+		})
+	}
+
+	return f, nil
+}
+
+// nameRule builds the rule matching repository names against the glob
+// patterns and regular expressions. Names are matched case-insensitively,
+// like GitHub and GitLab treat them.
+func nameRule(cfg config.FilterConfig) (func(Repository, time.Time) bool, error) {
+	var include, exclude *regexp.Regexp
+	var err error
+	if cfg.NameRegex != "" {
+		if include, err = regexp.Compile("(?i)" + cfg.NameRegex); err != nil {
+			return nil, fmt.Errorf("invalid name filter regex %q: %w", cfg.NameRegex, err)
+		}
+	}
+	if cfg.NameExcludeRegex != "" {
+		if exclude, err = regexp.Compile("(?i)" + cfg.NameExcludeRegex); err != nil {
+			return nil, fmt.Errorf("invalid name filter regex %q: %w", cfg.NameExcludeRegex, err)
+		}
+	}
+
+	return func(repo Repository, _ time.Time) bool {
+		name := strings.ToLower(repo.Name)
+		if len(cfg.NameInclude) > 0 && !matchAny(cfg.NameInclude, name) {
+			return false
+		}
+		if matchAny(cfg.NameExclude, name) {
+			return false
+		}
+		if include != nil && !include.MatchString(repo.Name) {
+			return false
+		}
+		return exclude == nil || !exclude.MatchString(repo.Name)
+	}, nil
+}
+
+// add appends a rule to the filter
+func (f *Filter) add(name string, keep func(Repository, time.Time) bool) {
+	f.rules = append(f.rules, filterRule{name: name, keep: keep})
+}
+
+// Match returns the name of the first rule the repository fails, or an empty
+// string if the repository is kept
+func (f *Filter) Match(repo Repository, now time.Time) string {
+	if f == nil {
+		return ""
+	}
+	for _, rule := range f.rules {
+		if !rule.keep(repo, now) {
+			return rule.name
+		}
+	}
+	return ""
+}
+
+// Rules returns the names of the configured rules in evaluation order
+func (f *Filter) Rules() []string {
+	if f == nil {
+		return nil
+	}
+	names := make([]string, len(f.rules))
+	for i, rule := range f.rules {
+		names[i] = rule.name
+	}
+	return names
+}
+
+// matchAny reports whether name matches any of the glob patterns
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(strings.ToLower(pattern), name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// lowerSet returns the lower-cased values as a set
+func lowerSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[strings.ToLower(v)] = true
+	}
+	return set
+}
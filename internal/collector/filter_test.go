@@ -0,0 +1,230 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/klimeurt/secflow-collector/internal/config"
+	"github.com/nats-io/nats.go"
+)
+
+func TestFilterMatch(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	base := Repository{
+		Name:       "payments-api",
+		Visibility: "private",
+		Language:   "Go",
+		Topics:     []string{"service", "pci"},
+		Size:       2048,
+		PushedAt:   now.Add(-24 * time.Hour),
+	}
+
+	tests := []struct {
+		name   string
+		cfg    config.FilterConfig
+		modify func(*Repository)
+		want   string
+	}{
+		{name: "no rules", cfg: config.FilterConfig{}, want: ""},
+		{name: "archived", cfg: config.FilterConfig{ExcludeArchived: true}, modify: func(r *Repository) { r.Archived = true }, want: FilterArchived},
+		{name: "not archived", cfg: config.FilterConfig{ExcludeArchived: true}, want: ""},
+		{name: "fork", cfg: config.FilterConfig{ExcludeForks: true}, modify: func(r *Repository) { r.Fork = true }, want: FilterFork},
+		{name: "template", cfg: config.FilterConfig{ExcludeTemplates: true}, modify: func(r *Repository) { r.Template = true }, want: FilterTemplate},
+		{name: "visibility kept", cfg: config.FilterConfig{Visibility: []string{"Private", "internal"}}, want: ""},
+		{name: "visibility dropped", cfg: config.FilterConfig{Visibility: []string{"public"}}, want: FilterVisibility},
+		{name: "language kept", cfg: config.FilterConfig{Languages: []string{"go", "java"}}, want: ""},
+		{name: "language not included", cfg: config.FilterConfig{Languages: []string{"java"}}, want: FilterLanguage},
+		{name: "language excluded", cfg: config.FilterConfig{ExcludeLanguages: []string{"GO"}}, want: FilterLanguage},
+		{
+			name:   "language not reported by GitLab",
+			cfg:    config.FilterConfig{Languages: []string{"java"}},
+			modify: func(r *Repository) { r.Language, r.Provider = "", config.ProviderGitLab },
+			want:   "",
+		},
+		{name: "topic kept", cfg: config.FilterConfig{Topics: []string{"pci"}}, want: ""},
+		{name: "topic not included", cfg: config.FilterConfig{Topics: []string{"library"}}, want: FilterTopic},
+		{name: "topic excluded", cfg: config.FilterConfig{ExcludeTopics: []string{"service"}}, want: FilterTopic},
+		{name: "name glob kept", cfg: config.FilterConfig{NameInclude: []string{"payments-*"}}, want: ""},
+		{name: "name glob not included", cfg: config.FilterConfig{NameInclude: []string{"billing-*"}}, want: FilterName},
+		{name: "name glob excluded", cfg: config.FilterConfig{NameExclude: []string{"*-API"}}, want: FilterName},
+		{name: "name regex kept", cfg: config.FilterConfig{NameRegex: "^payments-"}, want: ""},
+		{name: "name regex not matched", cfg: config.FilterConfig{NameRegex: "^billing-"}, want: FilterName},
+		{name: "name exclude regex", cfg: config.FilterConfig{NameExcludeRegex: "-api$"}, want: FilterName},
+		{name: "empty repository", cfg: config.FilterConfig{MinSizeKB: 1}, modify: func(r *Repository) { r.Size = 0 }, want: FilterSize},
+		{
+			name:   "size not reported by GitLab",
+			cfg:    config.FilterConfig{MinSizeKB: 1},
+			modify: func(r *Repository) { r.Size, r.SizeUnknown, r.Provider = 0, true, config.ProviderGitLab },
+			want:   "",
+		},
+		{name: "too large", cfg: config.FilterConfig{MaxSizeKB: 1024}, want: FilterSize},
+		{name: "size kept", cfg: config.FilterConfig{MinSizeKB: 1, MaxSizeKB: 4096}, want: ""},
+		{name: "pushed recently", cfg: config.FilterConfig{MaxPushedAge: 48 * time.Hour}, want: ""},
+		{name: "pushed too long ago", cfg: config.FilterConfig{MaxPushedAge: time.Hour}, want: FilterPushedAge},
+		{name: "never pushed", cfg: config.FilterConfig{MaxPushedAge: time.Hour}, modify: func(r *Repository) { r.PushedAt = time.Time{} }, want: FilterPushedAge},
+		{
+			name:   "first failing rule wins",
+			cfg:    config.FilterConfig{ExcludeArchived: true, ExcludeForks: true},
+			modify: func(r *Repository) { r.Archived, r.Fork = true, true },
+			want:   FilterArchived,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := NewFilter(tt.cfg)
+			if err != nil {
+				t.Fatalf("NewFilter() unexpected error: %v", err)
+			}
+
+			repo := base
+			if tt.modify != nil {
+				tt.modify(&repo)
+			}
+			if got := f.Match(repo, now); got != tt.want {
+				t.Errorf("Match() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScanFilters(t *testing.T) {
+	archived := createMockRepoJSON(2, "old-service")
+	archived["archived"] = true
+	fork := createMockRepoJSON(3, "forked-lib")
+	fork["fork"] = true
+	otherFork := createMockRepoJSON(4, "forked-tool")
+	otherFork["fork"] = true
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode([]map[string]interface{}{createMockRepoJSON(1, "service"), archived, fork, otherFork})
+	}))
+	defer server.Close()
+
+	natsServer := runMockNATSServer()
+	defer natsServer.Shutdown()
+
+	config := &config.Config{
+		GitHubOrg:   "testorg",
+		GitHubToken: "token123",
+		NATSUrl:     natsServer.ClientURL(),
+		NATSSubject: "github.repositories",
+		Filters:     config.FilterConfig{ExcludeArchived: true, ExcludeForks: true},
+	}
+
+	scanner, err := New(config)
+	if err != nil {
+		t.Fatalf("Failed to create scanner: %v", err)
+	}
+	defer scanner.Close()
+
+	scanner.ghClient.BaseURL = mustParseURL(server.URL + "/")
+
+	messages := make(chan *nats.Msg, 10)
+	sub, err := scanner.nc.ChanSubscribe(config.NATSSubject, messages)
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+	defer func() { _ = sub.Unsubscribe() }()
+
+	result, err := scanner.Scan(context.Background(), ScanOptions{Mode: ScanFull})
+	if err != nil {
+		t.Fatalf("Scan() unexpected error: %v", err)
+	}
+	if result.Published != 1 || result.Filtered != 3 {
+		t.Errorf("Published = %d, Filtered = %d, want 1 and 3", result.Published, result.Filtered)
+	}
+	if result.FilteredBy[FilterArchived] != 1 || result.FilteredBy[FilterFork] != 2 {
+		t.Errorf("FilteredBy = %v, want archived=1 fork=2", result.FilteredBy)
+	}
+
+	select {
+	case msg := <-messages:
+		var repo Repository
+		if err := json.Unmarshal(msg.Data, &repo); err != nil {
+			t.Fatalf("Failed to unmarshal message: %v", err)
+		}
+		if repo.Name != "service" {
+			t.Errorf("Published %s, want service", repo.Name)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timeout waiting for message")
+	}
+
+	select {
+	case msg := <-messages:
+		t.Errorf("Unexpected message: %s", msg.Data)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestScanIncrementalRelaxedFilter(t *testing.T) {
+	fork := createMockRepoJSON(2, "forked-lib")
+	fork["fork"] = true
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode([]map[string]interface{}{createMockRepoJSON(1, "service"), fork})
+	}))
+	defer server.Close()
+
+	natsServer := runMockNATSServer()
+	defer natsServer.Shutdown()
+
+	cfg := &config.Config{
+		GitHubOrg:    "testorg",
+		GitHubToken:  "token123",
+		NATSUrl:      natsServer.ClientURL(),
+		NATSSubject:  "github.repositories",
+		StateBackend: "file",
+		StateFile:    t.TempDir() + "/state.json",
+		Filters:      config.FilterConfig{ExcludeForks: true},
+	}
+
+	scanner, err := New(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create scanner: %v", err)
+	}
+	defer scanner.Close()
+
+	scanner.ghClient.BaseURL = mustParseURL(server.URL + "/")
+
+	ctx := context.Background()
+	incremental := ScanOptions{Mode: ScanIncremental}
+
+	result, err := scanner.Scan(ctx, incremental)
+	if err != nil {
+		t.Fatalf("Scan() unexpected error: %v", err)
+	}
+	if result.Published != 1 || result.Filtered != 1 {
+		t.Errorf("First scan published %d and filtered %d repos, want 1 and 1", result.Published, result.Filtered)
+	}
+
+	// Once the filter no longer drops it, the unchanged fork is published
+	if scanner.filter, err = NewFilter(config.FilterConfig{}); err != nil {
+		t.Fatalf("NewFilter() unexpected error: %v", err)
+	}
+	var published []string
+	incremental.Published = func(_ string, repo Repository) { published = append(published, repo.Name) }
+	result, err = scanner.Scan(ctx, incremental)
+	if err != nil {
+		t.Fatalf("Scan() unexpected error: %v", err)
+	}
+	if result.Published != 1 || result.Skipped != 1 || len(published) != 1 || published[0] != "forked-lib" {
+		t.Errorf("Relaxed scan published %v and skipped %d repos, want [forked-lib] and 1", published, result.Skipped)
+	}
+
+	// and is then skipped like any unchanged repository
+	result, err = scanner.Scan(ctx, ScanOptions{Mode: ScanIncremental})
+	if err != nil {
+		t.Fatalf("Scan() unexpected error: %v", err)
+	}
+	if result.Published != 0 || result.Skipped != 2 {
+		t.Errorf("Unchanged scan published %d and skipped %d repos, want 0 and 2", result.Published, result.Skipped)
+	}
+}
@@ -0,0 +1,140 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-github/v57/github"
+	"github.com/klimeurt/secflow-collector/internal/config"
+	"github.com/klimeurt/secflow-collector/internal/ghclient"
+)
+
+// GitHubSource lists the repositories of GitHub organizations
+type GitHubSource struct {
+	clients *ghclient.Factory
+}
+
+// NewGitHubSource creates a source using the clients of factory
+func NewGitHubSource(clients *ghclient.Factory) *GitHubSource {
+	return &GitHubSource{clients: clients}
+}
+
+// ListPage returns one page of the repositories of the organization, oldest
+// first
+func (g *GitHubSource) ListPage(ctx context.Context, org string, page int) (*Page, error) {
+	client, err := g.clients.ForOrg(ctx, org)
+	if err != nil {
+		return nil, err
+	}
+
+	opt := &github.RepositoryListByOrgOptions{
+		Sort:        "created",
+		Direction:   "asc",
+		ListOptions: github.ListOptions{Page: page, PerPage: 100},
+	}
+	repos, resp, err := client.Repositories.ListByOrg(ctx, org, opt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list repositories: %w", err)
+	}
+
+	p := &Page{Number: page, Next: resp.NextPage, Last: resp.LastPage}
+	for _, repo := range repos {
+		p.Repos = append(p.Repos, newRepository(org, repo))
+	}
+	return p, nil
+}
+
+// LookupTransfer looks up a repository by ID to tell a deletion from a
+// transfer to another owner
+func (g *GitHubSource) LookupTransfer(ctx context.Context, org string, id int64) (string, error) {
+	client, err := g.clients.ForOrg(ctx, org)
+	if err != nil {
+		return "", err
+	}
+
+	repo, resp, err := client.Repositories.GetByID(ctx, id)
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return "", fmt.Errorf("%w: %s repository ID %d", ErrRepoNotFound, org, id)
+		}
+		return "", err
+	}
+	// GitHub logins are case-insensitive, and GITHUB_ORGS may not match the
+	// case GitHub returns
+	if !strings.EqualFold(repo.GetOwner().GetLogin(), org) {
+		return repo.GetFullName(), nil
+	}
+	return "", nil
+}
+
+// GetRepository returns a repository of the organization by name
+func (g *GitHubSource) GetRepository(ctx context.Context, org, name string) (*Repository, error) {
+	client, err := g.clients.ForOrg(ctx, org)
+	if err != nil {
+		return nil, err
+	}
+
+	repo, resp, err := client.Repositories.Get(ctx, org, name)
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return nil, fmt.Errorf("%w: %s/%s", ErrRepoNotFound, org, name)
+		}
+		return nil, fmt.Errorf("failed to get repository: %w", err)
+	}
+	r := newRepository(org, repo)
+	return &r, nil
+}
+
+// newRepository converts a GitHub repository listed in org to our
+// Repository struct
+func newRepository(org string, repo *github.Repository) Repository {
+	return Repository{
+		ID:            repo.GetID(),
+		Name:          repo.GetName(),
+		FullName:      repo.GetFullName(),
+		Owner:         repo.GetOwner().GetLogin(),
+		CloneURL:      repo.GetCloneURL(),
+		SSHURL:        repo.GetSSHURL(),
+		HTTPSURL:      httpsURL(repo.GetHTMLURL(), repo.GetCloneURL()),
+		HTMLURL:       repo.GetHTMLURL(),
+		DefaultBranch: repo.GetDefaultBranch(),
+		Visibility:    visibility(repo),
+		Private:       repo.GetPrivate(),
+		Archived:      repo.GetArchived(),
+		Fork:          repo.GetFork(),
+		Template:      repo.GetIsTemplate(),
+		Size:          repo.GetSize(),
+		CreatedAt:     repo.GetCreatedAt().Time,
+		UpdatedAt:     repo.GetUpdatedAt().Time,
+		PushedAt:      repo.GetPushedAt().Time,
+		Language:      repo.GetLanguage(),
+		Topics:        repo.Topics,
+		License:       repo.GetLicense().GetSPDXID(),
+		Org:           org,
+		Provider:      config.ProviderGitHub,
+	}
+}
+
+// httpsURL returns the HTTPS URL of a repository: its web URL, or the clone
+// URL without the .git suffix when the web URL is missing
+func httpsURL(htmlURL, cloneURL string) string {
+	if htmlURL != "" {
+		return htmlURL
+	}
+	return strings.TrimSuffix(cloneURL, ".git")
+}
+
+// visibility returns the visibility of a GitHub repository. The field is
+// missing from older GitHub Enterprise Server responses, in which case it is
+// derived from the private flag.
+func visibility(repo *github.Repository) string {
+	if v := repo.GetVisibility(); v != "" {
+		return v
+	}
+	if repo.GetPrivate() {
+		return "private"
+	}
+	return "public"
+}
@@ -0,0 +1,122 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/klimeurt/secflow-collector/internal/config"
+	"github.com/klimeurt/secflow-collector/internal/gitlab"
+)
+
+// GitLabSource lists the projects of GitLab groups and their subgroups
+type GitLabSource struct {
+	client *gitlab.Client
+	// groupClients holds the clients of groups with a token override
+	groupClients map[string]*gitlab.Client
+}
+
+// NewGitLabSource creates a source for the GitLab instance at GitLabURL
+func NewGitLabSource(cfg *config.Config) (*GitLabSource, error) {
+	client, err := gitlab.NewClient(cfg.GitLabURL, cfg.GitLabToken, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &GitLabSource{client: client, groupClients: make(map[string]*gitlab.Client)}
+	for _, group := range cfg.GitLabGroups {
+		if group.Token == "" {
+			continue
+		}
+		if g.groupClients[group.Name], err = gitlab.NewClient(cfg.GitLabURL, group.Token, nil); err != nil {
+			return nil, err
+		}
+	}
+	return g, nil
+}
+
+// clientFor returns the client for a group, which uses the group's token
+// override if it has one
+func (g *GitLabSource) clientFor(group string) *gitlab.Client {
+	if client, ok := g.groupClients[group]; ok {
+		return client
+	}
+	return g.client
+}
+
+// ListPage returns one page of the projects of the group and its subgroups,
+// oldest first
+func (g *GitLabSource) ListPage(ctx context.Context, group string, page int) (*Page, error) {
+	projects, pagination, err := g.clientFor(group).ListGroupProjects(ctx, group, page)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list projects: %w", err)
+	}
+
+	p := &Page{Number: page, Next: pagination.Next, Last: pagination.TotalPages}
+	for _, project := range projects {
+		p.Repos = append(p.Repos, newGitLabRepository(group, project))
+	}
+	return p, nil
+}
+
+// LookupTransfer looks up a project by ID to tell a deletion from a transfer
+// out of the group
+func (g *GitLabSource) LookupTransfer(ctx context.Context, group string, id int64) (string, error) {
+	project, err := g.clientFor(group).GetProject(ctx, strconv.FormatInt(id, 10))
+	if gitlab.IsNotFound(err) {
+		return "", fmt.Errorf("%w: %s project ID %d", ErrRepoNotFound, group, id)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	namespace := project.Namespace.FullPath
+	if namespace != group && !strings.HasPrefix(namespace, group+"/") {
+		return project.PathWithNamespace, nil
+	}
+	return "", nil
+}
+
+// GetRepository returns a project of the group or its subgroups by its path
+// relative to the group
+func (g *GitLabSource) GetRepository(ctx context.Context, group, name string) (*Repository, error) {
+	project, err := g.clientFor(group).GetProject(ctx, group+"/"+name)
+	if gitlab.IsNotFound(err) {
+		return nil, fmt.Errorf("%w: %s/%s", ErrRepoNotFound, group, name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get project: %w", err)
+	}
+	r := newGitLabRepository(group, project)
+	return &r, nil
+}
+
+// newGitLabRepository converts a GitLab project listed in group to our
+// Repository struct. GitLab has no separate push time, so the last activity
+// is used for both PushedAt and UpdatedAt.
+func newGitLabRepository(group string, project *gitlab.Project) Repository {
+	return Repository{
+		ID:            project.ID,
+		Name:          project.Path,
+		FullName:      project.PathWithNamespace,
+		Owner:         project.Namespace.FullPath,
+		CloneURL:      project.HTTPURLToRepo,
+		SSHURL:        project.SSHURLToRepo,
+		HTTPSURL:      httpsURL(project.WebURL, project.HTTPURLToRepo),
+		HTMLURL:       project.WebURL,
+		DefaultBranch: project.DefaultBranch,
+		Visibility:    project.Visibility,
+		Private:       project.Visibility != "public",
+		Archived:      project.Archived,
+		Fork:          project.ForkedFromProject != nil,
+		Size:          project.Statistics.RepositorySizeKB(),
+		SizeUnknown:   project.Statistics == nil,
+		CreatedAt:     project.CreatedAt,
+		UpdatedAt:     project.LastActivityAt,
+		PushedAt:      project.LastActivityAt,
+		Topics:        project.Topics,
+		Org:           group,
+		Provider:      config.ProviderGitLab,
+	}
+}
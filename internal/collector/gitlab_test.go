@@ -0,0 +1,165 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/klimeurt/secflow-collector/internal/config"
+	"github.com/nats-io/nats.go"
+)
+
+func TestScanGitLabGroup(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.EscapedPath() {
+		case "/api/v4/groups/platform/projects":
+			if r.URL.Query().Get("page") == "1" {
+				w.Header().Set("X-Next-Page", "2")
+				_ = json.NewEncoder(w).Encode([]map[string]interface{}{createMockProjectJSON(1, "platform", "api")})
+				return
+			}
+			_ = json.NewEncoder(w).Encode([]map[string]interface{}{createMockProjectJSON(2, "platform/backend", "worker")})
+		case "/api/v4/projects/3":
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"id":                  3,
+				"path_with_namespace": "other/moved",
+				"namespace":           map[string]string{"full_path": "other"},
+			})
+		case "/api/v4/projects/platform%2Fbackend%2Fworker":
+			_ = json.NewEncoder(w).Encode(createMockProjectJSON(2, "platform/backend", "worker"))
+		case "/api/v4/projects/4":
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"id":                  4,
+				"path_with_namespace": "platform/backend/still-here",
+				"namespace":           map[string]string{"full_path": "platform/backend"},
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_ = json.NewEncoder(w).Encode(map[string]string{"message": "404 Not Found"})
+		}
+	}))
+	defer server.Close()
+
+	natsServer := runMockNATSServer()
+	defer natsServer.Shutdown()
+
+	config := &config.Config{
+		GitLabURL:    server.URL,
+		GitLabGroups: []config.OrgConfig{{Name: "platform", Provider: config.ProviderGitLab, Subject: "gitlab.repositories"}},
+		NATSUrl:      natsServer.ClientURL(),
+		NATSSubject:  "github.repositories",
+	}
+
+	scanner, err := New(config)
+	if err != nil {
+		t.Fatalf("Failed to create scanner: %v", err)
+	}
+	defer scanner.Close()
+
+	messages := make(chan *nats.Msg, 10)
+	sub, err := scanner.nc.ChanSubscribe("gitlab.repositories", messages)
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+	defer func() { _ = sub.Unsubscribe() }()
+
+	result, err := scanner.Scan(context.Background(), ScanOptions{Mode: ScanFull})
+	if err != nil {
+		t.Fatalf("Scan() unexpected error: %v", err)
+	}
+	if result.Published != 2 {
+		t.Errorf("Published = %d, want 2", result.Published)
+	}
+
+	received := make(map[string]Repository)
+	timeout := time.After(5 * time.Second)
+	for len(received) < 2 {
+		select {
+		case msg := <-messages:
+			var repo Repository
+			if err := json.Unmarshal(msg.Data, &repo); err != nil {
+				t.Fatalf("Failed to unmarshal message: %v", err)
+			}
+			received[repo.Name] = repo
+		case <-timeout:
+			t.Fatalf("Timeout waiting for messages, got %v", received)
+		}
+	}
+
+	worker := received["worker"]
+	if worker.Provider != "gitlab" || worker.Org != "platform" || worker.ID != 2 {
+		t.Errorf("worker = %+v, want provider gitlab, org platform and ID 2", worker)
+	}
+	if worker.CloneURL != "https://gitlab.example.com/platform/backend/worker.git" {
+		t.Errorf("CloneURL = %v, want %v", worker.CloneURL, "https://gitlab.example.com/platform/backend/worker.git")
+	}
+	if worker.FullName != "platform/backend/worker" || worker.Owner != "platform/backend" {
+		t.Errorf("FullName = %v, Owner = %v, want platform/backend/worker and platform/backend", worker.FullName, worker.Owner)
+	}
+	if worker.HTTPSURL != "https://gitlab.example.com/platform/backend/worker" || worker.DefaultBranch != "main" || !worker.Private {
+		t.Errorf("worker = %+v, want web URL, default branch main and private", worker)
+	}
+	if !worker.SizeUnknown {
+		t.Error("worker.SizeUnknown = false, want true without statistics")
+	}
+
+	src := scanner.sources["gitlab"]
+	tests := []struct {
+		id      int64
+		want    string
+		wantErr error
+	}{
+		{id: 3, want: "other/moved"},
+		{id: 4, want: ""},
+		{id: 5, wantErr: ErrRepoNotFound},
+	}
+	for _, tt := range tests {
+		got, err := src.LookupTransfer(context.Background(), "platform", tt.id)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("LookupTransfer(%d) error = %v, want %v", tt.id, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Errorf("LookupTransfer(%d) = %q, want %q", tt.id, got, tt.want)
+		}
+	}
+
+	repo, err := src.GetRepository(context.Background(), "platform", "backend/worker")
+	if err != nil || repo.ID != 2 || repo.Org != "platform" {
+		t.Errorf("GetRepository() = %+v, %v, want worker in platform", repo, err)
+	}
+	if _, err := src.GetRepository(context.Background(), "platform", "missing"); !errors.Is(err, ErrRepoNotFound) {
+		t.Errorf("GetRepository() error = %v, want ErrRepoNotFound", err)
+	}
+}
+
+func TestStateKey(t *testing.T) {
+	if got := stateKey(config.OrgConfig{Name: "platform", Provider: config.ProviderGitHub}); got != "platform" {
+		t.Errorf("stateKey() = %q, want %q", got, "platform")
+	}
+	if got := stateKey(config.OrgConfig{Name: "platform", Provider: config.ProviderGitLab}); got != "gitlab/platform" {
+		t.Errorf("stateKey() = %q, want %q", got, "gitlab/platform")
+	}
+}
+
+func createMockProjectJSON(id int64, namespace, path string) map[string]interface{} {
+	return map[string]interface{}{
+		"id":                  id,
+		"name":                path,
+		"path":                path,
+		"path_with_namespace": namespace + "/" + path,
+		"http_url_to_repo":    "https://gitlab.example.com/" + namespace + "/" + path + ".git",
+		"ssh_url_to_repo":     "git@gitlab.example.com:" + namespace + "/" + path + ".git",
+		"web_url":             "https://gitlab.example.com/" + namespace + "/" + path,
+		"default_branch":      "main",
+		"visibility":          "internal",
+		"created_at":          "2023-01-01T00:00:00.000Z",
+		"last_activity_at":    "2023-12-01T00:00:00.000Z",
+		"topics":              []string{"test"},
+		"namespace":           map[string]string{"full_path": namespace},
+	}
+}
@@ -0,0 +1,54 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/klimeurt/secflow-collector/internal/config"
+	"github.com/klimeurt/secflow-collector/internal/health"
+)
+
+// stuckScanGrace is how long a scan may outlive its deadline while it winds
+// down before it is considered stuck
+const stuckScanGrace = time.Minute
+
+// ReadinessChecks returns the checks of the readiness probe: the NATS
+// connection and, when GitHub organizations are scanned, the reachability of
+// the GitHub API with the configured credentials
+func (s *Scanner) ReadinessChecks() []health.Check {
+	checks := []health.Check{health.NATS(s.nc)}
+
+	var orgs []string
+	for _, org := range s.config.Organizations() {
+		if org.Provider == config.ProviderGitHub {
+			orgs = append(orgs, org.Name)
+		}
+	}
+	if len(orgs) > 0 {
+		checks = append(checks, health.Check{
+			Name:  "github",
+			Check: func(ctx context.Context) error { return s.clients.Ping(ctx, orgs) },
+			TTL:   health.RemoteCheckTTL,
+		})
+	}
+	return checks
+}
+
+// CheckStuck returns an error when the running scan has outlived its
+// deadline by more than stuckScanGrace. Such a scan no longer responds to
+// the cancellation of its context, and blocks every later scan.
+func (r *Runner) CheckStuck(context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.current == nil {
+		return nil
+	}
+	st := r.current.status
+	if elapsed := time.Since(st.StartedAt); elapsed > r.timeout+stuckScanGrace {
+		return fmt.Errorf("scan %s has run for %s, past its deadline of %s",
+			st.ID, elapsed.Round(time.Second), r.timeout)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package collector
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunnerCheckStuck(t *testing.T) {
+	src := newBlockingSource()
+	runner := newTestRunner(t, src)
+	ctx := context.Background()
+
+	if err := runner.CheckStuck(ctx); err != nil {
+		t.Errorf("CheckStuck() without a scan unexpected error: %v", err)
+	}
+
+	if _, err := runner.Start(ScanOptions{}, TriggerAPI); err != nil {
+		t.Fatalf("Start() unexpected error: %v", err)
+	}
+	<-src.started
+	if err := runner.CheckStuck(ctx); err != nil {
+		t.Errorf("CheckStuck() within the deadline unexpected error: %v", err)
+	}
+
+	// A scan that outlived its deadline and the grace period is stuck
+	runner.mu.Lock()
+	runner.current.status.StartedAt = time.Now().Add(-runner.timeout - stuckScanGrace - time.Second)
+	runner.mu.Unlock()
+	if err := runner.CheckStuck(ctx); err == nil || !strings.Contains(err.Error(), "past its deadline") {
+		t.Errorf("CheckStuck() error = %v, want a stuck scan", err)
+	}
+
+	close(src.release)
+	waitForLast(t, runner)
+	if err := runner.CheckStuck(ctx); err != nil {
+		t.Errorf("CheckStuck() after the scan unexpected error: %v", err)
+	}
+}
+
+func TestReadinessChecks(t *testing.T) {
+	src := newBlockingSource()
+	runner := newTestRunner(t, src)
+
+	checks := runner.scanner.ReadinessChecks()
+	var names []string
+	for _, c := range checks {
+		names = append(names, c.Name)
+	}
+	if strings.Join(names, ",") != "nats,github" {
+		t.Fatalf("ReadinessChecks() = %v, want nats and github", names)
+	}
+
+	if err := checks[0].Check(context.Background()); err != nil {
+		t.Errorf("NATS check unexpected error: %v", err)
+	}
+	runner.scanner.nc.Close()
+	if err := checks[0].Check(context.Background()); err == nil {
+		t.Error("NATS check expected error after closing the connection, got nil")
+	}
+}
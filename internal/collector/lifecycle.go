@@ -0,0 +1,147 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+)
+
+// LifecycleEventType is the kind of change detected for a repository
+type LifecycleEventType string
+
+const (
+	// EventCreated is emitted for a repository that was not in the previous
+	// inventory
+	EventCreated LifecycleEventType = "created"
+	// EventUpdated is emitted for a repository that was pushed to or updated
+	EventUpdated LifecycleEventType = "updated"
+	// EventArchived is emitted for a repository that was archived
+	EventArchived LifecycleEventType = "archived"
+	// EventRenamed is emitted for a repository whose name changed
+	EventRenamed LifecycleEventType = "renamed"
+	// EventDeleted is emitted for a repository that is no longer listed in
+	// the organization, because it was deleted or transferred out
+	EventDeleted LifecycleEventType = "deleted"
+)
+
+// Reasons given for EventDeleted
+const (
+	ReasonDeleted     = "deleted"
+	ReasonTransferred = "transferred"
+)
+
+// LifecycleEvent describes a change to a repository between two scans
+type LifecycleEvent struct {
+	Type         LifecycleEventType `json:"type"`
+	Org          string             `json:"org"`
+	RepoID       int64              `json:"repo_id"`
+	Name         string             `json:"name"`
+	PreviousName string             `json:"previous_name,omitempty"`
+	Reason       string             `json:"reason,omitempty"`
+	NewFullName  string             `json:"new_full_name,omitempty"`
+	DetectedAt   time.Time          `json:"detected_at"`
+	Repository   *Repository        `json:"repository,omitempty"`
+}
+
+// LifecycleSubject returns the subject lifecycle events of the given type are
+// published on, derived from the repository subject
+func LifecycleSubject(subject string, eventType LifecycleEventType) string {
+	return subject + ".events." + string(eventType)
+}
+
+// diffInventory compares the previous inventory with the repositories listed
+// by the current scan and returns the lifecycle events between them, ordered
+// by repository ID
+func diffInventory(org string, prev, current map[int64]RepoState, detectedAt time.Time) []LifecycleEvent {
+	var events []LifecycleEvent
+
+	for id, cur := range current {
+		old, ok := prev[id]
+		events = append(events, diffRepo(org, id, old, ok, cur, detectedAt)...)
+	}
+	events = append(events, deletedRepos(org, prev, current, detectedAt)...)
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].RepoID < events[j].RepoID
+	})
+	return events
+}
+
+// diffRepo returns the lifecycle events of a listed repository against its
+// previous inventory entry old, which is only valid if known is true
+func diffRepo(org string, id int64, old RepoState, known bool, cur RepoState, detectedAt time.Time) []LifecycleEvent {
+	if !known {
+		return []LifecycleEvent{{Type: EventCreated, Org: org, RepoID: id, Name: cur.Name, DetectedAt: detectedAt}}
+	}
+
+	var events []LifecycleEvent
+	if old.Name != cur.Name {
+		events = append(events, LifecycleEvent{Type: EventRenamed, Org: org, RepoID: id, Name: cur.Name, PreviousName: old.Name, DetectedAt: detectedAt})
+	}
+	if cur.Archived && !old.Archived {
+		events = append(events, LifecycleEvent{Type: EventArchived, Org: org, RepoID: id, Name: cur.Name, DetectedAt: detectedAt})
+	}
+	if len(events) == 0 && (cur.PushedAt.After(old.PushedAt) || cur.UpdatedAt.After(old.UpdatedAt)) {
+		events = append(events, LifecycleEvent{Type: EventUpdated, Org: org, RepoID: id, Name: cur.Name, DetectedAt: detectedAt})
+	}
+	return events
+}
+
+// deletedRepos returns an EventDeleted for every repository of the previous
+// inventory that is no longer listed
+func deletedRepos(org string, prev, current map[int64]RepoState, detectedAt time.Time) []LifecycleEvent {
+	var events []LifecycleEvent
+	for id, old := range prev {
+		if _, ok := current[id]; !ok {
+			events = append(events, LifecycleEvent{Type: EventDeleted, Org: org, RepoID: id, Name: old.Name, DetectedAt: detectedAt})
+		}
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].RepoID < events[j].RepoID
+	})
+	return events
+}
+
+// deletionReason looks up a repository that disappeared from the
+// organization to tell a deletion from a transfer to another owner. It
+// returns false if the organization still owns the repository, which was
+// then missed because a deletion or creation shifted the pages while they
+// were fetched.
+func (s *Scanner) deletionReason(ctx context.Context, src Source, org string, id int64) (string, string, bool) {
+	fullName, err := src.LookupTransfer(ctx, org, id)
+	switch {
+	case errors.Is(err, ErrRepoNotFound):
+		return ReasonDeleted, "", true
+	case err != nil:
+		slog.Warn("Failed to look up removed repository", "org", org, "repo_id", id, "error", err)
+		return ReasonDeleted, "", true
+	case fullName != "":
+		return ReasonTransferred, fullName, true
+	}
+	return "", "", false
+}
+
+// publishLifecycleEvent publishes a lifecycle event on the subject derived
+// from the repository subject and the event type. version is the
+// stateVersion of the repository state the event was detected from, so the
+// same change detected again inside the duplicate window is de-duplicated.
+func (s *Scanner) publishLifecycleEvent(ctx context.Context, subject, provider string, event LifecycleEvent, version, runID string) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal lifecycle event: %w", err)
+	}
+
+	msgID := messageKey(provider, event.RepoID) + "-" + string(event.Type) + "-" + version
+	subject = LifecycleSubject(subject, event.Type)
+	if _, err := s.publish(ctx, subject, data, msgID, runID); err != nil {
+		return err
+	}
+
+	slog.Debug("Published lifecycle event", "event", event.Type, "org", event.Org, "repo", event.Name,
+		"run_id", runID, "subject", subject)
+	return nil
+}
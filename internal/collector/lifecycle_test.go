@@ -0,0 +1,195 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/klimeurt/secflow-collector/internal/config"
+	"github.com/nats-io/nats.go"
+)
+
+func TestDiffInventory(t *testing.T) {
+	t0 := time.Date(2023, 12, 1, 0, 0, 0, 0, time.UTC)
+	t1 := t0.Add(time.Hour)
+	detectedAt := t1.Add(time.Hour)
+
+	prev := map[int64]RepoState{
+		1: {Name: "unchanged", PushedAt: t0, UpdatedAt: t0},
+		2: {Name: "pushed", PushedAt: t0, UpdatedAt: t0},
+		3: {Name: "old-name", PushedAt: t0, UpdatedAt: t0},
+		4: {Name: "to-archive", PushedAt: t0, UpdatedAt: t0},
+		5: {Name: "gone", PushedAt: t0, UpdatedAt: t0},
+	}
+	current := map[int64]RepoState{
+		1: {Name: "unchanged", PushedAt: t0, UpdatedAt: t0},
+		2: {Name: "pushed", PushedAt: t1, UpdatedAt: t1},
+		3: {Name: "new-name", PushedAt: t0, UpdatedAt: t1},
+		4: {Name: "to-archive", PushedAt: t0, UpdatedAt: t1, Archived: true},
+		6: {Name: "brand-new", PushedAt: t1, UpdatedAt: t1},
+	}
+
+	events := diffInventory("testorg", prev, current, detectedAt)
+
+	want := []struct {
+		id           int64
+		eventType    LifecycleEventType
+		name         string
+		previousName string
+	}{
+		{2, EventUpdated, "pushed", ""},
+		{3, EventRenamed, "new-name", "old-name"},
+		{4, EventArchived, "to-archive", ""},
+		{5, EventDeleted, "gone", ""},
+		{6, EventCreated, "brand-new", ""},
+	}
+
+	if len(events) != len(want) {
+		t.Fatalf("diffInventory() returned %d events, want %d: %+v", len(events), len(want), events)
+	}
+	for i, w := range want {
+		e := events[i]
+		if e.RepoID != w.id || e.Type != w.eventType || e.Name != w.name || e.PreviousName != w.previousName {
+			t.Errorf("events[%d] = %+v, want %+v", i, e, w)
+		}
+		if e.Org != "testorg" {
+			t.Errorf("events[%d].Org = %q, want %q", i, e.Org, "testorg")
+		}
+		if !e.DetectedAt.Equal(detectedAt) {
+			t.Errorf("events[%d].DetectedAt = %v, want %v", i, e.DetectedAt, detectedAt)
+		}
+	}
+}
+
+func TestLifecycleSubject(t *testing.T) {
+	if got := LifecycleSubject("github.repositories", EventDeleted); got != "github.repositories.events.deleted" {
+		t.Errorf("LifecycleSubject() = %q, want %q", got, "github.repositories.events.deleted")
+	}
+}
+
+func TestScanLifecycleEvents(t *testing.T) {
+	repos := []map[string]interface{}{
+		createMockRepoJSON(1, "repo1"),
+		createMockRepoJSON(2, "repo2"),
+		createMockRepoJSON(3, "repo3"),
+		createMockRepoJSON(4, "repo4"),
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.URL.Path == "/repositories/2":
+			w.WriteHeader(http.StatusNotFound)
+			_ = json.NewEncoder(w).Encode(map[string]string{"message": "Not Found"})
+		case r.URL.Path == "/repositories/3":
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"id":        3,
+				"name":      "repo3",
+				"full_name": "otherorg/repo3",
+				"owner":     map[string]string{"login": "otherorg"},
+			})
+		case r.URL.Path == "/repositories/4":
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"id":        4,
+				"name":      "repo4",
+				"full_name": "TestOrg/repo4",
+				"owner":     map[string]string{"login": "TestOrg"},
+			})
+		case strings.HasSuffix(r.URL.Path, "/repos"):
+			_ = json.NewEncoder(w).Encode(repos)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	natsServer := runMockNATSServer()
+	defer natsServer.Shutdown()
+
+	config := &config.Config{
+		GitHubOrg:    "testorg",
+		GitHubToken:  "token123",
+		NATSUrl:      natsServer.ClientURL(),
+		NATSSubject:  "github.repositories",
+		StateBackend: "file",
+		StateFile:    t.TempDir() + "/state.json",
+	}
+
+	scanner, err := New(config)
+	if err != nil {
+		t.Fatalf("Failed to create scanner: %v", err)
+	}
+	defer scanner.Close()
+
+	scanner.ghClient.BaseURL = mustParseURL(server.URL + "/")
+
+	events := make(chan *nats.Msg, 10)
+	sub, err := scanner.nc.ChanSubscribe(config.NATSSubject+".events.>", events)
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+	defer func() { _ = sub.Unsubscribe() }()
+
+	// The first scan records the inventory without emitting events
+	ctx := context.Background()
+	if err := scanner.ScanRepositories(ctx); err != nil {
+		t.Fatalf("Failed to scan repositories: %v", err)
+	}
+
+	// repo1 is renamed, repo2 deleted and repo3 transferred to another org.
+	// repo4 is still in the org, whose login differs in case from the
+	// configured name, but was missed as if the pages shifted.
+	repos[0]["name"] = "repo1-renamed"
+	repos = repos[:1]
+
+	if err := scanner.ScanRepositories(ctx); err != nil {
+		t.Fatalf("Failed to scan repositories: %v", err)
+	}
+
+	received := make(map[int64]LifecycleEvent)
+	subjects := make(map[int64]string)
+	timeout := time.After(5 * time.Second)
+	for len(received) < 3 {
+		select {
+		case msg := <-events:
+			var event LifecycleEvent
+			if err := json.Unmarshal(msg.Data, &event); err != nil {
+				t.Fatalf("Failed to unmarshal event: %v", err)
+			}
+			received[event.RepoID] = event
+			subjects[event.RepoID] = msg.Subject
+		case <-timeout:
+			t.Fatalf("Timeout waiting for events, got %d: %+v", len(received), received)
+		}
+	}
+
+	if e := received[1]; e.Type != EventRenamed || e.PreviousName != "repo1" || e.Repository == nil || e.Repository.Name != "repo1-renamed" {
+		t.Errorf("repo1 event = %+v, want renamed from repo1 with repository payload", e)
+	}
+	if subjects[1] != "github.repositories.events.renamed" {
+		t.Errorf("repo1 event subject = %q, want %q", subjects[1], "github.repositories.events.renamed")
+	}
+	if e := received[2]; e.Type != EventDeleted || e.Reason != ReasonDeleted {
+		t.Errorf("repo2 event = %+v, want deleted", e)
+	}
+	if e := received[3]; e.Type != EventDeleted || e.Reason != ReasonTransferred || e.NewFullName != "otherorg/repo3" {
+		t.Errorf("repo3 event = %+v, want transferred to otherorg/repo3", e)
+	}
+
+	// No event is emitted for repo4, which stays in the inventory
+	select {
+	case msg := <-events:
+		t.Errorf("Unexpected event: %s", msg.Data)
+	case <-time.After(200 * time.Millisecond):
+	}
+	st, err := scanner.state.Load(ctx, config.GitHubOrg)
+	if err != nil {
+		t.Fatalf("Failed to load state: %v", err)
+	}
+	if _, ok := st.Repos[4]; !ok {
+		t.Error("repo4 missing from the inventory, want the previous entry kept")
+	}
+}
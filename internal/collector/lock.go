@@ -0,0 +1,192 @@
+package collector
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// leaderKey is the key of the leader lock in its bucket
+const leaderKey = "leader"
+
+// ErrNotLeader is returned when a scan is started on a replica that does not
+// hold the leader lock
+var ErrNotLeader = errors.New("another replica holds the scan lock")
+
+// LeaderLock elects one of several collector replicas to run scans. The
+// leader holds a key in a JetStream key-value bucket whose entries expire
+// after the TTL and renews it every third of the TTL. The other replicas try
+// to create the key just as often, so one of them takes over within the TTL
+// when the leader dies.
+type LeaderLock struct {
+	kv     jetstream.KeyValue
+	holder string
+	ttl    time.Duration
+	stop   context.CancelFunc
+	done   chan struct{}
+
+	mu sync.Mutex
+	// revision is the revision of the key while leading, and zero otherwise
+	revision uint64
+	// leading is cancelled when the leadership is lost
+	leading context.Context
+	lose    context.CancelFunc
+	// changed is closed and replaced whenever the lock is acquired or lost
+	changed chan struct{}
+}
+
+// NewLeaderLock creates the bucket if needed and returns a lock held as
+// holder. Campaigning starts with Start.
+func NewLeaderLock(ctx context.Context, js jetstream.JetStream, bucket, holder string, ttl time.Duration) (*LeaderLock, error) {
+	kv, err := js.CreateOrUpdateKeyValue(ctx, jetstream.KeyValueConfig{
+		Bucket:      bucket,
+		Description: "secflow-collector scan lock",
+		TTL:         ttl,
+		Storage:     jetstream.FileStorage,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create key-value bucket %s: %w", bucket, err)
+	}
+	return &LeaderLock{kv: kv, holder: holder, ttl: ttl, changed: make(chan struct{})}, nil
+}
+
+// Start campaigns for the lock until Close. The first campaign runs before
+// Start returns, bounded by a third of the TTL, so a replica that can take
+// the lock holds it before its first scan is due; later campaigns run in the
+// background.
+func (l *LeaderLock) Start() {
+	ctx, stop := context.WithCancel(context.Background())
+	l.stop = stop
+	l.done = make(chan struct{})
+
+	l.campaign(ctx)
+	go func() {
+		defer close(l.done)
+
+		ticker := time.NewTicker(l.ttl / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				l.campaign(ctx)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// campaign renews the lock while leading, and tries to acquire it otherwise
+func (l *LeaderLock) campaign(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, l.ttl/3)
+	defer cancel()
+
+	l.mu.Lock()
+	revision := l.revision
+	l.mu.Unlock()
+
+	if revision != 0 {
+		next, err := l.kv.Update(ctx, leaderKey, []byte(l.holder), revision)
+		if err != nil {
+			slog.Warn("Lost the scan lock", "error", err)
+			l.setRevision(0)
+			return
+		}
+		l.setRevision(next)
+		return
+	}
+
+	revision, err := l.kv.Create(ctx, leaderKey, []byte(l.holder))
+	if errors.Is(err, jetstream.ErrKeyExists) {
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to acquire the scan lock", "error", err)
+		return
+	}
+	slog.Info("Acquired the scan lock", "holder", l.holder)
+	l.setRevision(revision)
+}
+
+// setRevision records the revision of the key, or zero when the lock was lost
+func (l *LeaderLock) setRevision(revision uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	switch {
+	case revision != 0 && l.revision == 0:
+		l.leading, l.lose = context.WithCancel(context.Background())
+	case revision == 0 && l.revision != 0:
+		l.lose()
+	default:
+		l.revision = revision
+		return
+	}
+	l.revision = revision
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// Changed returns a channel that is closed the next time this replica
+// acquires or loses the lock
+func (l *LeaderLock) Changed() <-chan struct{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.changed
+}
+
+// Leading returns a context that is cancelled when the leadership is lost,
+// or false if this replica does not hold the lock
+func (l *LeaderLock) Leading() (context.Context, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.revision == 0 {
+		return nil, false
+	}
+	return l.leading, true
+}
+
+// Close stops campaigning and releases the lock if held, so another replica
+// takes over without waiting for the TTL
+func (l *LeaderLock) Close() {
+	if l.stop != nil {
+		l.stop()
+		<-l.done
+	}
+
+	l.mu.Lock()
+	revision := l.revision
+	l.mu.Unlock()
+	if revision == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := l.kv.Delete(ctx, leaderKey, jetstream.LastRevision(revision)); err != nil {
+		slog.Error("Failed to release the scan lock", "error", err)
+	} else {
+		slog.Info("Released the scan lock", "holder", l.holder)
+	}
+	l.setRevision(0)
+}
+
+// lockHolder returns an identifier for this replica, unique across restarts
+func lockHolder() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "collector"
+	}
+	b := make([]byte, 4)
+	_, _ = rand.Read(b)
+	return host + "-" + hex.EncodeToString(b)
+}
@@ -0,0 +1,179 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// newTestLocks creates n leader locks sharing a bucket with the given TTL
+func newTestLocks(t *testing.T, n int, ttl time.Duration) []*LeaderLock {
+	t.Helper()
+
+	server := runMockJetStreamServer(t)
+	t.Cleanup(server.Shutdown)
+
+	nc, err := nats.Connect(server.ClientURL())
+	if err != nil {
+		t.Fatalf("Failed to connect to NATS: %v", err)
+	}
+	t.Cleanup(nc.Close)
+
+	js, err := jetstream.New(nc)
+	if err != nil {
+		t.Fatalf("Failed to create JetStream context: %v", err)
+	}
+
+	var locks []*LeaderLock
+	for i := 0; i < n; i++ {
+		lock, err := NewLeaderLock(context.Background(), js, "secflow_collector_lock", lockHolder(), ttl)
+		if err != nil {
+			t.Fatalf("NewLeaderLock() unexpected error: %v", err)
+		}
+		locks = append(locks, lock)
+	}
+	return locks
+}
+
+// waitForLeader waits until lock holds the leadership
+func waitForLeader(t *testing.T, lock *LeaderLock, timeout time.Duration) context.Context {
+	t.Helper()
+
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if leading, ok := lock.Leading(); ok {
+			return leading
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Timeout waiting for %s to acquire the lock", lock.holder)
+	return nil
+}
+
+func TestLeaderLock(t *testing.T) {
+	locks := newTestLocks(t, 2, time.Second)
+	first, second := locks[0], locks[1]
+
+	// The first campaign completes before Start returns
+	first.Start()
+	leading, ok := first.Leading()
+	if !ok {
+		t.Fatal("first replica does not lead after Start()")
+	}
+
+	// Only one replica leads while the leader renews the lock
+	second.Start()
+	defer second.Close()
+	time.Sleep(1500 * time.Millisecond)
+	if _, ok := second.Leading(); ok {
+		t.Fatal("second replica acquired a held lock")
+	}
+	if _, ok := first.Leading(); !ok {
+		t.Fatal("first replica lost the lock while renewing it")
+	}
+
+	// Releasing the lock hands it over
+	first.Close()
+	if leading.Err() == nil {
+		t.Error("leading context not cancelled after releasing the lock")
+	}
+	waitForLeader(t, second, 2*time.Second)
+}
+
+func TestLeaderLockTakeover(t *testing.T) {
+	locks := newTestLocks(t, 2, time.Second)
+	first, second := locks[0], locks[1]
+
+	first.campaign(context.Background())
+	leading := waitForLeader(t, first, time.Second)
+
+	// The lock expires when the leader stops renewing it
+	second.Start()
+	defer second.Close()
+	waitForLeader(t, second, 5*time.Second)
+
+	// The old leader notices on its next renewal
+	first.campaign(context.Background())
+	if _, ok := first.Leading(); ok {
+		t.Error("old leader still leads after the lock was taken over")
+	}
+	if leading.Err() == nil {
+		t.Error("leading context not cancelled after losing the lock")
+	}
+}
+
+func TestRunnerLeaderLock(t *testing.T) {
+	src := newBlockingSource()
+	runner := newTestRunner(t, src)
+	lock := newTestLocks(t, 1, time.Minute)[0]
+	runner.scanner.lock = lock
+
+	if _, err := runner.Start(ScanOptions{}, TriggerAPI); !errors.Is(err, ErrNotLeader) {
+		t.Errorf("Start() error = %v, want ErrNotLeader", err)
+	}
+
+	lock.campaign(context.Background())
+	if _, err := runner.Start(ScanOptions{}, TriggerAPI); err != nil {
+		t.Fatalf("Start() unexpected error: %v", err)
+	}
+	<-src.started
+
+	// Losing the lock stops the scan
+	lock.setRevision(0)
+	if last := waitForLast(t, runner); last.State != ScanStateCancelled {
+		t.Errorf("Status() last = %+v, want a cancelled scan", last)
+	}
+}
+
+func TestRunnerQueue(t *testing.T) {
+	src := newBlockingSource()
+	runner := newTestRunner(t, src)
+	runner.queue = true
+
+	first, err := runner.Start(ScanOptions{}, TriggerAPI)
+	if err != nil {
+		t.Fatalf("Start() unexpected error: %v", err)
+	}
+	<-src.started
+
+	queued := make(chan ScanStatus, 1)
+	go func() {
+		status, err := runner.Run(context.Background(), ScanOptions{Mode: ScanFull}, TriggerCron)
+		if err != nil {
+			t.Errorf("Run() unexpected error: %v", err)
+		}
+		queued <- status
+	}()
+
+	// Further ticks are coalesced with the queued scan
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		runner.mu.Lock()
+		waiting := runner.queued
+		runner.mu.Unlock()
+		if waiting {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Timeout waiting for the scan to be queued")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, err := runner.Run(context.Background(), ScanOptions{}, TriggerCron); !errors.Is(err, ErrScanRunning) {
+		t.Errorf("Run() error = %v, want ErrScanRunning", err)
+	}
+
+	close(src.release)
+	select {
+	case status := <-queued:
+		if status.ID == first.ID || status.State != ScanStateSucceeded || status.Trigger != TriggerCron {
+			t.Errorf("queued scan = %+v, want a succeeded cron scan after %s", status, first.ID)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timeout waiting for the queued scan")
+	}
+}
@@ -0,0 +1,130 @@
+package collector
+
+import (
+	"time"
+
+	"github.com/klimeurt/secflow-collector/internal/config"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// scanMetrics holds the Prometheus metrics of a scanner. Organizations are
+// labelled with their provider, as a GitLab group may share the name of a
+// GitHub organization.
+type scanMetrics struct {
+	scans         *prometheus.CounterVec
+	scansFailed   *prometheus.CounterVec
+	duration      *prometheus.HistogramVec
+	listed        *prometheus.CounterVec
+	published     *prometheus.CounterVec
+	filtered      *prometheus.CounterVec
+	skipped       *prometheus.CounterVec
+	duplicates    *prometheus.CounterVec
+	publishErrors *prometheus.CounterVec
+	// The outcome of the last scan of each organization and mode, so an
+	// alert can fire when a full scan silently publishes nothing
+	lastPublished *prometheus.GaugeVec
+	lastSucceeded *prometheus.GaugeVec
+	lastCompleted *prometheus.GaugeVec
+}
+
+// newScanMetrics creates the scanner metrics, unregistered
+func newScanMetrics() *scanMetrics {
+	orgLabels := []string{"provider", "org"}
+	lastLabels := []string{"provider", "org", "mode"}
+	return &scanMetrics{
+		scans: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "secflow_collector_scans_total",
+			Help: "Scans run, by mode.",
+		}, []string{"mode"}),
+		scansFailed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "secflow_collector_scans_failed_total",
+			Help: "Scans in which at least one organization failed, by mode.",
+		}, []string{"mode"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "secflow_collector_scan_duration_seconds",
+			Help:    "Duration of scans, by mode.",
+			Buckets: prometheus.ExponentialBuckets(1, 2, 14),
+		}, []string{"mode"}),
+		listed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "secflow_collector_repos_listed_total",
+			Help: "Repositories listed by scans.",
+		}, orgLabels),
+		published: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "secflow_collector_repos_published_total",
+			Help: "Repositories published.",
+		}, orgLabels),
+		filtered: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "secflow_collector_repos_filtered_total",
+			Help: "Repositories dropped by a filter rule, by rule.",
+		}, []string{"provider", "org", "rule"}),
+		skipped: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "secflow_collector_repos_skipped_total",
+			Help: "Repositories skipped by incremental scans as unchanged.",
+		}, orgLabels),
+		duplicates: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "secflow_collector_repos_duplicate_total",
+			Help: "Repositories JetStream discarded as duplicates of an earlier run's message.",
+		}, orgLabels),
+		publishErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "secflow_collector_publish_errors_total",
+			Help: "Repositories and lifecycle events that failed to publish.",
+		}, orgLabels),
+		lastPublished: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "secflow_collector_last_scan_published_repos",
+			Help: "Repositories published by the last scan of the organization in the mode.",
+		}, lastLabels),
+		lastSucceeded: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "secflow_collector_last_scan_success",
+			Help: "Whether the last scan of the organization succeeded.",
+		}, lastLabels),
+		lastCompleted: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "secflow_collector_last_scan_completed_timestamp_seconds",
+			Help: "Time at which the last scan of the organization completed.",
+		}, lastLabels),
+	}
+}
+
+// collectors returns every metric of the scanner
+func (m *scanMetrics) collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		m.scans, m.scansFailed, m.duration,
+		m.listed, m.published, m.filtered, m.skipped, m.duplicates, m.publishErrors,
+		m.lastPublished, m.lastSucceeded, m.lastCompleted,
+	}
+}
+
+// observeScan records a scan of every requested organization
+func (m *scanMetrics) observeScan(mode ScanMode, duration time.Duration, err error) {
+	m.scans.WithLabelValues(string(mode)).Inc()
+	if err != nil {
+		m.scansFailed.WithLabelValues(string(mode)).Inc()
+	}
+	m.duration.WithLabelValues(string(mode)).Observe(duration.Seconds())
+}
+
+// observeOrg records the counts of the completed scan of an organization
+func (m *scanMetrics) observeOrg(org config.OrgConfig, event ScanEvent) {
+	labels := []string{org.Provider, org.Name}
+	m.listed.WithLabelValues(labels...).Add(float64(event.Listed))
+	m.published.WithLabelValues(labels...).Add(float64(event.Published))
+	m.skipped.WithLabelValues(labels...).Add(float64(event.Skipped))
+	m.duplicates.WithLabelValues(labels...).Add(float64(event.Duplicates))
+	m.publishErrors.WithLabelValues(labels...).Add(float64(event.Failed))
+
+	last := append(labels, string(event.Mode))
+	m.lastPublished.WithLabelValues(last...).Set(float64(event.Published))
+	succeeded := 0.0
+	if event.Succeeded {
+		succeeded = 1
+	}
+	m.lastSucceeded.WithLabelValues(last...).Set(succeeded)
+	if event.CompletedAt != nil {
+		m.lastCompleted.WithLabelValues(last...).Set(float64(event.CompletedAt.Unix()))
+	}
+}
+
+// Collectors returns the Prometheus collectors of the scanner: the scan
+// metrics, and the requests, rate limits and cache of its GitHub clients
+func (s *Scanner) Collectors() []prometheus.Collector {
+	return append(s.metrics.collectors(), s.clients.Collector())
+}
@@ -0,0 +1,86 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/klimeurt/secflow-collector/internal/config"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestScanMetrics(t *testing.T) {
+	natsServer := runMockNATSServer()
+	defer natsServer.Shutdown()
+
+	scanner, err := New(&config.Config{
+		GitHubOrg:   "testorg",
+		GitHubToken: "token123",
+		NATSUrl:     natsServer.ClientURL(),
+		NATSSubject: "github.repositories",
+		Filters:     config.FilterConfig{NameExclude: []string{"repo3"}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create scanner: %v", err)
+	}
+	defer scanner.Close()
+
+	src := newFakeSource(2, 2)
+	scanner.sources[config.ProviderGitHub] = src
+
+	// Every collector registers without conflicts
+	registry := prometheus.NewRegistry()
+	for _, c := range scanner.Collectors() {
+		if err := registry.Register(c); err != nil {
+			t.Fatalf("Register() unexpected error: %v", err)
+		}
+	}
+
+	if _, err := scanner.Scan(context.Background(), ScanOptions{Mode: ScanFull}); err != nil {
+		t.Fatalf("Scan() unexpected error: %v", err)
+	}
+
+	m := scanner.metrics
+	org := []string{config.ProviderGitHub, "testorg"}
+	last := []string{config.ProviderGitHub, "testorg", string(ScanFull)}
+	checks := []struct {
+		name string
+		got  float64
+		want float64
+	}{
+		{"scans", testutil.ToFloat64(m.scans.WithLabelValues("full")), 1},
+		{"failed scans", testutil.ToFloat64(m.scansFailed.WithLabelValues("full")), 0},
+		{"listed", testutil.ToFloat64(m.listed.WithLabelValues(org...)), 4},
+		{"published", testutil.ToFloat64(m.published.WithLabelValues(org...)), 3},
+		{"filtered", testutil.ToFloat64(m.filtered.WithLabelValues(config.ProviderGitHub, "testorg", FilterName)), 1},
+		{"last published", testutil.ToFloat64(m.lastPublished.WithLabelValues(last...)), 3},
+		{"last success", testutil.ToFloat64(m.lastSucceeded.WithLabelValues(last...)), 1},
+	}
+	for _, c := range checks {
+		if c.got != c.want {
+			t.Errorf("%s = %v, want %v", c.name, c.got, c.want)
+		}
+	}
+	if n := testutil.CollectAndCount(m.duration); n != 1 {
+		t.Errorf("scan duration series = %d, want 1", n)
+	}
+	if _, err := registry.Gather(); err != nil {
+		t.Errorf("Gather() unexpected error: %v", err)
+	}
+
+	// A failed scan is counted and marks the organization as failed
+	src.fail[2] = errors.New("server error")
+	if _, err := scanner.Scan(context.Background(), ScanOptions{Mode: ScanFull}); err == nil {
+		t.Fatal("Scan() expected error, got nil")
+	}
+	if got := testutil.ToFloat64(m.scansFailed.WithLabelValues("full")); got != 1 {
+		t.Errorf("failed scans = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(m.lastSucceeded.WithLabelValues(last...)); got != 0 {
+		t.Errorf("last success = %v, want 0", got)
+	}
+	if got := testutil.ToFloat64(m.lastPublished.WithLabelValues(last...)); got != 2 {
+		t.Errorf("last published = %v, want 2", got)
+	}
+}
@@ -0,0 +1,111 @@
+package collector
+
+import (
+	"context"
+	"sync"
+)
+
+// fetchPages lists the pages of org from page start on and sends each one to
+// pages as soon as it is fetched, then closes pages. Once the first page
+// reports the last page, up to concurrency pages are fetched at once and are
+// sent in completion order. It returns the first error, after which no more
+// pages are fetched.
+func fetchPages(ctx context.Context, src Source, org string, start, concurrency int, pages chan<- *Page) error {
+	defer close(pages)
+
+	page, err := src.ListPage(ctx, org, start)
+	if err != nil {
+		return err
+	}
+	if err := sendPage(ctx, pages, page); err != nil {
+		return err
+	}
+
+	if concurrency > 1 && page.Next != 0 && page.Last >= page.Next {
+		if page, err = fetchRange(ctx, src, org, page.Next, page.Last, concurrency, pages); err != nil {
+			return err
+		}
+	}
+
+	// Follow the next links, also to pick up pages added while the range
+	// was fetched
+	for page.Next != 0 {
+		if page, err = src.ListPage(ctx, org, page.Next); err != nil {
+			return err
+		}
+		if err := sendPage(ctx, pages, page); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fetchRange fetches the pages first to last with concurrency workers and
+// sends them to pages. It returns the last page.
+func fetchRange(ctx context.Context, src Source, org string, first, last, concurrency int, pages chan<- *Page) (*Page, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+		lastPage *Page
+	)
+	numbers := make(chan int)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := range numbers {
+				page, err := src.ListPage(ctx, org, n)
+				if err == nil {
+					err = sendPage(ctx, pages, page)
+				}
+				if err != nil {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					mu.Unlock()
+					cancel()
+					return
+				}
+				if n == last {
+					mu.Lock()
+					lastPage = page
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+feed:
+	for n := first; n <= last; n++ {
+		select {
+		case numbers <- n:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(numbers)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if lastPage == nil {
+		return nil, ctx.Err()
+	}
+	return lastPage, nil
+}
+
+// sendPage sends page to pages unless ctx is done first
+func sendPage(ctx context.Context, pages chan<- *Page, page *Page) error {
+	select {
+	case pages <- page:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
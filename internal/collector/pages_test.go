@@ -0,0 +1,212 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/klimeurt/secflow-collector/internal/config"
+	"github.com/nats-io/nats.go"
+)
+
+// fakeSource serves pages of repositories from memory
+type fakeSource struct {
+	mu    sync.Mutex
+	pages [][]Repository
+	// fail holds errors returned once for a page
+	fail  map[int]error
+	calls []int
+}
+
+// newFakeSource creates a source with perPage repositories on each of pages
+// pages, numbered from 1
+func newFakeSource(pages, perPage int) *fakeSource {
+	f := &fakeSource{fail: make(map[int]error)}
+	for p := 0; p < pages; p++ {
+		var repos []Repository
+		for i := 1; i <= perPage; i++ {
+			id := int64(p*perPage + i)
+			repos = append(repos, Repository{ID: id, Name: fmt.Sprintf("repo%d", id), Provider: config.ProviderGitHub})
+		}
+		f.pages = append(f.pages, repos)
+	}
+	return f
+}
+
+func (f *fakeSource) ListPage(_ context.Context, _ string, page int) (*Page, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.calls = append(f.calls, page)
+	if err, ok := f.fail[page]; ok {
+		delete(f.fail, page)
+		return nil, err
+	}
+
+	p := &Page{Number: page, Repos: f.pages[page-1], Last: len(f.pages)}
+	if page < len(f.pages) {
+		p.Next = page + 1
+	}
+	return p, nil
+}
+
+func (f *fakeSource) LookupTransfer(_ context.Context, org string, id int64) (string, error) {
+	return "", fmt.Errorf("%w: %s repository ID %d", ErrRepoNotFound, org, id)
+}
+
+func (f *fakeSource) GetRepository(_ context.Context, org, name string) (*Repository, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, page := range f.pages {
+		for _, repo := range page {
+			if repo.Name == name {
+				return &repo, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("%w: %s/%s", ErrRepoNotFound, org, name)
+}
+
+func TestFetchPages(t *testing.T) {
+	for _, concurrency := range []int{1, 3} {
+		t.Run(fmt.Sprintf("concurrency %d", concurrency), func(t *testing.T) {
+			src := newFakeSource(5, 2)
+			pages := make(chan *Page)
+			errCh := make(chan error, 1)
+			go func() { errCh <- fetchPages(context.Background(), src, "testorg", 1, concurrency, pages) }()
+
+			var numbers []int
+			for page := range pages {
+				numbers = append(numbers, page.Number)
+			}
+			if err := <-errCh; err != nil {
+				t.Fatalf("fetchPages() unexpected error: %v", err)
+			}
+
+			sort.Ints(numbers)
+			if fmt.Sprint(numbers) != "[1 2 3 4 5]" {
+				t.Errorf("pages = %v, want [1 2 3 4 5]", numbers)
+			}
+			if len(src.calls) != 5 {
+				t.Errorf("ListPage() called %d times, want 5", len(src.calls))
+			}
+		})
+	}
+}
+
+func TestFetchPagesError(t *testing.T) {
+	src := newFakeSource(5, 2)
+	src.fail[3] = errors.New("server error")
+
+	pages := make(chan *Page)
+	errCh := make(chan error, 1)
+	go func() { errCh <- fetchPages(context.Background(), src, "testorg", 1, 2, pages) }()
+
+	for range pages {
+	}
+	if err := <-errCh; err == nil || err.Error() != "server error" {
+		t.Errorf("fetchPages() error = %v, want server error", err)
+	}
+}
+
+func TestScanResume(t *testing.T) {
+	natsServer := runMockNATSServer()
+	defer natsServer.Shutdown()
+
+	cfg := &config.Config{
+		GitHubOrg:            "testorg",
+		GitHubToken:          "token123",
+		NATSUrl:              natsServer.ClientURL(),
+		NATSSubject:          "github.repositories",
+		StateBackend:         config.StateBackendFile,
+		StateFile:            filepath.Join(t.TempDir(), "state.json"),
+		ScanCheckpointMaxAge: time.Hour,
+	}
+
+	scanner, err := New(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create scanner: %v", err)
+	}
+	defer scanner.Close()
+
+	src := newFakeSource(3, 2)
+	src.fail[3] = errors.New("server error")
+	scanner.sources[config.ProviderGitHub] = src
+
+	messages := make(chan *nats.Msg, 20)
+	sub, err := scanner.nc.ChanSubscribe(cfg.NATSSubject, messages)
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+	defer func() { _ = sub.Unsubscribe() }()
+
+	// The first scan publishes the first two pages before failing
+	result, err := scanner.Scan(context.Background(), ScanOptions{Mode: ScanFull})
+	if err == nil {
+		t.Fatal("Scan() expected error, got nil")
+	}
+	if result.Published != 4 {
+		t.Errorf("Published = %d, want 4", result.Published)
+	}
+
+	st, err := scanner.state.Load(context.Background(), "testorg")
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if st.Checkpoint == nil || st.Checkpoint.Page != 2 || len(st.Checkpoint.Listed) != 4 {
+		t.Fatalf("Checkpoint = %+v, want page 2 with 4 repositories", st.Checkpoint)
+	}
+
+	// The second scan resumes from the checkpointed page
+	src.calls = nil
+	result, err = scanner.Scan(context.Background(), ScanOptions{Mode: ScanFull})
+	if err != nil {
+		t.Fatalf("Scan() unexpected error: %v", err)
+	}
+	if fmt.Sprint(src.calls) != "[2 3]" {
+		t.Errorf("pages fetched = %v, want [2 3]", src.calls)
+	}
+	if result.Published != 2 {
+		t.Errorf("Published = %d, want 2", result.Published)
+	}
+
+	st, err = scanner.state.Load(context.Background(), "testorg")
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if st.Checkpoint != nil || len(st.Repos) != 6 {
+		t.Errorf("state = %d repositories, checkpoint %+v, want 6 and none", len(st.Repos), st.Checkpoint)
+	}
+
+	published := make(map[string]int)
+	timeout := time.After(5 * time.Second)
+	for received := 0; received < 6; received++ {
+		select {
+		case msg := <-messages:
+			var repo Repository
+			if err := json.Unmarshal(msg.Data, &repo); err != nil {
+				t.Fatalf("Failed to unmarshal message: %v", err)
+			}
+			published[repo.Name]++
+		case <-timeout:
+			t.Fatalf("Timeout waiting for messages, got %v", published)
+		}
+	}
+	select {
+	case msg := <-messages:
+		t.Errorf("Unexpected message: %s", msg.Data)
+	case <-time.After(200 * time.Millisecond):
+	}
+	for i := 1; i <= 6; i++ {
+		if name := fmt.Sprintf("repo%d", i); published[name] != 1 {
+			t.Errorf("%s published %d times, want once", name, published[name])
+		}
+	}
+}
@@ -2,14 +2,41 @@ package collector
 
 import "time"
 
-// Repository represents a GitHub repository
+// Repository represents a repository listed by a source provider, such as
+// GitHub or GitLab. Fields are only ever added, so consumers of older
+// messages keep working.
 type Repository struct {
-	Name      string    `json:"name"`
-	CloneURL  string    `json:"clone_url"`
-	SSHURL    string    `json:"ssh_url"`
-	HTTPSURL  string    `json:"https_url"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	Language  string    `json:"language,omitempty"`
-	Topics    []string  `json:"topics,omitempty"`
-}
\ No newline at end of file
+	ID       int64  `json:"id"`
+	Name     string `json:"name"`
+	FullName string `json:"full_name"`
+	// Owner is the user or organization owning the repository; for GitLab
+	// the full path of the project's group
+	Owner    string `json:"owner"`
+	CloneURL string `json:"clone_url"`
+	SSHURL   string `json:"ssh_url"`
+	// HTTPSURL is the HTTPS URL of the repository without the .git suffix
+	HTTPSURL      string `json:"https_url"`
+	HTMLURL       string `json:"html_url"`
+	DefaultBranch string `json:"default_branch"`
+	// Visibility is public, private or internal
+	Visibility string `json:"visibility"`
+	Private    bool   `json:"private"`
+	Archived   bool   `json:"archived"`
+	Fork       bool   `json:"fork"`
+	Template   bool   `json:"is_template"`
+	// Size is the repository size in kilobytes
+	Size int `json:"size"`
+	// SizeUnknown is set when the provider did not report the size, as
+	// GitLab does for tokens without the Reporter role, and Size is zero
+	SizeUnknown bool      `json:"size_unknown,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	PushedAt    time.Time `json:"pushed_at"`
+	Language    string    `json:"language,omitempty"`
+	Topics      []string  `json:"topics,omitempty"`
+	// License is the SPDX identifier of the detected license
+	License string `json:"license,omitempty"`
+	Org     string `json:"org,omitempty"`
+	// Provider is the source provider, config.ProviderGitHub when empty
+	Provider string `json:"provider,omitempty"`
+}
@@ -89,4 +89,4 @@ func TestRepositoryEmptyFields(t *testing.T) {
 	if strings.Contains(jsonStr, `"topics"`) {
 		t.Error("Empty topics field should be omitted from JSON")
 	}
-}
\ No newline at end of file
+}
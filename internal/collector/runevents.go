@@ -0,0 +1,109 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/klimeurt/secflow-collector/internal/config"
+)
+
+// HeaderRunID carries the ID of the scan run on every repository message,
+// lifecycle event and scan event
+const HeaderRunID = "Secflow-Run-Id"
+
+// ScanEventType is the kind of scan event
+type ScanEventType string
+
+const (
+	// ScanStarted is emitted before the repositories of an organization are
+	// listed
+	ScanStarted ScanEventType = "started"
+	// ScanCompleted is emitted once the scan of an organization finished,
+	// whether it succeeded or not
+	ScanCompleted ScanEventType = "completed"
+)
+
+// ScanEvent reports the start or the end of the scan of an organization.
+// Completed events carry the counts of the scan and the IDs of the
+// repositories published with the run ID, so consumers can check that they
+// received all of them.
+type ScanEvent struct {
+	Type      ScanEventType `json:"type"`
+	RunID     string        `json:"run_id"`
+	Mode      ScanMode      `json:"mode"`
+	Org       string        `json:"org"`
+	Provider  string        `json:"provider"`
+	StartedAt time.Time     `json:"started_at"`
+	// Fields of completed events
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	DurationMS  int64      `json:"duration_ms,omitempty"`
+	Succeeded   bool       `json:"succeeded,omitempty"`
+	Error       string     `json:"error,omitempty"`
+	Listed      int        `json:"listed"`
+	Filtered    int        `json:"filtered"`
+	Published   int        `json:"published"`
+	Skipped     int        `json:"skipped"`
+	Duplicates  int        `json:"duplicates"`
+	Failed      int        `json:"failed"`
+	Events      int        `json:"events"`
+	RepoIDs     []int64    `json:"repo_ids,omitempty"`
+}
+
+// ScanEventSubject returns the subject scan events of the given type are
+// published on, derived from the repository subject
+func ScanEventSubject(subject string, eventType ScanEventType) string {
+	return subject + ".scan." + string(eventType)
+}
+
+// newScanCompleted returns the completed event of a scan started with
+// started, with the counts the scan added to result since before
+func newScanCompleted(started ScanEvent, before, result *ScanResult, published []int64, err error) ScanEvent {
+	event := started
+	event.Type = ScanCompleted
+	completedAt := time.Now()
+	event.CompletedAt = &completedAt
+	event.DurationMS = completedAt.Sub(started.StartedAt).Milliseconds()
+	event.Succeeded = err == nil
+	if err != nil {
+		event.Error = err.Error()
+	}
+
+	event.Listed = result.Listed - before.Listed
+	event.Filtered = result.Filtered - before.Filtered
+	event.Published = result.Published - before.Published
+	event.Skipped = result.Skipped - before.Skipped
+	event.Duplicates = result.Duplicates - before.Duplicates
+	event.Failed = result.Failed - before.Failed
+	event.Events = result.Events - before.Events
+
+	event.RepoIDs = append([]int64(nil), published...)
+	sort.Slice(event.RepoIDs, func(i, j int) bool { return event.RepoIDs[i] < event.RepoIDs[j] })
+	return event
+}
+
+// publishScanEvent publishes a scan event on the subject derived from the
+// organization's repository subject. Failures are logged, as they must not
+// fail the scan. Completed events are also published for cancelled scans.
+func (s *Scanner) publishScanEvent(ctx context.Context, org config.OrgConfig, event ScanEvent) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancel()
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		slog.Error("Failed to marshal scan event", "event", event.Type, "org", org.Name, "run_id", event.RunID, "error", err)
+		return
+	}
+
+	msgID := "scan-" + string(event.Type) + "-" + stateKey(org) + "-" + event.RunID
+	subject := ScanEventSubject(s.subjectFor(org), event.Type)
+	if _, err := s.publish(ctx, subject, data, msgID, event.RunID); err != nil {
+		slog.Warn("Failed to publish scan event", "event", event.Type, "provider", org.Provider, "org", org.Name,
+			"run_id", event.RunID, "subject", subject, "error", err)
+		return
+	}
+	slog.Debug("Published scan event", "event", event.Type, "provider", org.Provider, "org", org.Name,
+		"run_id", event.RunID, "subject", subject)
+}
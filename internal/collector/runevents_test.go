@@ -0,0 +1,151 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/klimeurt/secflow-collector/internal/config"
+	"github.com/nats-io/nats.go"
+)
+
+func TestScanEvents(t *testing.T) {
+	natsServer := runMockNATSServer()
+	defer natsServer.Shutdown()
+
+	cfg := &config.Config{
+		GitHubOrg:   "testorg",
+		GitHubToken: "token123",
+		NATSUrl:     natsServer.ClientURL(),
+		NATSSubject: "github.repositories",
+		Filters:     config.FilterConfig{NameExclude: []string{"repo3"}},
+	}
+	scanner, err := New(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create scanner: %v", err)
+	}
+	defer scanner.Close()
+
+	src := newFakeSource(2, 2)
+	scanner.sources[config.ProviderGitHub] = src
+
+	messages := make(chan *nats.Msg, 20)
+	sub, err := scanner.nc.ChanSubscribe("github.repositories.>", messages)
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+	defer func() { _ = sub.Unsubscribe() }()
+	repos := make(chan *nats.Msg, 20)
+	repoSub, err := scanner.nc.ChanSubscribe("github.repositories", repos)
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+	defer func() { _ = repoSub.Unsubscribe() }()
+
+	result, err := scanner.Scan(context.Background(), ScanOptions{Mode: ScanFull, RunID: "run-1"})
+	if err != nil {
+		t.Fatalf("Scan() unexpected error: %v", err)
+	}
+	if result.RunID != "run-1" {
+		t.Errorf("RunID = %q, want run-1", result.RunID)
+	}
+
+	started, completed := receiveScanEvents(t, messages)
+	if started.RunID != "run-1" || started.Org != "testorg" || started.Provider != config.ProviderGitHub || started.Mode != ScanFull {
+		t.Errorf("started event = %+v", started)
+	}
+	if completed.RunID != "run-1" || !completed.Succeeded || completed.CompletedAt == nil || !completed.StartedAt.Equal(started.StartedAt) {
+		t.Errorf("completed event = %+v, want a succeeded run-1", completed)
+	}
+	if completed.Listed != 4 || completed.Filtered != 1 || completed.Published != 3 || completed.Failed != 0 {
+		t.Errorf("completed counts = %d listed, %d filtered, %d published, %d failed, want 4, 1, 3 and 0",
+			completed.Listed, completed.Filtered, completed.Published, completed.Failed)
+	}
+	if fmt.Sprint(completed.RepoIDs) != "[1 2 4]" {
+		t.Errorf("completed repo IDs = %v, want [1 2 4]", completed.RepoIDs)
+	}
+
+	// Every repository message carries the run ID
+	for i := 0; i < 3; i++ {
+		select {
+		case msg := <-repos:
+			if runID := msg.Header.Get(HeaderRunID); runID != "run-1" {
+				t.Errorf("%s header = %q, want run-1", HeaderRunID, runID)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timeout waiting for repository messages")
+		}
+	}
+
+	// Failed scans report their error, and runs get an ID of their own
+	src.fail[2] = errors.New("server error")
+	result, err = scanner.Scan(context.Background(), ScanOptions{Mode: ScanFull})
+	if err == nil {
+		t.Fatal("Scan() expected error, got nil")
+	}
+	if result.RunID == "" || result.RunID == "run-1" {
+		t.Errorf("RunID = %q, want a new run ID", result.RunID)
+	}
+	started, completed = receiveScanEvents(t, messages)
+	if completed.RunID != result.RunID || started.RunID != result.RunID {
+		t.Errorf("event run IDs = %q and %q, want %q", started.RunID, completed.RunID, result.RunID)
+	}
+	if completed.Succeeded || completed.Error == "" || completed.Published != 2 {
+		t.Errorf("completed event = %+v, want a failed scan with 2 repositories published", completed)
+	}
+
+	// Scans can skip the events
+	if _, err := scanner.Scan(context.Background(), ScanOptions{Mode: ScanFull, SkipScanEvents: true}); err != nil {
+		t.Fatalf("Scan() unexpected error: %v", err)
+	}
+	// Messages arrive in order, so any event arrives before the marker
+	if err := scanner.nc.Publish("github.repositories.marker", nil); err != nil {
+		t.Fatalf("Failed to publish marker: %v", err)
+	}
+	select {
+	case msg := <-messages:
+		if msg.Subject != "github.repositories.marker" {
+			t.Errorf("received %s, want no scan events", msg.Subject)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timeout waiting for marker")
+	}
+}
+
+// receiveScanEvents waits for the started and completed events of a scan
+func receiveScanEvents(t *testing.T, messages chan *nats.Msg) (started, completed ScanEvent) {
+	t.Helper()
+
+	timeout := time.After(5 * time.Second)
+	for completed.Type == "" {
+		select {
+		case msg := <-messages:
+			var event ScanEvent
+			switch msg.Subject {
+			case ScanEventSubject("github.repositories", ScanStarted):
+				if err := json.Unmarshal(msg.Data, &started); err != nil {
+					t.Fatalf("Failed to unmarshal started event: %v", err)
+				}
+			case ScanEventSubject("github.repositories", ScanCompleted):
+				if err := json.Unmarshal(msg.Data, &event); err != nil {
+					t.Fatalf("Failed to unmarshal completed event: %v", err)
+				}
+				completed = event
+			default:
+				continue
+			}
+			if msg.Header.Get(HeaderRunID) == "" {
+				t.Errorf("%s event without %s header", msg.Subject, HeaderRunID)
+			}
+		case <-timeout:
+			t.Fatal("Timeout waiting for scan events")
+		}
+	}
+	if started.Type != ScanStarted {
+		t.Fatalf("completed event received without started event")
+	}
+	return started, completed
+}
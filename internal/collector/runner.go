@@ -0,0 +1,310 @@
+package collector
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/klimeurt/secflow-collector/internal/config"
+)
+
+// States of a scan run
+const (
+	ScanStateRunning   = "running"
+	ScanStateSucceeded = "succeeded"
+	ScanStateFailed    = "failed"
+	ScanStateCancelled = "cancelled"
+)
+
+// Triggers of a scan run
+const (
+	TriggerCron    = "cron"
+	TriggerStartup = "startup"
+	TriggerAPI     = "api"
+)
+
+// ErrScanRunning is returned when a scan is started while another one is
+// running
+var ErrScanRunning = errors.New("a scan is already running")
+
+// ErrShuttingDown is returned when a scan is started after Shutdown
+var ErrShuttingDown = errors.New("the collector is shutting down")
+
+// ScanStatus describes a running or finished scan
+type ScanStatus struct {
+	ID         string     `json:"id"`
+	Trigger    string     `json:"trigger"`
+	Mode       ScanMode   `json:"mode"`
+	Orgs       []string   `json:"orgs,omitempty"`
+	State      string     `json:"state"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Listed     int        `json:"listed"`
+	Published  int        `json:"published"`
+	Filtered   int        `json:"filtered"`
+	Skipped    int        `json:"skipped"`
+	Duplicates int        `json:"duplicates"`
+	Failed     int        `json:"failed"`
+	Events     int        `json:"events"`
+	FailedOrgs []string   `json:"failed_orgs,omitempty"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// setResult copies the counts of a scan result into the status
+func (st *ScanStatus) setResult(r ScanResult) {
+	st.Listed = r.Listed
+	st.Published = r.Published
+	st.Filtered = r.Filtered
+	st.Skipped = r.Skipped
+	st.Duplicates = r.Duplicates
+	st.Failed = r.Failed
+	st.Events = r.Events
+	st.FailedOrgs = r.FailedOrgs
+}
+
+// Runner runs the scans of a scanner one at a time and tracks the status of
+// the current and the last scan. With a leader lock, scans only run on the
+// replica holding it.
+type Runner struct {
+	scanner *Scanner
+	// timeout bounds every scan
+	timeout time.Duration
+	// queue makes Run wait for the running scan instead of skipping
+	queue bool
+	// ctx is the root context of every scan, cancelled by Shutdown
+	ctx  context.Context
+	stop context.CancelFunc
+
+	mu      sync.Mutex
+	current *scanRun
+	last    *ScanStatus
+	// queued is set while a scan waits for the running scan
+	queued bool
+}
+
+// scanRun is a running scan
+type scanRun struct {
+	status ScanStatus
+	opts   ScanOptions
+	ctx    context.Context
+	cancel context.CancelFunc
+	// done is closed when the scan finished
+	done chan struct{}
+}
+
+// NewRunner creates a runner for scanner, configured by its ScanTimeout and
+// ScanOverlap settings
+func NewRunner(scanner *Scanner) *Runner {
+	ctx, stop := context.WithCancel(context.Background())
+	return &Runner{
+		scanner: scanner,
+		timeout: scanner.config.ScanTimeout,
+		queue:   scanner.config.ScanOverlap == config.ScanOverlapQueue,
+		ctx:     ctx,
+		stop:    stop,
+	}
+}
+
+// Run runs a scan and waits for it to finish. If another scan is running, it
+// returns ErrScanRunning without scanning, or with the queue overlap policy
+// waits for that scan to finish first. Only one scan waits at a time, so
+// ticks of a schedule that keeps overrunning are coalesced.
+func (r *Runner) Run(ctx context.Context, opts ScanOptions, trigger string) (ScanStatus, error) {
+	for {
+		run, err := r.begin(ctx, opts, trigger)
+		if !errors.Is(err, ErrScanRunning) || !r.queue {
+			if err != nil {
+				return ScanStatus{}, err
+			}
+			return r.execute(run), nil
+		}
+
+		r.mu.Lock()
+		if r.queued || r.current == nil {
+			queued := r.queued
+			r.mu.Unlock()
+			if queued {
+				return ScanStatus{}, err
+			}
+			// The running scan finished in the meantime
+			continue
+		}
+		r.queued = true
+		done := r.current.done
+		r.mu.Unlock()
+
+		slog.Info("Queued scan until the running scan finishes", "mode", opts.Mode)
+		select {
+		case <-done:
+		case <-ctx.Done():
+		}
+
+		r.mu.Lock()
+		r.queued = false
+		r.mu.Unlock()
+		if ctx.Err() != nil {
+			return ScanStatus{}, ctx.Err()
+		}
+	}
+}
+
+// Start starts a scan in the background and returns its initial status. It
+// returns ErrScanRunning if another scan is running, and ErrUnknownOrg if a
+// requested organization is not configured.
+func (r *Runner) Start(opts ScanOptions, trigger string) (ScanStatus, error) {
+	run, err := r.begin(r.ctx, opts, trigger)
+	if err != nil {
+		return ScanStatus{}, err
+	}
+	go r.execute(run)
+	return run.status, nil
+}
+
+// Cancel cancels the running scan and returns its status, or returns false if
+// no scan is running
+func (r *Runner) Cancel() (ScanStatus, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.current == nil {
+		return ScanStatus{}, false
+	}
+	slog.Info("Cancelling scan", "run_id", r.current.status.ID)
+	r.current.cancel()
+	return r.current.status, true
+}
+
+// Status returns the status of the running scan and of the last finished
+// scan, either of which is nil if there is none
+func (r *Runner) Status() (current, last *ScanStatus) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.current != nil {
+		st := r.current.status
+		current = &st
+	}
+	if r.last != nil {
+		st := *r.last
+		last = &st
+	}
+	return current, last
+}
+
+// begin registers a new scan unless one is running or another replica holds
+// the leader lock
+func (r *Runner) begin(ctx context.Context, opts ScanOptions, trigger string) (*scanRun, error) {
+	if opts.Mode == "" {
+		opts.Mode = ScanFull
+	}
+	if _, err := r.scanner.Organizations(opts.Orgs); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.ctx.Err() != nil {
+		return nil, ErrShuttingDown
+	}
+	if r.current != nil {
+		return nil, ErrScanRunning
+	}
+	var leading context.Context
+	if r.scanner.lock != nil {
+		var ok bool
+		if leading, ok = r.scanner.lock.Leading(); !ok {
+			return nil, ErrNotLeader
+		}
+	}
+
+	run := &scanRun{
+		status: ScanStatus{
+			ID:        newRunID(time.Now()),
+			Trigger:   trigger,
+			Mode:      opts.Mode,
+			Orgs:      opts.Orgs,
+			State:     ScanStateRunning,
+			StartedAt: time.Now(),
+		},
+	}
+	run.ctx, run.cancel = context.WithTimeout(ctx, r.timeout)
+	run.done = make(chan struct{})
+	// Stop scanning on shutdown, and once another replica may have taken
+	// over
+	for _, parent := range []context.Context{r.ctx, leading} {
+		if parent == nil {
+			continue
+		}
+		stop := context.AfterFunc(parent, run.cancel)
+		cancel := run.cancel
+		run.cancel = func() {
+			stop()
+			cancel()
+		}
+	}
+
+	// Track progress in the status
+	opts.Progress = func(result ScanResult) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		run.status.setResult(result)
+	}
+	opts.RunID = run.status.ID
+	run.opts = opts
+
+	r.current = run
+	return run, nil
+}
+
+// execute runs a registered scan and records its final status
+func (r *Runner) execute(run *scanRun) ScanStatus {
+	defer run.cancel()
+
+	slog.Info("Starting scan", "run_id", run.status.ID, "mode", run.opts.Mode, "trigger", run.status.Trigger)
+	result, err := r.scanner.Scan(run.ctx, run.opts)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	st := &run.status
+	finishedAt := time.Now()
+	st.FinishedAt = &finishedAt
+	if result != nil {
+		st.setResult(*result)
+	}
+	switch {
+	case errors.Is(run.ctx.Err(), context.Canceled):
+		st.State = ScanStateCancelled
+	case err != nil:
+		st.State = ScanStateFailed
+	default:
+		st.State = ScanStateSucceeded
+	}
+	if err != nil {
+		st.Error = err.Error()
+	}
+
+	attrs := []any{"run_id", st.ID, "mode", st.Mode, "state", st.State,
+		"duration", finishedAt.Sub(st.StartedAt).Round(time.Second).String()}
+	if err != nil {
+		slog.Warn("Scan finished", append(attrs, "error", err)...)
+	} else {
+		slog.Info("Scan finished", attrs...)
+	}
+	r.current = nil
+	r.last = st
+	close(run.done)
+	return *st
+}
+
+// newRunID returns a unique identifier for a scan started at t
+func newRunID(t time.Time) string {
+	b := make([]byte, 4)
+	_, _ = rand.Read(b)
+	return t.UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(b)
+}
@@ -0,0 +1,150 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/klimeurt/secflow-collector/internal/config"
+)
+
+// blockingSource serves a page of repositories once release is closed
+type blockingSource struct {
+	*fakeSource
+	started chan struct{}
+	release chan struct{}
+}
+
+func newBlockingSource() *blockingSource {
+	return &blockingSource{
+		fakeSource: newFakeSource(1, 2),
+		started:    make(chan struct{}, 1),
+		release:    make(chan struct{}),
+	}
+}
+
+func (b *blockingSource) ListPage(ctx context.Context, org string, page int) (*Page, error) {
+	select {
+	case b.started <- struct{}{}:
+	default:
+	}
+	select {
+	case <-b.release:
+		return b.fakeSource.ListPage(ctx, org, page)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// newTestRunner creates a runner scanning testorg from src
+func newTestRunner(t *testing.T, src Source) *Runner {
+	t.Helper()
+
+	natsServer := runMockNATSServer()
+	t.Cleanup(natsServer.Shutdown)
+
+	scanner, err := New(&config.Config{
+		GitHubOrg:   "testorg",
+		GitHubToken: "token123",
+		NATSUrl:     natsServer.ClientURL(),
+		NATSSubject: "github.repositories",
+		ScanTimeout: time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create scanner: %v", err)
+	}
+	t.Cleanup(scanner.Close)
+	scanner.sources[config.ProviderGitHub] = src
+
+	return NewRunner(scanner)
+}
+
+// waitForLast waits for the runner to record a finished scan
+func waitForLast(t *testing.T, runner *Runner) *ScanStatus {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if current, last := runner.Status(); current == nil && last != nil {
+			return last
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("Timeout waiting for the scan to finish")
+	return nil
+}
+
+func TestRunner(t *testing.T) {
+	src := newBlockingSource()
+	runner := newTestRunner(t, src)
+
+	status, err := runner.Start(ScanOptions{}, TriggerAPI)
+	if err != nil {
+		t.Fatalf("Start() unexpected error: %v", err)
+	}
+	if status.State != ScanStateRunning || status.Mode != ScanFull || status.ID == "" {
+		t.Errorf("Start() = %+v, want a running full scan", status)
+	}
+	<-src.started
+
+	// Only one scan runs at a time
+	if _, err := runner.Start(ScanOptions{}, TriggerAPI); !errors.Is(err, ErrScanRunning) {
+		t.Errorf("Start() error = %v, want ErrScanRunning", err)
+	}
+	if _, err := runner.Run(context.Background(), ScanOptions{}, TriggerCron); !errors.Is(err, ErrScanRunning) {
+		t.Errorf("Run() error = %v, want ErrScanRunning", err)
+	}
+	if current, _ := runner.Status(); current == nil || current.ID != status.ID {
+		t.Errorf("Status() current = %+v, want scan %s", current, status.ID)
+	}
+
+	close(src.release)
+	last := waitForLast(t, runner)
+	if last.ID != status.ID || last.State != ScanStateSucceeded || last.Published != 2 || last.FinishedAt == nil {
+		t.Errorf("Status() last = %+v, want scan %s succeeded with 2 repositories published", last, status.ID)
+	}
+
+	// The next scan can start once the previous one finished
+	status, err = runner.Run(context.Background(), ScanOptions{Orgs: []string{"github/testorg"}}, TriggerCron)
+	if err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+	if status.State != ScanStateSucceeded || status.Trigger != TriggerCron {
+		t.Errorf("Run() = %+v, want a succeeded cron scan", status)
+	}
+}
+
+func TestRunnerCancel(t *testing.T) {
+	src := newBlockingSource()
+	runner := newTestRunner(t, src)
+
+	if _, ok := runner.Cancel(); ok {
+		t.Error("Cancel() without a running scan returned true")
+	}
+
+	status, err := runner.Start(ScanOptions{}, TriggerAPI)
+	if err != nil {
+		t.Fatalf("Start() unexpected error: %v", err)
+	}
+	<-src.started
+
+	if cancelled, ok := runner.Cancel(); !ok || cancelled.ID != status.ID {
+		t.Errorf("Cancel() = %+v, %v, want scan %s", cancelled, ok, status.ID)
+	}
+	last := waitForLast(t, runner)
+	if last.State != ScanStateCancelled || last.Error == "" {
+		t.Errorf("Status() last = %+v, want a cancelled scan with an error", last)
+	}
+}
+
+func TestRunnerUnknownOrg(t *testing.T) {
+	runner := newTestRunner(t, newFakeSource(1, 1))
+
+	if _, err := runner.Start(ScanOptions{Orgs: []string{"other"}}, TriggerAPI); !errors.Is(err, ErrUnknownOrg) {
+		t.Errorf("Start() error = %v, want ErrUnknownOrg", err)
+	}
+	if current, last := runner.Status(); current != nil || last != nil {
+		t.Errorf("Status() = %+v, %+v, want no scans", current, last)
+	}
+}
@@ -3,114 +3,865 @@ package collector
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"strconv"
+	"time"
 
 	"github.com/google/go-github/v57/github"
 	"github.com/klimeurt/secflow-collector/internal/config"
+	"github.com/klimeurt/secflow-collector/internal/ghclient"
+	"github.com/klimeurt/secflow-collector/internal/tracing"
 	"github.com/nats-io/nats.go"
-	"golang.org/x/oauth2"
+	"github.com/nats-io/nats.go/jetstream"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
-// Scanner handles the GitHub scanning operations
+// tracerName is the instrumentation scope of the spans of scans and of the
+// repositories they publish
+const tracerName = "github.com/klimeurt/secflow-collector/internal/collector"
+
+// Scanner handles the repository scanning operations
 type Scanner struct {
 	config   *config.Config
 	ghClient *github.Client
+	clients  *ghclient.Factory
+	sources  map[string]Source
+	filter   *Filter
 	nc       *nats.Conn
+	js       jetstream.JetStream
+	state    StateStore
+	// lock is the leader lock, or nil when every replica may scan
+	lock    *LeaderLock
+	metrics *scanMetrics
+}
+
+// ScanMode selects which repositories a scan publishes
+type ScanMode string
+
+const (
+	// ScanFull publishes every repository in the organization
+	ScanFull ScanMode = "full"
+	// ScanIncremental publishes only repositories that are new or changed
+	// since the last scan
+	ScanIncremental ScanMode = "incremental"
+)
+
+// ScanOptions configures a single scan
+type ScanOptions struct {
+	Mode ScanMode
+	// RunID identifies the scan in scan events and message headers. A new
+	// ID is generated when it is empty.
+	RunID string
+	// Orgs limits the scan to these organizations, given by name or as
+	// provider/name. Empty scans every configured organization.
+	Orgs []string
+	// Progress, if set, is called with the counts so far after every page
+	Progress func(ScanResult)
+	// Published, if set, is called with every repository published, or that
+	// a dry run would publish, and the subject it is published on
+	Published func(subject string, repo Repository)
+	// Duplicate, if set, is called with every repository JetStream discarded
+	// as a duplicate of a message published by an earlier run
+	Duplicate func(subject string, repo Repository)
+	// SkipScanEvents publishes no scan events, for scans started by hand
+	// that consumers of the events should not mistake for scheduled ones
+	SkipScanEvents bool
+}
+
+// ErrUnknownOrg is returned when a scan is requested for an organization
+// that is not configured
+var ErrUnknownOrg = errors.New("unknown organization")
+
+// ErrRepoFiltered is returned when a repository requested on its own is
+// excluded by a filter rule
+var ErrRepoFiltered = errors.New("repository excluded by filter")
+
+// ScanResult summarizes a completed scan
+type ScanResult struct {
+	Mode      ScanMode
+	RunID     string
+	Listed    int
+	Published int
+	Skipped   int
+	Failed    int
+	Events    int
+	// Duplicates counts the repositories JetStream discarded as duplicates
+	// of a message published by an earlier run, which are not published
+	// with this run's ID
+	Duplicates int
+	// Filtered counts the repositories dropped by the filter rules, and
+	// FilteredBy how many each rule dropped
+	Filtered   int
+	FilteredBy map[string]int
+	// FailedOrgs lists the organizations whose scan failed
+	FailedOrgs []string
 }
 
 // New creates a new Scanner instance
 func New(cfg *config.Config) (*Scanner, error) {
-	// Create GitHub client with OAuth2 token
 	ctx := context.Background()
-	ts := oauth2.StaticTokenSource(
-		&oauth2.Token{AccessToken: cfg.GitHubToken},
-	)
-	tc := oauth2.NewClient(ctx, ts)
-	ghClient := github.NewClient(tc)
+	s, err := newScanner(cfg)
+	if err != nil {
+		return nil, err
+	}
 
 	// Connect to NATS
 	nc, err := nats.Connect(cfg.NATSUrl)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to NATS: %w", err)
 	}
+	s.nc = nc
+
+	// Set up JetStream publishing if enabled
+	if cfg.NATSJetStream {
+		if err := s.setupJetStream(ctx); err != nil {
+			nc.Close()
+			return nil, err
+		}
+	}
+
+	// Set up the scan state store if configured
+	if err := s.setupStateStore(ctx); err != nil {
+		nc.Close()
+		return nil, err
+	}
+
+	// Campaign for the leader lock if configured
+	if cfg.ScanLock {
+		if err := s.setupLock(ctx); err != nil {
+			nc.Close()
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// NewDryRun creates a scanner that lists and filters repositories like one
+// created by New, but publishes nothing. It does not connect to NATS, and
+// neither loads nor records scan state, so every scan publishes every
+// repository that passes the filters.
+func NewDryRun(cfg *config.Config) (*Scanner, error) {
+	return newScanner(cfg)
+}
 
-	return &Scanner{
+// newScanner creates a scanner with the sources and filter of cfg, without
+// a NATS connection
+func newScanner(cfg *config.Config) (*Scanner, error) {
+	// Create GitHub client factory
+	clients, err := ghclient.NewFactory(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GitHub client: %w", err)
+	}
+
+	// Build the repository filter
+	filter, err := NewFilter(cfg.Filters)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Scanner{
 		config:   cfg,
-		ghClient: ghClient,
-		nc:       nc,
-	}, nil
+		ghClient: clients.Default(),
+		clients:  clients,
+		sources:  map[string]Source{config.ProviderGitHub: NewGitHubSource(clients)},
+		filter:   filter,
+		metrics:  newScanMetrics(),
+	}
+
+	// Set up the GitLab source if any group is configured
+	if len(cfg.GitLabGroups) > 0 {
+		gitlabSource, err := NewGitLabSource(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create GitLab client: %w", err)
+		}
+		s.sources[config.ProviderGitLab] = gitlabSource
+	}
+	return s, nil
+}
+
+// setupStateStore creates the configured scan state store
+func (s *Scanner) setupStateStore(ctx context.Context) error {
+	switch s.config.StateBackend {
+	case config.StateBackendFile:
+		s.state = NewFileStateStore(s.config.StateFile)
+	case config.StateBackendKV:
+		js, err := jetstream.New(s.nc)
+		if err != nil {
+			return fmt.Errorf("failed to create JetStream context: %w", err)
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+
+		store, err := NewKVStateStore(ctx, js, s.config.StateBucket)
+		if err != nil {
+			return err
+		}
+		s.state = store
+	}
+	return nil
+}
+
+// setupLock creates the leader lock and starts campaigning for it
+func (s *Scanner) setupLock(ctx context.Context) error {
+	js, err := jetstream.New(s.nc)
+	if err != nil {
+		return fmt.Errorf("failed to create JetStream context: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	lock, err := NewLeaderLock(ctx, js, s.config.ScanLockBucket, lockHolder(), s.config.ScanLockTTL)
+	if err != nil {
+		return err
+	}
+	lock.Start()
+	s.lock = lock
+	return nil
+}
+
+// setupJetStream creates the JetStream context and makes sure a stream
+// exists for the configured subject
+func (s *Scanner) setupJetStream(ctx context.Context) error {
+	js, err := jetstream.New(s.nc)
+	if err != nil {
+		return fmt.Errorf("failed to create JetStream context: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	var subjects []string
+	for _, org := range s.config.Organizations() {
+		subjects = append(subjects, s.subjectFor(org))
+	}
+	if len(subjects) == 0 {
+		subjects = append(subjects, s.config.NATSSubject)
+	}
+
+	if _, err := EnsureStream(ctx, js, s.config.NATSStream, subjects, s.config.NATSDuplicateWindow); err != nil {
+		return err
+	}
+
+	s.js = js
+	return nil
 }
 
-// ScanRepositories fetches all repositories from the GitHub organization
+// EnsureStream creates or updates the JetStream stream that holds the
+// repository messages published on subjects and the events published on the
+// subjects below them
+func EnsureStream(ctx context.Context, js jetstream.JetStream, name string, subjects []string, duplicates time.Duration) (jetstream.Stream, error) {
+	var streamSubjects []string
+	seen := make(map[string]bool)
+	for _, subject := range subjects {
+		if seen[subject] {
+			continue
+		}
+		seen[subject] = true
+		streamSubjects = append(streamSubjects, subject, subject+".>")
+	}
+
+	stream, err := js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:       name,
+		Subjects:   streamSubjects,
+		Storage:    jetstream.FileStorage,
+		Duplicates: duplicates,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stream %s: %w", name, err)
+	}
+	return stream, nil
+}
+
+// ScanRepositories fetches all repositories from the configured organizations
+// and publishes every one of them
 func (s *Scanner) ScanRepositories(ctx context.Context) error {
-	log.Printf("Starting repository scan for organization: %s", s.config.GitHubOrg)
+	_, err := s.Scan(ctx, ScanOptions{Mode: ScanFull})
+	return err
+}
+
+// Scan fetches all repositories from the configured GitHub organizations and
+// GitLab groups and publishes them according to the scan mode. Organizations
+// are scanned one after the other; a failing organization does not stop the
+// others, and its error is returned together with those of any other failed
+// organization.
+// When a state store is configured, the state of every listed repository is
+// recorded after the scan.
+func (s *Scanner) Scan(ctx context.Context, opts ScanOptions) (*ScanResult, error) {
+	if opts.Mode == "" {
+		opts.Mode = ScanFull
+	}
+	if opts.Mode == ScanIncremental && s.state == nil {
+		return nil, fmt.Errorf("incremental scans require a state store")
+	}
 
-	opt := &github.RepositoryListByOrgOptions{
-		ListOptions: github.ListOptions{PerPage: 100},
+	orgs, err := s.Organizations(opts.Orgs)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.RunID == "" {
+		opts.RunID = newRunID(time.Now())
+	}
+
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "collector.Scan", trace.WithAttributes(
+		tracing.ScanMode.String(string(opts.Mode)),
+		tracing.RunID.String(opts.RunID),
+	))
+	startedAt := time.Now()
+	result := &ScanResult{Mode: opts.Mode, RunID: opts.RunID, FilteredBy: make(map[string]int)}
+	var errs []error
+	for _, org := range orgs {
+		if err := s.scanOrg(ctx, org, opts, result); err != nil {
+			slog.Error("Scan of organization failed", "provider", org.Provider, "org", org.Name,
+				"run_id", opts.RunID, "mode", opts.Mode, "error", err)
+			result.FailedOrgs = append(result.FailedOrgs, org.Name)
+			errs = append(errs, fmt.Errorf("organization %s: %w", org.Name, err))
+		}
 	}
 
-	var allRepos []*github.Repository
-	for {
-		repos, resp, err := s.ghClient.Repositories.ListByOrg(ctx, s.config.GitHubOrg, opt)
+	slog.Info("Processed repositories", "run_id", opts.RunID, "mode", opts.Mode, "listed", result.Listed,
+		"published", result.Published, "filtered", result.Filtered, "unchanged", result.Skipped,
+		"duplicates", result.Duplicates, "failed", result.Failed, "events", result.Events)
+	s.logRateLimits()
+	s.logCacheStats()
+	err = errors.Join(errs...)
+	s.metrics.observeScan(opts.Mode, time.Since(startedAt), err)
+	span.SetAttributes(attribute.Int("secflow.scan.published", result.Published))
+	tracing.End(span, err)
+	return result, err
+}
+
+// orgScan holds the progress of the scan of one organization
+type orgScan struct {
+	org       config.OrgConfig
+	opts      ScanOptions
+	src       Source
+	subject   string
+	startedAt time.Time
+	prev      *ScanState
+	// logger carries the organization and the run ID of the scan
+	logger *slog.Logger
+	// published holds the IDs of the repositories published by this run
+	published []int64
+	// listed holds the current state of every repository listed so far, and
+	// next the state to record for it
+	listed map[int64]RepoState
+	next   *ScanState
+	// lifecycle is set when lifecycle events are emitted, which needs the
+	// inventory of an earlier scan
+	lifecycle bool
+	filtered  map[string]int
+	// done is the page up to which every page was processed, and completed
+	// holds the pages processed beyond it
+	done      int
+	completed map[int]bool
+}
+
+// Organizations returns the configured organizations with the given names,
+// or all of them when names is empty. A name is either the bare name or
+// provider/name, to tell a GitLab group from a GitHub organization of the
+// same name.
+func (s *Scanner) Organizations(names []string) ([]config.OrgConfig, error) {
+	all := s.config.Organizations()
+	if len(names) == 0 {
+		return all, nil
+	}
+
+	var orgs []config.OrgConfig
+	for _, name := range names {
+		found := false
+		for _, org := range all {
+			if name == org.Name || name == org.Provider+"/"+org.Name {
+				orgs = append(orgs, org)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownOrg, name)
+		}
+	}
+	return orgs, nil
+}
+
+// PublishRepository looks up a single repository of an organization and
+// publishes it outside of a scan, for example after its configuration was
+// fixed. It is published even if a scan published it recently, unless a
+// filter rule excludes it. The scan state is not updated.
+func (s *Scanner) PublishRepository(ctx context.Context, org, name string) (*Repository, error) {
+	orgs, err := s.Organizations([]string{org})
+	if err != nil {
+		return nil, err
+	}
+	o := orgs[0]
+
+	src, ok := s.sources[o.Provider]
+	if !ok {
+		return nil, fmt.Errorf("no source for provider %q", o.Provider)
+	}
+	repo, err := src.GetRepository(ctx, o.Name, name)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if rule := s.filter.Match(*repo, now); rule != "" {
+		return nil, fmt.Errorf("%w %s: %s", ErrRepoFiltered, rule, repo.FullName)
+	}
+
+	// A message ID of its own, so JetStream does not discard it as a
+	// duplicate of the last scan
+	run := newRunID(now)
+	msgID := messageKey(repo.Provider, repo.ID) + "-" + run
+	if _, err := s.publishRepository(ctx, s.subjectFor(o), *repo, msgID, run); err != nil {
+		s.metrics.publishErrors.WithLabelValues(o.Provider, o.Name).Inc()
+		return nil, err
+	}
+	s.metrics.published.WithLabelValues(o.Provider, o.Name).Inc()
+	return repo, nil
+}
+
+// clone returns a copy of the result that does not share its maps and slices
+func (r *ScanResult) clone() ScanResult {
+	c := *r
+	c.FilteredBy = make(map[string]int, len(r.FilteredBy))
+	for rule, n := range r.FilteredBy {
+		c.FilteredBy[rule] = n
+	}
+	c.FailedOrgs = append([]string(nil), r.FailedOrgs...)
+	return c
+}
+
+// scanOrg scans a single organization and adds its counts to result. Pages
+// are published as soon as they are fetched, and with a state store the
+// progress is checkpointed after each page so that a failed scan resumes
+// where it stopped. Scan events are published before and after the scan.
+func (s *Scanner) scanOrg(ctx context.Context, org config.OrgConfig, opts ScanOptions, result *ScanResult) (err error) {
+	logger := slog.With("provider", org.Provider, "org", org.Name, "run_id", opts.RunID)
+	logger.Info("Starting repository scan", "mode", opts.Mode)
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "collector.ScanOrganization", trace.WithAttributes(
+		tracing.Provider.String(org.Provider),
+		tracing.Org.String(org.Name),
+	))
+
+	started := ScanEvent{
+		Type:      ScanStarted,
+		RunID:     opts.RunID,
+		Mode:      opts.Mode,
+		Org:       org.Name,
+		Provider:  org.Provider,
+		StartedAt: time.Now(),
+	}
+	if !opts.SkipScanEvents {
+		s.publishScanEvent(ctx, org, started)
+	}
+	before := result.clone()
+	var scan *orgScan
+	defer func() {
+		var published []int64
+		if scan != nil {
+			published = scan.published
+		}
+		completed := newScanCompleted(started, &before, result, published, err)
+		s.metrics.observeOrg(org, completed)
+		if !opts.SkipScanEvents {
+			s.publishScanEvent(ctx, org, completed)
+		}
+		span.SetAttributes(attribute.Int("secflow.scan.published", completed.Published))
+		tracing.End(span, err)
+	}()
+
+	src, ok := s.sources[org.Provider]
+	if !ok {
+		return fmt.Errorf("no source for provider %q", org.Provider)
+	}
+
+	// Load the state of the previous scan
+	prev := NewScanState()
+	if s.state != nil {
+		st, err := s.state.Load(ctx, stateKey(org))
 		if err != nil {
-			return fmt.Errorf("failed to list repositories: %w", err)
+			return fmt.Errorf("failed to load scan state: %w", err)
 		}
+		prev = st
+	}
 
-		allRepos = append(allRepos, repos...)
+	scan = &orgScan{
+		org:       org,
+		opts:      opts,
+		src:       src,
+		subject:   s.subjectFor(org),
+		startedAt: time.Now(),
+		prev:      prev,
+		logger:    logger,
+		listed:    make(map[int64]RepoState),
+		next:      NewScanState(),
+		lifecycle: s.state != nil && !prev.LastScanAt.IsZero(),
+		filtered:  make(map[string]int),
+		completed: make(map[int]bool),
+	}
+
+	start := 1
+	if cp := prev.Checkpoint; cp != nil {
+		if cp.Mode == opts.Mode && time.Since(cp.StartedAt) <= s.config.ScanCheckpointMaxAge {
+			// Fetch the last checkpointed page again, in case deletions
+			// since the failure moved repositories onto it
+			start = max(cp.Page, 1)
+			scan.done = start - 1
+			scan.startedAt = cp.StartedAt
+			scan.listed = cp.Listed
+			scan.next.Repos = cp.Next
+			logger.Info("Resuming unfinished scan", "mode", opts.Mode,
+				"started_at", cp.StartedAt.Format(time.RFC3339), "page", start)
+		} else {
+			logger.Info("Discarding unfinished scan", "mode", cp.Mode)
+		}
+	}
+	concurrency := max(s.config.ScanPageConcurrency, 1)
+	pages := make(chan *Page, concurrency)
+	fetchErr := make(chan error, 1)
+	go func() {
+		fetchErr <- fetchPages(ctx, src, org.Name, start, concurrency, pages)
+	}()
 
-		if resp.NextPage == 0 {
-			break
+	for page := range pages {
+		s.processPage(ctx, scan, page, result)
+		if opts.Progress != nil {
+			opts.Progress(result.clone())
 		}
-		opt.Page = resp.NextPage
 	}
+	if err := <-fetchErr; err != nil {
+		return err
+	}
+
+	logger.Info("Listed repositories", "listed", len(scan.listed))
+	s.logFiltered(scan, result)
 
-	log.Printf("Found %d repositories", len(allRepos))
+	// Repositories that are no longer listed were deleted or transferred
+	if scan.lifecycle {
+		for _, event := range deletedRepos(org.Name, prev.Repos, scan.listed, scan.startedAt) {
+			reason, fullName, gone := s.deletionReason(ctx, src, org.Name, event.RepoID)
+			if !gone {
+				logger.Debug("Repository still in the organization was not listed", "repo", event.Name)
+				// Keep the previous inventory entry, as the repository was
+				// neither deleted nor processed by this scan
+				scan.next.Repos[event.RepoID] = prev.Repos[event.RepoID]
+				continue
+			}
+			event.Reason, event.NewFullName = reason, fullName
+			version := stateVersion(prev.Repos[event.RepoID])
+			if err := s.publishLifecycleEvent(ctx, scan.subject, org.Provider, event, version, opts.RunID); err != nil {
+				logger.Warn("Failed to publish lifecycle event", "event", event.Type, "repo", event.Name, "error", err)
+				result.Failed++
+				// Keep the previous inventory entry so the next scan emits it again
+				scan.next.Repos[event.RepoID] = prev.Repos[event.RepoID]
+				continue
+			}
+			result.Events++
+		}
+	}
 
-	// Process and publish each repository
-	for _, repo := range allRepos {
-		if err := s.publishRepository(repo); err != nil {
-			log.Printf("Failed to publish repository %s: %v", repo.GetName(), err)
-			// Continue processing other repositories
+	// Record the state of this scan
+	if s.state != nil {
+		next := scan.next
+		next.LastScanAt = scan.startedAt
+		next.LastFullScanAt = prev.LastFullScanAt
+		if opts.Mode == ScanFull {
+			next.LastFullScanAt = scan.startedAt
+		}
+		if err := s.state.Save(ctx, stateKey(org), next); err != nil {
+			return fmt.Errorf("failed to save scan state: %w", err)
 		}
 	}
 
-	log.Printf("Successfully processed %d repositories", len(allRepos))
 	return nil
 }
 
-// publishRepository publishes a repository to the NATS queue
-func (s *Scanner) publishRepository(repo *github.Repository) error {
-	// Convert GitHub repository to our Repository struct
-	r := Repository{
-		Name:      repo.GetName(),
-		CloneURL:  repo.GetCloneURL(),
-		SSHURL:    repo.GetSSHURL(),
-		HTTPSURL:  repo.GetCloneURL(),
-		CreatedAt: repo.GetCreatedAt().Time,
-		UpdatedAt: repo.GetUpdatedAt().Time,
-		Language:  repo.GetLanguage(),
-		Topics:    repo.Topics,
+// processPage filters and publishes the repositories of a page, emits their
+// lifecycle events and checkpoints the scan
+func (s *Scanner) processPage(ctx context.Context, scan *orgScan, page *Page, result *ScanResult) {
+	prev, next := scan.prev, scan.next
+	for _, repo := range page.Repos {
+		id := repo.ID
+		// Repositories seen on an earlier page were moved by a deletion,
+		// or were processed before the scan was resumed
+		if _, seen := scan.listed[id]; seen {
+			continue
+		}
+
+		current := RepoState{
+			Name:      repo.Name,
+			PushedAt:  repo.PushedAt,
+			UpdatedAt: repo.UpdatedAt,
+			Archived:  repo.Archived,
+		}
+		scan.listed[id] = current
+		result.Listed++
+
+		// Filtered repositories stay in the inventory so lifecycle events
+		// are still emitted for them, but are never published. They are
+		// marked so incremental scans publish them once the filters let
+		// them through.
+		switch rule := s.filter.Match(repo, scan.startedAt); {
+		case rule != "":
+			filtered := current
+			filtered.Filtered = true
+			next.Repos[id] = filtered
+			scan.filtered[rule]++
+		case scan.opts.Mode == ScanIncremental && !prev.Changed(id, current.PushedAt, current.UpdatedAt):
+			next.Repos[id] = current
+			result.Skipped++
+		default:
+			duplicate, err := s.publishRepository(ctx, scan.subject, repo, repoMessageID(repo), scan.opts.RunID)
+			if err != nil {
+				scan.logger.Warn("Failed to publish repository", "repo", repo.FullName, "subject", scan.subject, "error", err)
+				result.Failed++
+				// Keep the previous state so the next incremental scan retries it
+				if old, ok := prev.Repos[id]; ok {
+					next.Repos[id] = old
+				}
+				break
+			}
+			next.Repos[id] = current
+			// The stored message carries the run ID of an earlier run, so
+			// it is not counted as published by this one
+			if duplicate {
+				result.Duplicates++
+				if scan.opts.Duplicate != nil {
+					scan.opts.Duplicate(scan.subject, repo)
+				}
+				break
+			}
+			scan.published = append(scan.published, id)
+			result.Published++
+			if scan.opts.Published != nil {
+				scan.opts.Published(scan.subject, repo)
+			}
+		}
+
+		if !scan.lifecycle {
+			continue
+		}
+		old, known := prev.Repos[id]
+		for _, event := range diffRepo(scan.org.Name, id, old, known, current, scan.startedAt) {
+			event.Repository = &repo
+			if err := s.publishLifecycleEvent(ctx, scan.subject, scan.org.Provider, event, stateVersion(current), scan.opts.RunID); err != nil {
+				scan.logger.Warn("Failed to publish lifecycle event", "event", event.Type, "repo", event.Name, "error", err)
+				result.Failed++
+				// Keep the previous inventory entry so the next scan emits it again
+				if known {
+					next.Repos[id] = old
+				} else {
+					delete(next.Repos, id)
+				}
+				continue
+			}
+			result.Events++
+		}
 	}
 
+	s.checkpoint(ctx, scan, page.Number)
+}
+
+// checkpoint marks a page as processed and, once every page up to it has
+// been processed, saves the progress of the scan
+func (s *Scanner) checkpoint(ctx context.Context, scan *orgScan, page int) {
+	scan.completed[page] = true
+	advanced := false
+	for scan.completed[scan.done+1] {
+		delete(scan.completed, scan.done+1)
+		scan.done++
+		advanced = true
+	}
+	if !advanced || s.state == nil {
+		return
+	}
+
+	// The previous inventory is kept until the scan completes
+	cp := &ScanCheckpoint{
+		StartedAt: scan.startedAt,
+		Mode:      scan.opts.Mode,
+		Page:      scan.done,
+		Listed:    scan.listed,
+		Next:      scan.next.Repos,
+	}
+	if err := s.state.SaveCheckpoint(ctx, stateKey(scan.org), cp); err != nil {
+		scan.logger.Warn("Failed to checkpoint scan", "page", scan.done, "error", err)
+	}
+}
+
+// subjectFor returns the subject an organization's repositories are
+// published on
+func (s *Scanner) subjectFor(org config.OrgConfig) string {
+	if org.Subject != "" {
+		return org.Subject
+	}
+	return s.config.NATSSubject
+}
+
+// logRateLimits logs the remaining GitHub API quota of each client
+func (s *Scanner) logRateLimits() {
+	for _, stats := range s.clients.RateLimits() {
+		if len(stats.Quotas) == 0 {
+			continue
+		}
+		quotas := make([]any, 0, len(stats.Quotas))
+		for _, q := range stats.Quotas {
+			quotas = append(quotas, slog.Group(q.Resource, "remaining", q.Remaining, "limit", q.Limit, "reset", q.Reset.Format(time.RFC3339)))
+		}
+		slog.Info("GitHub API quota", "client", stats.Client, slog.Group("quota", quotas...),
+			"rate_limited", stats.PrimaryLimited+stats.SecondaryLimited, "waits", stats.Waits, "wait_time", stats.WaitTime.String())
+	}
+}
+
+// logCacheStats logs the hit and miss counts of the GitHub response cache
+func (s *Scanner) logCacheStats() {
+	if stats, ok := s.clients.CacheStats(); ok {
+		slog.Info("GitHub response cache", "hits", stats.Hits, "misses", stats.Misses,
+			"evictions", stats.Evictions, "entries", stats.Entries, "size_bytes", stats.SizeBytes)
+	}
+}
+
+// logFiltered logs how many repositories of an organization each filter rule
+// dropped and adds the counts to result
+func (s *Scanner) logFiltered(scan *orgScan, result *ScanResult) {
+	total := 0
+	var counts []any
+	for _, rule := range s.filter.Rules() {
+		if n := scan.filtered[rule]; n > 0 {
+			total += n
+			result.FilteredBy[rule] += n
+			s.metrics.filtered.WithLabelValues(scan.org.Provider, scan.org.Name, rule).Add(float64(n))
+			counts = append(counts, slog.Int(rule, n))
+		}
+	}
+	if total == 0 {
+		return
+	}
+
+	result.Filtered += total
+	scan.logger.Info("Filtered repositories", "filtered", total, slog.Group("rules", counts...))
+}
+
+// stateKey returns the key an organization's scan state is stored under.
+// GitHub organizations keep their bare name; other providers are prefixed so
+// a GitLab group never shares state with a GitHub organization of the same
+// name.
+func stateKey(org config.OrgConfig) string {
+	if org.Provider == "" || org.Provider == config.ProviderGitHub {
+		return org.Name
+	}
+	return org.Provider + "/" + org.Name
+}
+
+// messageKey identifies a repository in message IDs. GitHub repositories use
+// their bare ID; other providers are prefixed so IDs never collide.
+func messageKey(provider string, id int64) string {
+	key := strconv.FormatInt(id, 10)
+	if provider == "" || provider == config.ProviderGitHub {
+		return key
+	}
+	return provider + "-" + key
+}
+
+// stateVersion identifies the version of a repository for message
+// de-duplication. It changes whenever the repository is pushed to or
+// updated, and only then.
+func stateVersion(st RepoState) string {
+	return st.PushedAt.UTC().Format("20060102T150405Z") + "-" + st.UpdatedAt.UTC().Format("20060102T150405Z")
+}
+
+// repoMessageID returns the message ID a scan publishes a repository with.
+// It is derived from the repository's content rather than from the scan, so
+// a scan re-run inside the duplicate window, whenever it starts, does not
+// publish an unchanged repository twice, while a changed one is published
+// again.
+func repoMessageID(r Repository) string {
+	return messageKey(r.Provider, r.ID) + "-" + stateVersion(RepoState{PushedAt: r.PushedAt, UpdatedAt: r.UpdatedAt})
+}
+
+// publishRepository publishes a repository to the NATS queue, stamped with
+// the run ID. It reports whether JetStream discarded the message as a
+// duplicate.
+func (s *Scanner) publishRepository(ctx context.Context, subject string, r Repository, msgID, runID string) (duplicate bool, err error) {
+	// Every repository starts a trace of its own, which the validator and
+	// the downstream scanners continue, linked to the span of the scan
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "publish "+subject,
+		trace.WithNewRoot(),
+		trace.WithLinks(trace.LinkFromContext(ctx)),
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			tracing.MessagingSystem,
+			tracing.MessagingDestination.String(subject),
+			tracing.Provider.String(r.Provider),
+			tracing.Repository.String(r.FullName),
+			tracing.RepositoryID.Int64(r.ID),
+			tracing.RunID.String(runID),
+		))
+	defer func() { tracing.End(span, err) }()
+
 	// Serialize to JSON
 	data, err := json.Marshal(r)
 	if err != nil {
-		return fmt.Errorf("failed to marshal repository: %w", err)
+		return false, fmt.Errorf("failed to marshal repository: %w", err)
 	}
 
-	// Publish to NATS
-	if err := s.nc.Publish(s.config.NATSSubject, data); err != nil {
-		return fmt.Errorf("failed to publish to NATS: %w", err)
+	duplicate, err = s.publish(ctx, subject, data, msgID, runID)
+	if err != nil {
+		return false, err
+	}
+	if duplicate {
+		span.SetAttributes(attribute.Bool("secflow.duplicate", true))
+		slog.Debug("Skipped duplicate repository", "repo", r.FullName, "run_id", runID, "subject", subject)
+		return true, nil
 	}
 
-	log.Printf("Published repository: %s", r.Name)
-	return nil
+	slog.Debug("Published repository", "repo", r.FullName, "run_id", runID, "subject", subject)
+	return false, nil
+}
+
+// publish publishes data to subject with the run ID header and the trace
+// context of ctx. With JetStream
+// enabled it waits for the ack and reports whether the stream discarded the
+// message as a duplicate of an earlier message with the same ID.
+func (s *Scanner) publish(ctx context.Context, subject string, data []byte, msgID, runID string) (bool, error) {
+	// A dry-run scanner has no connection
+	if s.nc == nil {
+		return false, nil
+	}
+
+	msg := nats.NewMsg(subject)
+	msg.Data = data
+	msg.Header.Set(HeaderRunID, runID)
+	tracing.Inject(ctx, msg)
+
+	if s.js != nil {
+		ack, err := s.js.PublishMsg(ctx, msg, jetstream.WithMsgID(msgID))
+		if err != nil {
+			return false, fmt.Errorf("failed to publish to JetStream: %w", err)
+		}
+		return ack.Duplicate, nil
+	}
+
+	if err := s.nc.PublishMsg(msg); err != nil {
+		return false, fmt.Errorf("failed to publish to NATS: %w", err)
+	}
+	return false, nil
 }
 
 // Close cleanly shuts down the scanner
 func (s *Scanner) Close() {
+	if s.lock != nil {
+		s.lock.Close()
+	}
 	if s.nc != nil {
 		s.nc.Close()
 	}
-}
\ No newline at end of file
+}
@@ -7,14 +7,22 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"reflect"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/google/go-github/v57/github"
 	"github.com/klimeurt/secflow-collector/internal/config"
+	"github.com/klimeurt/secflow-collector/internal/tracing"
 	natsserver "github.com/nats-io/nats-server/v2/server"
 	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func TestScannerCreation(t *testing.T) {
@@ -134,7 +142,8 @@ func TestScannerPublishRepository(t *testing.T) {
 		"git@github.com:org/test-repo.git", createdAt, updatedAt, "Go", []string{"microservice"})
 
 	// Publish repository
-	err = scanner.publishRepository(githubRepo)
+	repo := newRepository(config.GitHubOrg, githubRepo)
+	_, err = scanner.publishRepository(context.Background(), config.NATSSubject, repo, repoMessageID(repo), "run-1")
 	if err != nil {
 		t.Fatalf("Failed to publish repository: %v", err)
 	}
@@ -157,6 +166,12 @@ func TestScannerPublishRepository(t *testing.T) {
 		if len(repo.Topics) != 1 || repo.Topics[0] != "microservice" {
 			t.Errorf("Repository topics = %v, want %v", repo.Topics, []string{"microservice"})
 		}
+		if repo.Org != "testorg" {
+			t.Errorf("Repository org = %v, want %v", repo.Org, "testorg")
+		}
+		if runID := msg.Header.Get(HeaderRunID); runID != "run-1" {
+			t.Errorf("%s header = %q, want %q", HeaderRunID, runID, "run-1")
+		}
 
 	case <-time.After(5 * time.Second):
 		t.Fatal("Timeout waiting for published message")
@@ -206,14 +221,14 @@ func TestScanRepositoriesPagination(t *testing.T) {
 		if page == "" || page == "1" {
 			// First page
 			repos = []map[string]interface{}{
-				createMockRepoJSON("repo1"),
-				createMockRepoJSON("repo2"),
+				createMockRepoJSON(1, "repo1"),
+				createMockRepoJSON(2, "repo2"),
 			}
 			w.Header().Set("Link", fmt.Sprintf(`<%s/orgs/testorg/repos?page=2>; rel="next"`, server.URL))
 		} else if page == "2" {
 			// Second page
 			repos = []map[string]interface{}{
-				createMockRepoJSON("repo3"),
+				createMockRepoJSON(3, "repo3"),
 			}
 		}
 
@@ -335,6 +350,440 @@ func TestScanRepositoriesError(t *testing.T) {
 	}
 }
 
+func TestScanRepositoriesJetStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		repos := []map[string]interface{}{
+			createMockRepoJSON(1, "repo1"),
+			createMockRepoJSON(2, "repo2"),
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(repos)
+	}))
+	defer server.Close()
+
+	natsServer := runMockJetStreamServer(t)
+	defer natsServer.Shutdown()
+
+	config := &config.Config{
+		GitHubOrg:           "testorg",
+		GitHubToken:         "token123",
+		NATSUrl:             natsServer.ClientURL(),
+		NATSSubject:         "github.repositories",
+		NATSJetStream:       true,
+		NATSStream:          "GITHUB_REPOSITORIES",
+		NATSDuplicateWindow: time.Hour,
+		CronSchedule:        "0 0 * * 0",
+	}
+
+	scanner, err := New(config)
+	if err != nil {
+		t.Fatalf("Failed to create scanner: %v", err)
+	}
+	defer scanner.Close()
+
+	scanner.ghClient.BaseURL = mustParseURL(server.URL + "/")
+
+	// Scan twice inside the duplicate window
+	ctx := context.Background()
+	if err := scanner.ScanRepositories(ctx); err != nil {
+		t.Fatalf("Failed to scan repositories: %v", err)
+	}
+	var duplicates []string
+	result, err := scanner.Scan(ctx, ScanOptions{
+		Mode: ScanFull,
+		Duplicate: func(subject string, repo Repository) {
+			duplicates = append(duplicates, subject+" "+repo.Name)
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to scan repositories: %v", err)
+	}
+	// The re-scan published nothing under its own run ID
+	if result.Published != 0 || result.Duplicates != 2 {
+		t.Errorf("Re-scan published %d and de-duplicated %d repos, want 0 and 2", result.Published, result.Duplicates)
+	}
+	if got := strings.Join(duplicates, ","); got != "github.repositories repo1,github.repositories repo2" {
+		t.Errorf("Duplicate called with %q, want both repositories", got)
+	}
+
+	stream, err := scanner.js.Stream(ctx, config.NATSStream)
+	if err != nil {
+		t.Fatalf("Failed to look up stream: %v", err)
+	}
+	info, err := stream.Info(ctx, jetstream.WithSubjectFilter(">"))
+	if err != nil {
+		t.Fatalf("Failed to get stream info: %v", err)
+	}
+
+	if info.Config.Duplicates != time.Hour {
+		t.Errorf("Stream duplicate window = %v, want %v", info.Config.Duplicates, time.Hour)
+	}
+	if got := info.State.Subjects[config.NATSSubject]; got != 2 {
+		t.Errorf("Stream repository messages = %d, want 2 (re-scan should be de-duplicated)", got)
+	}
+	// Every run reports its start and end
+	for _, eventType := range []ScanEventType{ScanStarted, ScanCompleted} {
+		if got := info.State.Subjects[ScanEventSubject(config.NATSSubject, eventType)]; got != 2 {
+			t.Errorf("Stream scan %s events = %d, want 2", eventType, got)
+		}
+	}
+
+	// and does not list the de-duplicated repositories as its own
+	completedMsg, err := stream.GetLastMsgForSubject(ctx, ScanEventSubject(config.NATSSubject, ScanCompleted))
+	if err != nil {
+		t.Fatalf("Failed to get scan event: %v", err)
+	}
+	var completed ScanEvent
+	if err := json.Unmarshal(completedMsg.Data, &completed); err != nil {
+		t.Fatalf("Failed to unmarshal scan event: %v", err)
+	}
+	if completed.Published != 0 || completed.Duplicates != 2 || len(completed.RepoIDs) != 0 {
+		t.Errorf("Re-scan completed event published %d, duplicates %d, repo IDs %v, want 0, 2 and none",
+			completed.Published, completed.Duplicates, completed.RepoIDs)
+	}
+
+	msg, err := stream.GetLastMsgForSubject(ctx, config.NATSSubject)
+	if err != nil {
+		t.Fatalf("Failed to get message: %v", err)
+	}
+	wantID := "2-20231201T000000Z-20231201T000000Z"
+	if got := msg.Header.Get(jetstream.MsgIDHeader); got != wantID {
+		t.Errorf("Nats-Msg-Id = %q, want %q", got, wantID)
+	}
+}
+
+func TestScanIncremental(t *testing.T) {
+	repos := []map[string]interface{}{
+		createMockRepoJSON(1, "repo1"),
+		createMockRepoJSON(2, "repo2"),
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(repos)
+	}))
+	defer server.Close()
+
+	natsServer := runMockNATSServer()
+	defer natsServer.Shutdown()
+
+	config := &config.Config{
+		GitHubOrg:    "testorg",
+		GitHubToken:  "token123",
+		NATSUrl:      natsServer.ClientURL(),
+		NATSSubject:  "github.repositories",
+		CronSchedule: "0 0 * * 0",
+		StateBackend: "file",
+		StateFile:    t.TempDir() + "/state.json",
+	}
+
+	scanner, err := New(config)
+	if err != nil {
+		t.Fatalf("Failed to create scanner: %v", err)
+	}
+	defer scanner.Close()
+
+	scanner.ghClient.BaseURL = mustParseURL(server.URL + "/")
+
+	ctx := context.Background()
+	incremental := ScanOptions{Mode: ScanIncremental}
+
+	// The first incremental scan publishes everything
+	result, err := scanner.Scan(ctx, incremental)
+	if err != nil {
+		t.Fatalf("Scan() unexpected error: %v", err)
+	}
+	if result.Published != 2 {
+		t.Errorf("First scan published %d repos, want 2", result.Published)
+	}
+
+	// Nothing changed since the last scan
+	result, err = scanner.Scan(ctx, incremental)
+	if err != nil {
+		t.Fatalf("Scan() unexpected error: %v", err)
+	}
+	if result.Published != 0 || result.Skipped != 2 {
+		t.Errorf("Unchanged scan published %d and skipped %d repos, want 0 and 2", result.Published, result.Skipped)
+	}
+
+	// A push to repo2 and a new repo3
+	repos[1]["pushed_at"] = "2023-12-05T00:00:00Z"
+	repos = append(repos, createMockRepoJSON(3, "repo3"))
+
+	result, err = scanner.Scan(ctx, incremental)
+	if err != nil {
+		t.Fatalf("Scan() unexpected error: %v", err)
+	}
+	if result.Published != 2 || result.Skipped != 1 {
+		t.Errorf("Changed scan published %d and skipped %d repos, want 2 and 1", result.Published, result.Skipped)
+	}
+
+	// Full scans still publish everything
+	result, err = scanner.Scan(ctx, ScanOptions{Mode: ScanFull})
+	if err != nil {
+		t.Fatalf("Scan() unexpected error: %v", err)
+	}
+	if result.Published != 3 {
+		t.Errorf("Full scan published %d repos, want 3", result.Published)
+	}
+}
+
+func TestScanIncrementalRequiresState(t *testing.T) {
+	natsServer := runMockNATSServer()
+	defer natsServer.Shutdown()
+
+	scanner, err := New(&config.Config{
+		GitHubOrg:   "testorg",
+		GitHubToken: "token123",
+		NATSUrl:     natsServer.ClientURL(),
+		NATSSubject: "github.repositories",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create scanner: %v", err)
+	}
+	defer scanner.Close()
+
+	if _, err := scanner.Scan(context.Background(), ScanOptions{Mode: ScanIncremental}); err == nil {
+		t.Error("Scan() expected error without a state store, got nil")
+	}
+}
+
+func TestScanMultipleOrgs(t *testing.T) {
+	var org2Auth atomic.Value
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/orgs/org1/repos":
+			_ = json.NewEncoder(w).Encode([]map[string]interface{}{createMockRepoJSON(1, "repo1")})
+		case "/orgs/org2/repos":
+			org2Auth.Store(r.Header.Get("Authorization"))
+			_ = json.NewEncoder(w).Encode([]map[string]interface{}{createMockRepoJSON(2, "repo2")})
+		default:
+			w.WriteHeader(http.StatusForbidden)
+			_ = json.NewEncoder(w).Encode(map[string]string{"message": "Resource not accessible by integration"})
+		}
+	}))
+	defer server.Close()
+
+	natsServer := runMockNATSServer()
+	defer natsServer.Shutdown()
+
+	config := &config.Config{
+		GitHubOrg:   "org1",
+		GitHubToken: "token123",
+		GitHubOrgs: []config.OrgConfig{
+			{Name: "org1"},
+			{Name: "forbidden"},
+			{Name: "org2", Token: "org2-token", Subject: "org2.repositories"},
+		},
+		NATSUrl:     natsServer.ClientURL(),
+		NATSSubject: "github.repositories",
+	}
+
+	scanner, err := New(config)
+	if err != nil {
+		t.Fatalf("Failed to create scanner: %v", err)
+	}
+	defer scanner.Close()
+
+	scanner.ghClient.BaseURL = mustParseURL(server.URL + "/")
+	org2Client, err := scanner.clients.ForOrg(context.Background(), "org2")
+	if err != nil {
+		t.Fatalf("Failed to create client for org2: %v", err)
+	}
+	org2Client.BaseURL = mustParseURL(server.URL + "/")
+
+	messages := make(chan *nats.Msg, 10)
+	sub, err := scanner.nc.ChanSubscribe(">", messages)
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+	defer func() { _ = sub.Unsubscribe() }()
+
+	result, err := scanner.Scan(context.Background(), ScanOptions{Mode: ScanFull})
+	if err == nil || !strings.Contains(err.Error(), "organization forbidden") {
+		t.Errorf("Scan() error = %v, want error for organization forbidden", err)
+	}
+	if len(result.FailedOrgs) != 1 || result.FailedOrgs[0] != "forbidden" {
+		t.Errorf("FailedOrgs = %v, want [forbidden]", result.FailedOrgs)
+	}
+	if result.Published != 2 {
+		t.Errorf("Published = %d, want 2", result.Published)
+	}
+
+	received := make(map[string]string)
+	timeout := time.After(5 * time.Second)
+	for len(received) < 2 {
+		select {
+		case msg := <-messages:
+			if strings.Contains(msg.Subject, ".scan.") {
+				continue
+			}
+			var repo Repository
+			if err := json.Unmarshal(msg.Data, &repo); err != nil {
+				t.Fatalf("Failed to unmarshal message: %v", err)
+			}
+			received[repo.Org] = msg.Subject
+		case <-timeout:
+			t.Fatalf("Timeout waiting for messages, got %v", received)
+		}
+	}
+
+	if received["org1"] != "github.repositories" {
+		t.Errorf("org1 subject = %q, want %q", received["org1"], "github.repositories")
+	}
+	if received["org2"] != "org2.repositories" {
+		t.Errorf("org2 subject = %q, want %q", received["org2"], "org2.repositories")
+	}
+	if got, _ := org2Auth.Load().(string); got != "Bearer org2-token" {
+		t.Errorf("org2 Authorization = %q, want %q", got, "Bearer org2-token")
+	}
+}
+
+func TestScanEnterprise(t *testing.T) {
+	// Stand-in for a GitHub Enterprise Server instance, which serves the API
+	// under /api/v3/
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path != "/api/v3/orgs/platform/repos" {
+			w.WriteHeader(http.StatusNotFound)
+			_ = json.NewEncoder(w).Encode(map[string]string{"message": "Not Found"})
+			return
+		}
+		repo := createMockRepoJSON(1, "service")
+		repo["clone_url"] = "https://ghes.example.com/platform/service.git"
+		_ = json.NewEncoder(w).Encode([]map[string]interface{}{repo})
+	}))
+	defer server.Close()
+
+	natsServer := runMockNATSServer()
+	defer natsServer.Shutdown()
+
+	config := &config.Config{
+		GitHubOrg:    "platform",
+		GitHubToken:  "token123",
+		GitHubAPIURL: server.URL,
+		NATSUrl:      natsServer.ClientURL(),
+		NATSSubject:  "github.repositories",
+	}
+
+	scanner, err := New(config)
+	if err != nil {
+		t.Fatalf("Failed to create scanner: %v", err)
+	}
+	defer scanner.Close()
+
+	messages := make(chan *nats.Msg, 10)
+	sub, err := scanner.nc.ChanSubscribe(config.NATSSubject, messages)
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+	defer func() { _ = sub.Unsubscribe() }()
+
+	if err := scanner.ScanRepositories(context.Background()); err != nil {
+		t.Fatalf("ScanRepositories() unexpected error: %v", err)
+	}
+
+	select {
+	case msg := <-messages:
+		var repo Repository
+		if err := json.Unmarshal(msg.Data, &repo); err != nil {
+			t.Fatalf("Failed to unmarshal message: %v", err)
+		}
+		if repo.CloneURL != "https://ghes.example.com/platform/service.git" {
+			t.Errorf("CloneURL = %v, want %v", repo.CloneURL, "https://ghes.example.com/platform/service.git")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timeout waiting for message")
+	}
+}
+
+func TestNewRepository(t *testing.T) {
+	pushedAt := time.Date(2023, 12, 2, 0, 0, 0, 0, time.UTC)
+	repo := createMockGitHubRepo("test-repo", "https://github.com/org/test-repo.git",
+		"git@github.com:org/test-repo.git", time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2023, 12, 1, 0, 0, 0, 0, time.UTC), "Go", []string{"microservice"})
+	repo.ID = github.Int64(42)
+	repo.FullName = github.String("org/test-repo")
+	repo.Owner = &github.User{Login: github.String("org")}
+	repo.HTMLURL = github.String("https://github.com/org/test-repo")
+	repo.DefaultBranch = github.String("main")
+	repo.Visibility = github.String("internal")
+	repo.Private = github.Bool(true)
+	repo.Fork = github.Bool(true)
+	repo.Size = github.Int(1234)
+	repo.PushedAt = &github.Timestamp{Time: pushedAt}
+	repo.License = &github.License{SPDXID: github.String("MIT")}
+
+	r := newRepository("org", repo)
+
+	want := Repository{
+		ID:            42,
+		Name:          "test-repo",
+		FullName:      "org/test-repo",
+		Owner:         "org",
+		CloneURL:      "https://github.com/org/test-repo.git",
+		SSHURL:        "git@github.com:org/test-repo.git",
+		HTTPSURL:      "https://github.com/org/test-repo",
+		HTMLURL:       "https://github.com/org/test-repo",
+		DefaultBranch: "main",
+		Visibility:    "internal",
+		Private:       true,
+		Fork:          true,
+		Size:          1234,
+		CreatedAt:     repo.GetCreatedAt().Time,
+		UpdatedAt:     repo.GetUpdatedAt().Time,
+		PushedAt:      pushedAt,
+		Language:      "Go",
+		Topics:        []string{"microservice"},
+		License:       "MIT",
+		Org:           "org",
+		Provider:      "github",
+	}
+	if !reflect.DeepEqual(r, want) {
+		t.Errorf("newRepository() = %+v, want %+v", r, want)
+	}
+
+	// The HTTPS URL falls back to the clone URL without .git
+	repo.HTMLURL = nil
+	if got := newRepository("org", repo).HTTPSURL; got != "https://github.com/org/test-repo" {
+		t.Errorf("HTTPSURL = %v, want %v", got, "https://github.com/org/test-repo")
+	}
+
+	// Messages published before the new fields existed still decode
+	old := `{"name":"test-repo","clone_url":"https://github.com/org/test-repo.git","ssh_url":"git@github.com:org/test-repo.git","https_url":"https://github.com/org/test-repo.git","created_at":"2023-01-01T00:00:00Z","updated_at":"2023-12-01T00:00:00Z","language":"Go"}`
+	var decoded Repository
+	if err := json.Unmarshal([]byte(old), &decoded); err != nil {
+		t.Fatalf("Failed to unmarshal old message: %v", err)
+	}
+	if decoded.Name != "test-repo" || decoded.Owner != "" {
+		t.Errorf("Decoded old message = %+v", decoded)
+	}
+}
+
+func TestRepoMessageID(t *testing.T) {
+	repo := Repository{
+		ID:        42,
+		PushedAt:  time.Date(2023, 12, 1, 10, 5, 0, 0, time.UTC),
+		UpdatedAt: time.Date(2023, 12, 2, 8, 0, 0, 0, time.UTC),
+	}
+
+	if got, want := repoMessageID(repo), "42-20231201T100500Z-20231202T080000Z"; got != want {
+		t.Errorf("repoMessageID() = %q, want %q", got, want)
+	}
+
+	pushed := repo
+	pushed.PushedAt = pushed.PushedAt.Add(time.Minute)
+	if repoMessageID(pushed) == repoMessageID(repo) {
+		t.Error("A pushed repository keeps its message ID")
+	}
+
+	gitlab := repo
+	gitlab.Provider = config.ProviderGitLab
+	if got, want := repoMessageID(gitlab), "gitlab-42-20231201T100500Z-20231202T080000Z"; got != want {
+		t.Errorf("repoMessageID() = %q, want %q", got, want)
+	}
+}
+
 // Test helper functions
 
 func runMockNATSServer() *natsserver.Server {
@@ -354,6 +803,30 @@ func runMockNATSServer() *natsserver.Server {
 	return server
 }
 
+func runMockJetStreamServer(t *testing.T) *natsserver.Server {
+	t.Helper()
+
+	opts := &natsserver.Options{
+		Host:      "127.0.0.1",
+		Port:      -1, // Use random port
+		JetStream: true,
+		StoreDir:  t.TempDir(),
+	}
+
+	server, err := natsserver.NewServer(opts)
+	if err != nil {
+		t.Fatalf("Failed to create NATS server: %v", err)
+	}
+
+	go server.Start()
+
+	if !server.ReadyForConnections(5 * time.Second) {
+		t.Fatal("NATS server not ready")
+	}
+
+	return server
+}
+
 func createMockGitHubRepo(name, cloneURL, sshURL string, createdAt, updatedAt time.Time, language string, topics []string) *github.Repository {
 	return &github.Repository{
 		Name:      github.String(name),
@@ -366,13 +839,15 @@ func createMockGitHubRepo(name, cloneURL, sshURL string, createdAt, updatedAt ti
 	}
 }
 
-func createMockRepoJSON(name string) map[string]interface{} {
+func createMockRepoJSON(id int64, name string) map[string]interface{} {
 	return map[string]interface{}{
+		"id":         id,
 		"name":       name,
 		"clone_url":  fmt.Sprintf("https://github.com/org/%s.git", name),
 		"ssh_url":    fmt.Sprintf("git@github.com:org/%s.git", name),
 		"created_at": "2023-01-01T00:00:00Z",
 		"updated_at": "2023-12-01T00:00:00Z",
+		"pushed_at":  "2023-12-01T00:00:00Z",
 		"language":   "Go",
 		"topics":     []string{"test"},
 	}
@@ -384,4 +859,121 @@ func mustParseURL(rawURL string) *url.URL {
 		panic(fmt.Sprintf("Failed to parse URL %s: %v", rawURL, err))
 	}
 	return u
-}
\ No newline at end of file
+}
+
+func TestScanTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(previous)
+	if _, err := tracing.Setup(context.Background(), "test", "1.0.0", "", 1); err != nil {
+		t.Fatalf("Setup() unexpected error: %v", err)
+	}
+
+	natsServer := runMockNATSServer()
+	defer natsServer.Shutdown()
+
+	scanner, err := New(&config.Config{
+		GitHubOrg:   "testorg",
+		GitHubToken: "token123",
+		NATSUrl:     natsServer.ClientURL(),
+		NATSSubject: "github.repositories",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create scanner: %v", err)
+	}
+	defer scanner.Close()
+	scanner.sources[config.ProviderGitHub] = newFakeSource(1, 2)
+
+	messages := make(chan *nats.Msg, 10)
+	sub, err := scanner.nc.ChanSubscribe("github.repositories", messages)
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+	defer func() { _ = sub.Unsubscribe() }()
+
+	if _, err := scanner.Scan(context.Background(), ScanOptions{Mode: ScanFull, RunID: "run-1"}); err != nil {
+		t.Fatalf("Scan() unexpected error: %v", err)
+	}
+
+	var scan, org sdktrace.ReadOnlySpan
+	publishes := map[trace.TraceID]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		switch span.Name() {
+		case "collector.Scan":
+			scan = span
+		case "collector.ScanOrganization":
+			org = span
+		case "publish github.repositories":
+			publishes[span.SpanContext().TraceID()] = span
+		}
+	}
+	if scan == nil || org == nil {
+		t.Fatalf("scan spans = %v and %v, want both", scan, org)
+	}
+	if org.Parent().SpanID() != scan.SpanContext().SpanID() {
+		t.Errorf("organization span parent = %v, want the scan span", org.Parent())
+	}
+
+	// Every repository is a trace of its own, linked to the scan
+	if len(publishes) != 2 {
+		t.Fatalf("publish traces = %d, want 2", len(publishes))
+	}
+	for _, span := range publishes {
+		if span.Parent().IsValid() {
+			t.Errorf("publish span has parent %v, want a root span", span.Parent())
+		}
+		if links := span.Links(); len(links) != 1 || links[0].SpanContext.SpanID() != org.SpanContext().SpanID() {
+			t.Errorf("publish span links = %v, want the organization span", links)
+		}
+	}
+
+	// The messages carry the trace of their publish span
+	for i := 0; i < 2; i++ {
+		select {
+		case msg := <-messages:
+			sc := trace.SpanContextFromContext(tracing.Extract(context.Background(), msg))
+			span, ok := publishes[sc.TraceID()]
+			if !ok || span.SpanContext().SpanID() != sc.SpanID() {
+				t.Errorf("message trace context = %v, want a publish span", sc)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timeout waiting for repository messages")
+		}
+	}
+}
+
+func TestScanDryRun(t *testing.T) {
+	// No NATS server: a dry run never connects
+	scanner, err := NewDryRun(&config.Config{
+		GitHubOrg:   "testorg",
+		GitHubToken: "token123",
+		NATSUrl:     "nats://127.0.0.1:1",
+		NATSSubject: "github.repositories",
+		Filters:     config.FilterConfig{NameExclude: []string{"repo3"}},
+	})
+	if err != nil {
+		t.Fatalf("NewDryRun() unexpected error: %v", err)
+	}
+	defer scanner.Close()
+	scanner.sources[config.ProviderGitHub] = newFakeSource(2, 2)
+
+	var published []string
+	result, err := scanner.Scan(context.Background(), ScanOptions{
+		Mode: ScanFull,
+		Published: func(subject string, repo Repository) {
+			published = append(published, subject+" "+repo.Name)
+		},
+	})
+	if err != nil {
+		t.Fatalf("Scan() unexpected error: %v", err)
+	}
+
+	want := []string{"github.repositories repo1", "github.repositories repo2", "github.repositories repo4"}
+	if !reflect.DeepEqual(published, want) {
+		t.Errorf("published = %v, want %v", published, want)
+	}
+	if result.Listed != 4 || result.Published != 3 || result.Filtered != 1 || result.Failed != 0 {
+		t.Errorf("result = %+v, want 4 listed, 3 published and 1 filtered", result)
+	}
+}
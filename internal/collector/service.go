@@ -0,0 +1,192 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+
+	"github.com/nats-io/nats.go/micro"
+)
+
+// Identity of the collector NATS service
+const (
+	ServiceName    = "secflow-collector"
+	ServiceVersion = "1.0.0"
+	// ServiceGroup prefixes the subjects of the service endpoints
+	ServiceGroup = "scan"
+)
+
+// repoRequest is the body of a request to publish a single repository
+type repoRequest struct {
+	// Org is the organization by name or as provider/name
+	Org string `json:"org"`
+	// Name is the repository name, or for GitLab the project path relative
+	// to the group
+	Name string `json:"name"`
+}
+
+// Service is the collector's NATS micro service. Every replica serves every
+// endpoint, but with a leader lock the endpoints that act on the scans of
+// this replica (trigger, cancel and status) refuse requests with ErrNotLeader
+// unless it holds the lock, as the admin API does.
+type Service struct {
+	svc    micro.Service
+	runner *Runner
+}
+
+// serviceEndpoint is an endpoint of the collector service
+type serviceEndpoint struct {
+	name        string
+	description string
+	handler     func(micro.Request) (interface{}, error)
+}
+
+// AddService registers the collector as a NATS micro service on the
+// connection of the runner's scanner, with the same operations as the admin
+// API. Every endpoint responds with JSON, and errors carry the HTTP status
+// code the admin API would return.
+//
+//	scan.trigger    starts a scan, {"mode": "full", "org": "name"}
+//	scan.cancel     cancels the running scan
+//	scan.status     returns the running and the last scan
+//	scan.schedule   returns the scheduled scans
+//	scan.repo       publishes one repository, {"org": "name", "name": "repo"}
+func AddService(runner *Runner, schedule func() []ScheduledScan) (*Service, error) {
+	svc := &Service{runner: runner}
+
+	endpoints := append(svc.scanEndpoints(), []serviceEndpoint{
+		{"schedule", "Next runs of the scheduled scans", func(micro.Request) (interface{}, error) {
+			scans := schedule()
+			if scans == nil {
+				scans = []ScheduledScan{}
+			}
+			return scans, nil
+		}},
+		{"repo", "Publish a single repository", func(req micro.Request) (interface{}, error) {
+			var body repoRequest
+			if err := json.Unmarshal(req.Data(), &body); err != nil {
+				return nil, fmt.Errorf("%w: %v", errInvalidRequest, err)
+			}
+			if body.Org == "" || body.Name == "" {
+				return nil, fmt.Errorf("%w: org and name are required", errInvalidRequest)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), runner.timeout)
+			defer cancel()
+			repo, err := runner.scanner.PublishRepository(ctx, body.Org, body.Name)
+			if err != nil {
+				return nil, err
+			}
+			slog.Info("Repository published on request through NATS", "repo", repo.FullName)
+			return repo, nil
+		}},
+	}...)
+
+	var err error
+	if svc.svc, err = newService(runner, endpoints); err != nil {
+		return nil, err
+	}
+	return svc, nil
+}
+
+// scanEndpoints returns the endpoints acting on the scans of this replica,
+// which only the leader serves
+func (s *Service) scanEndpoints() []serviceEndpoint {
+	runner := s.runner
+	endpoints := []serviceEndpoint{
+		{"trigger", "Start a scan", func(req micro.Request) (interface{}, error) {
+			opts, err := parseScanRequest(req.Data())
+			if err != nil {
+				return nil, err
+			}
+			status, err := runner.Start(opts, TriggerAPI)
+			if err != nil {
+				return nil, err
+			}
+			slog.Info("Scan requested through NATS", "run_id", status.ID, "mode", status.Mode)
+			return status, nil
+		}},
+		{"cancel", "Cancel the running scan", func(micro.Request) (interface{}, error) {
+			status, ok := runner.Cancel()
+			if !ok {
+				return nil, errNoScanRunning
+			}
+			return status, nil
+		}},
+		{"status", "Status of the running and the last scan", func(micro.Request) (interface{}, error) {
+			current, last := runner.Status()
+			return scansResponse{Current: current, Last: last}, nil
+		}},
+	}
+	for i, e := range endpoints {
+		endpoints[i].handler = s.leaderOnly(e.handler)
+	}
+	return endpoints
+}
+
+// leaderOnly wraps handler to return ErrNotLeader while another replica may
+// hold the leader lock, so the status of a replica that does not run the
+// scans is never mistaken for the leader's
+func (s *Service) leaderOnly(handler func(micro.Request) (interface{}, error)) func(micro.Request) (interface{}, error) {
+	return func(req micro.Request) (interface{}, error) {
+		if lock := s.runner.scanner.lock; lock != nil {
+			if _, ok := lock.Leading(); !ok {
+				return nil, ErrNotLeader
+			}
+		}
+		return handler(req)
+	}
+}
+
+// Info returns the endpoints served by this replica
+func (s *Service) Info() micro.Info {
+	return s.svc.Info()
+}
+
+// Stop removes every endpoint of the service
+func (s *Service) Stop() error {
+	return s.svc.Stop()
+}
+
+// newService registers the micro service serving endpoints in the service
+// group
+func newService(runner *Runner, endpoints []serviceEndpoint) (micro.Service, error) {
+	svc, err := micro.AddService(runner.scanner.nc, micro.Config{
+		Name:        ServiceName,
+		Version:     ServiceVersion,
+		Description: "Collects repositories from GitHub and GitLab and publishes them to NATS",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to add NATS service: %w", err)
+	}
+
+	group := svc.AddGroup(ServiceGroup)
+	for _, e := range endpoints {
+		handler := e.handler
+		err := group.AddEndpoint(e.name, micro.HandlerFunc(func(req micro.Request) {
+			respond(req, handler)
+		}), micro.WithEndpointMetadata(map[string]string{"description": e.description}))
+		if err != nil {
+			_ = svc.Stop()
+			return nil, fmt.Errorf("failed to add NATS service endpoint %s: %w", e.name, err)
+		}
+	}
+	return svc, nil
+}
+
+// respond answers a service request with the JSON result of handler, or with
+// a service error
+func respond(req micro.Request, handler func(micro.Request) (interface{}, error)) {
+	v, err := handler(req)
+	if err == nil {
+		err = req.RespondJSON(v)
+	} else {
+		data, _ := json.Marshal(errorResponse{Error: err.Error()})
+		err = req.Error(strconv.Itoa(errorStatus(err)), err.Error(), data)
+	}
+	if err != nil {
+		slog.Warn("Failed to respond to request", "subject", req.Subject(), "error", err)
+	}
+}
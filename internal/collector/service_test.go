@@ -0,0 +1,161 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/micro"
+)
+
+func TestService(t *testing.T) {
+	runner := newTestRunner(t, newFakeSource(1, 2))
+	nc := runner.scanner.nc
+
+	svc, err := AddService(runner, func() []ScheduledScan { return nil })
+	if err != nil {
+		t.Fatalf("AddService() unexpected error: %v", err)
+	}
+	defer func() { _ = svc.Stop() }()
+
+	messages := make(chan *nats.Msg, 10)
+	sub, err := nc.ChanSubscribe("github.repositories", messages)
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+	defer func() { _ = sub.Unsubscribe() }()
+
+	request := func(subject, data string) *nats.Msg {
+		t.Helper()
+		msg, err := nc.Request(subject, []byte(data), 5*time.Second)
+		if err != nil {
+			t.Fatalf("Request(%s) unexpected error: %v", subject, err)
+		}
+		return msg
+	}
+
+	// Errors carry the status code of the admin API
+	errorTests := []struct {
+		subject string
+		data    string
+		code    string
+	}{
+		{"scan.trigger", `{"mode":"partial"}`, "400"},
+		{"scan.trigger", `{"org":"other"}`, "400"},
+		{"scan.cancel", "", "404"},
+		{"scan.repo", `{"org":"testorg"}`, "400"},
+		{"scan.repo", `{"org":"testorg","name":"missing"}`, "404"},
+	}
+	for _, tt := range errorTests {
+		msg := request(tt.subject, tt.data)
+		if code := msg.Header.Get(micro.ErrorCodeHeader); code != tt.code {
+			t.Errorf("%s %s: error code = %q (%s), want %s", tt.subject, tt.data, code, msg.Data, tt.code)
+		}
+	}
+
+	// A single repository is published on request
+	msg := request("scan.repo", `{"org":"github/testorg","name":"repo2"}`)
+	var repo Repository
+	if err := json.Unmarshal(msg.Data, &repo); err != nil || repo.ID != 2 {
+		t.Errorf("scan.repo = %s, want repo2", msg.Data)
+	}
+	select {
+	case published := <-messages:
+		if err := json.Unmarshal(published.Data, &repo); err != nil || repo.Name != "repo2" {
+			t.Errorf("published %s, want repo2", published.Data)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timeout waiting for the published repository")
+	}
+
+	var status ScanStatus
+	if err := json.Unmarshal(request("scan.trigger", "").Data, &status); err != nil || status.State != ScanStateRunning {
+		t.Fatalf("scan.trigger = %+v, %v, want a running scan", status, err)
+	}
+	last := waitForLast(t, runner)
+
+	var scans scansResponse
+	if err := json.Unmarshal(request("scan.status", "").Data, &scans); err != nil {
+		t.Fatalf("Failed to decode scan.status: %v", err)
+	}
+	if scans.Current != nil || scans.Last == nil || scans.Last.ID != status.ID || scans.Last.State != last.State {
+		t.Errorf("scan.status = %+v, want scan %s as last", scans, status.ID)
+	}
+
+	// The endpoints are discoverable
+	info := svc.Info()
+	subjects := make(map[string]bool)
+	for _, e := range info.Endpoints {
+		subjects[e.Subject] = true
+	}
+	for _, subject := range []string{"scan.trigger", "scan.cancel", "scan.status", "scan.schedule", "scan.repo"} {
+		if !subjects[subject] {
+			t.Errorf("Info() is missing endpoint %s", subject)
+		}
+	}
+}
+
+func TestServiceLeaderLock(t *testing.T) {
+	runner := newTestRunner(t, newFakeSource(1, 2))
+	nc := runner.scanner.nc
+	lock := newTestLocks(t, 1, time.Minute)[0]
+	runner.scanner.lock = lock
+
+	svc, err := AddService(runner, func() []ScheduledScan { return nil })
+	if err != nil {
+		t.Fatalf("AddService() unexpected error: %v", err)
+	}
+	defer func() { _ = svc.Stop() }()
+
+	// waitForCode waits until scan.status responds with the error code, or
+	// with no error for an empty code
+	waitForCode := func(want string) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			msg, err := nc.Request("scan.status", nil, time.Second)
+			if err != nil {
+				t.Fatalf("scan.status unexpected error: %v", err)
+			}
+			code := msg.Header.Get(micro.ErrorCodeHeader)
+			if code == want {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("scan.status error code = %q, want %q", code, want)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	// Replicas that do not hold the lock refuse the scan endpoints, but
+	// still serve the others
+	for _, subject := range []string{"scan.trigger", "scan.cancel", "scan.status"} {
+		msg, err := nc.Request(subject, nil, time.Second)
+		if err != nil {
+			t.Fatalf("%s unexpected error: %v", subject, err)
+		}
+		if code := msg.Header.Get(micro.ErrorCodeHeader); code != "409" {
+			t.Errorf("%s error code = %q (%s), want 409", subject, code, msg.Data)
+		}
+	}
+	msg, err := nc.Request("scan.schedule", nil, time.Second)
+	if err != nil {
+		t.Fatalf("scan.schedule unexpected error: %v", err)
+	}
+	if code := msg.Header.Get(micro.ErrorCodeHeader); code != "" {
+		t.Errorf("scan.schedule error code = %q, want none", code)
+	}
+	// Every endpoint is registered on the one service instance
+	if got := len(svc.Info().Endpoints); got != 5 {
+		t.Errorf("Info() has %d endpoints, want 5", got)
+	}
+
+	lock.campaign(context.Background())
+	waitForCode("")
+
+	lock.setRevision(0)
+	waitForCode("409")
+}
@@ -0,0 +1,65 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// Shutdown refuses new scans with ErrShuttingDown, cancels the running scan
+// and waits until it finished or ctx is done. A cancelled scan stops at the
+// page being processed, and with a state store resumes from its checkpoint
+// on the next scan. It returns an error if the scan did not finish in time.
+func (r *Runner) Shutdown(ctx context.Context) error {
+	r.mu.Lock()
+	r.stop()
+	run := r.current
+	r.mu.Unlock()
+
+	if run == nil {
+		return nil
+	}
+	slog.Info("Waiting for the running scan to stop", "run_id", run.status.ID)
+	select {
+	case <-run.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("scan %s did not stop in time: %w", run.status.ID, ctx.Err())
+	}
+}
+
+// Drain releases the leader lock and drains the NATS connection, flushing
+// the messages still buffered, until ctx is done
+func (s *Scanner) Drain(ctx context.Context) error {
+	if s.lock != nil {
+		s.lock.Close()
+	}
+	if s.nc == nil {
+		return nil
+	}
+	return DrainConn(ctx, s.nc)
+}
+
+// DrainConn drains nc and waits for it to close. If ctx is done first, the
+// connection is closed and the messages not yet flushed are lost.
+func DrainConn(ctx context.Context, nc *nats.Conn) error {
+	if err := nc.Drain(); err != nil {
+		nc.Close()
+		return fmt.Errorf("failed to drain NATS connection: %w", err)
+	}
+
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for !nc.IsClosed() {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			nc.Close()
+			return fmt.Errorf("NATS connection did not drain in time: %w", ctx.Err())
+		}
+	}
+	return nil
+}
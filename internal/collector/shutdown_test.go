@@ -0,0 +1,79 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// stubbornSource ignores the cancellation of its context until release is
+// closed
+type stubbornSource struct {
+	*blockingSource
+}
+
+func (s stubbornSource) ListPage(ctx context.Context, org string, page int) (*Page, error) {
+	return s.blockingSource.ListPage(context.Background(), org, page)
+}
+
+func TestRunnerShutdown(t *testing.T) {
+	src := newBlockingSource()
+	runner := newTestRunner(t, src)
+
+	if _, err := runner.Start(ScanOptions{}, TriggerAPI); err != nil {
+		t.Fatalf("Start() unexpected error: %v", err)
+	}
+	<-src.started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := runner.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown() unexpected error: %v", err)
+	}
+	if _, last := runner.Status(); last == nil || last.State != ScanStateCancelled {
+		t.Errorf("Status() last = %+v, want a cancelled scan", last)
+	}
+
+	// No scan starts after shutdown
+	if _, err := runner.Start(ScanOptions{}, TriggerAPI); !errors.Is(err, ErrShuttingDown) {
+		t.Errorf("Start() error = %v, want ErrShuttingDown", err)
+	}
+	if _, err := runner.Run(context.Background(), ScanOptions{}, TriggerCron); !errors.Is(err, ErrShuttingDown) {
+		t.Errorf("Run() error = %v, want ErrShuttingDown", err)
+	}
+}
+
+func TestRunnerShutdownTimeout(t *testing.T) {
+	src := stubbornSource{newBlockingSource()}
+	runner := newTestRunner(t, src)
+
+	if _, err := runner.Start(ScanOptions{}, TriggerAPI); err != nil {
+		t.Fatalf("Start() unexpected error: %v", err)
+	}
+	<-src.started
+
+	// A scan that does not stop within the grace period is abandoned
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := runner.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Shutdown() error = %v, want a deadline exceeded error", err)
+	}
+
+	close(src.release)
+	waitForLast(t, runner)
+}
+
+func TestScannerDrain(t *testing.T) {
+	runner := newTestRunner(t, newFakeSource(1, 1))
+	scanner := runner.scanner
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := scanner.Drain(ctx); err != nil {
+		t.Fatalf("Drain() unexpected error: %v", err)
+	}
+	if !scanner.nc.IsClosed() {
+		t.Error("NATS connection not closed after Drain()")
+	}
+}
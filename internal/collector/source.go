@@ -0,0 +1,39 @@
+package collector
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrRepoNotFound is returned when a repository does not exist in an
+// organization
+var ErrRepoNotFound = errors.New("repository not found")
+
+// Source lists the repositories of an organization on a source provider.
+// Implementations convert the provider's types to Repository values, so
+// the scanner never depends on a provider API.
+type Source interface {
+	// ListPage returns one page of the repositories of org. Pages are
+	// numbered from 1 and ordered by creation, so repositories created
+	// during a scan are appended to the last page.
+	ListPage(ctx context.Context, org string, page int) (*Page, error)
+	// LookupTransfer looks up a repository of org that is no longer listed.
+	// It returns the repository's new full name if it was transferred to
+	// another owner, an empty string if org still owns it, and
+	// ErrRepoNotFound if it was deleted.
+	LookupTransfer(ctx context.Context, org string, id int64) (string, error)
+	// GetRepository returns the repository of org with the given name,
+	// relative to org, or ErrRepoNotFound if there is none
+	GetRepository(ctx context.Context, org, name string) (*Repository, error)
+}
+
+// Page is one page of the repositories of an organization
+type Page struct {
+	Number int
+	Repos  []Repository
+	// Next is the number of the next page, or zero on the last page
+	Next int
+	// Last is the number of the last page, or zero when the provider does
+	// not report it
+	Last int
+}
@@ -0,0 +1,400 @@
+package collector
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// RepoState is the last seen state of a repository
+type RepoState struct {
+	Name      string    `json:"name"`
+	PushedAt  time.Time `json:"pushed_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Archived  bool      `json:"archived,omitempty"`
+	// Filtered is set when the repository was dropped by a filter rather
+	// than published
+	Filtered bool `json:"filtered,omitempty"`
+}
+
+// ScanState is the persisted scan state of an organization
+type ScanState struct {
+	LastScanAt     time.Time           `json:"last_scan_at"`
+	LastFullScanAt time.Time           `json:"last_full_scan_at"`
+	Repos          map[int64]RepoState `json:"repos"`
+	// Checkpoint is the progress of an unfinished scan, which the next scan
+	// in the same mode resumes
+	Checkpoint *ScanCheckpoint `json:"checkpoint,omitempty"`
+}
+
+// ScanCheckpoint records how far an unfinished scan got
+type ScanCheckpoint struct {
+	StartedAt time.Time `json:"started_at"`
+	Mode      ScanMode  `json:"mode"`
+	// Page is the page up to which every page was processed
+	Page int `json:"page"`
+	// Listed holds the current state of the repositories listed so far, and
+	// Next the state to record for them once the scan completes
+	Listed map[int64]RepoState `json:"listed"`
+	Next   map[int64]RepoState `json:"next"`
+}
+
+// NewScanState returns an empty scan state
+func NewScanState() *ScanState {
+	return &ScanState{Repos: make(map[int64]RepoState)}
+}
+
+// Changed reports whether a repository is new, was filtered out when it was
+// recorded in the state, or has been pushed to or updated since. Filtered
+// repositories count as changed so they are published once the filters are
+// relaxed.
+func (st *ScanState) Changed(id int64, pushedAt, updatedAt time.Time) bool {
+	prev, ok := st.Repos[id]
+	if !ok || prev.Filtered {
+		return true
+	}
+	return pushedAt.After(prev.PushedAt) || updatedAt.After(prev.UpdatedAt)
+}
+
+// StateStore persists scan state per organization
+type StateStore interface {
+	// Load returns the scan state of org, or an empty state if none was saved
+	Load(ctx context.Context, org string) (*ScanState, error)
+	// Save replaces the scan state of org
+	Save(ctx context.Context, org string, state *ScanState) error
+	// SaveCheckpoint records the progress of an unfinished scan of org,
+	// leaving the rest of its state as it is
+	SaveCheckpoint(ctx context.Context, org string, cp *ScanCheckpoint) error
+}
+
+// FileStateStore keeps scan state in a local JSON file
+type FileStateStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewFileStateStore creates a state store backed by the file at path
+func NewFileStateStore(path string) *FileStateStore {
+	return &FileStateStore{path: path}
+}
+
+// Load returns the scan state of org from the state file
+func (f *FileStateStore) Load(_ context.Context, org string) (*ScanState, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	states, err := f.read()
+	if err != nil {
+		return nil, err
+	}
+	if st, ok := states[org]; ok && st != nil {
+		if st.Repos == nil {
+			st.Repos = make(map[int64]RepoState)
+		}
+		return st, nil
+	}
+	return NewScanState(), nil
+}
+
+// Save writes the scan state of org to the state file
+func (f *FileStateStore) Save(_ context.Context, org string, state *ScanState) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	states, err := f.read()
+	if err != nil {
+		return err
+	}
+	states[org] = state
+	return f.write(states)
+}
+
+// SaveCheckpoint writes the checkpoint of org to the state file
+func (f *FileStateStore) SaveCheckpoint(_ context.Context, org string, cp *ScanCheckpoint) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	states, err := f.read()
+	if err != nil {
+		return err
+	}
+	st, ok := states[org]
+	if !ok || st == nil {
+		st = NewScanState()
+		states[org] = st
+	}
+	st.Checkpoint = cp
+	return f.write(states)
+}
+
+// write replaces the state file with all organization states
+func (f *FileStateStore) write(states map[string]*ScanState) error {
+	data, err := json.Marshal(states)
+	if err != nil {
+		return fmt.Errorf("failed to marshal scan state: %w", err)
+	}
+
+	// Write to a temporary file first so a crash never leaves a torn file
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), filepath.Base(f.path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to create state file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), f.path); err != nil {
+		return fmt.Errorf("failed to replace state file: %w", err)
+	}
+	return nil
+}
+
+// read loads all organization states from the state file
+func (f *FileStateStore) read() (map[string]*ScanState, error) {
+	states := make(map[string]*ScanState)
+
+	data, err := os.ReadFile(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return states, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state file: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &states); err != nil {
+		return nil, fmt.Errorf("failed to parse state file %s: %w", f.path, err)
+	}
+	return states, nil
+}
+
+// KVStateStore keeps scan state in a JetStream key-value bucket, one key per
+// organization. The checkpoint of an unfinished scan is kept under a key of
+// its own, so checkpoints do not rewrite the inventory. Values larger than
+// the server accepts in a message are split into chunks.
+type KVStateStore struct {
+	kv jetstream.KeyValue
+	// chunkSize is the largest value stored under a single key
+	chunkSize int
+}
+
+// Key prefixes of the checkpoints and of the chunks of large values. Neither
+// can be the key of an organization: GitHub organization names contain no
+// dots, and GitLab groups are prefixed with their provider.
+const (
+	kvCheckpointPrefix = "checkpoints."
+	kvChunkPrefix      = "chunks."
+)
+
+// kvChunks is stored instead of a value that was split into chunks
+type kvChunks struct {
+	// Chunks holds the keys of the chunks, in order
+	Chunks []string `json:"chunks"`
+	// Generation alternates between 0 and 1 with every split write
+	Generation int `json:"generation"`
+}
+
+// NewKVStateStore creates the bucket if needed and returns a state store
+// backed by it
+func NewKVStateStore(ctx context.Context, js jetstream.JetStream, bucket string) (*KVStateStore, error) {
+	kv, err := js.CreateOrUpdateKeyValue(ctx, jetstream.KeyValueConfig{
+		Bucket:      bucket,
+		Description: "secflow-collector scan state",
+		Storage:     jetstream.FileStorage,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create key-value bucket %s: %w", bucket, err)
+	}
+
+	// Leave room for the subject and headers of the message
+	chunkSize := 512 << 10
+	if maxPayload := js.Conn().MaxPayload(); maxPayload > 0 {
+		chunkSize = int(maxPayload) / 2
+	}
+	return &KVStateStore{kv: kv, chunkSize: chunkSize}, nil
+}
+
+// Load returns the scan state of org from the bucket, with the checkpoint of
+// its unfinished scan
+func (k *KVStateStore) Load(ctx context.Context, org string) (*ScanState, error) {
+	st := NewScanState()
+	data, err := k.get(ctx, org)
+	switch {
+	case errors.Is(err, jetstream.ErrKeyNotFound):
+	case err != nil:
+		return nil, fmt.Errorf("failed to get scan state for %s: %w", org, err)
+	default:
+		if err := json.Unmarshal(data, st); err != nil {
+			return nil, fmt.Errorf("failed to parse scan state for %s: %w", org, err)
+		}
+		if st.Repos == nil {
+			st.Repos = make(map[int64]RepoState)
+		}
+	}
+
+	data, err = k.get(ctx, kvCheckpointPrefix+org)
+	switch {
+	case errors.Is(err, jetstream.ErrKeyNotFound):
+	case err != nil:
+		return nil, fmt.Errorf("failed to get scan checkpoint for %s: %w", org, err)
+	default:
+		var cp ScanCheckpoint
+		if err := json.Unmarshal(data, &cp); err != nil {
+			return nil, fmt.Errorf("failed to parse scan checkpoint for %s: %w", org, err)
+		}
+		st.Checkpoint = &cp
+	}
+	return st, nil
+}
+
+// Save writes the scan state of org to the bucket, and replaces or removes
+// the checkpoint of its unfinished scan
+func (k *KVStateStore) Save(ctx context.Context, org string, state *ScanState) error {
+	inventory := *state
+	inventory.Checkpoint = nil
+	data, err := json.Marshal(&inventory)
+	if err != nil {
+		return fmt.Errorf("failed to marshal scan state: %w", err)
+	}
+	if err := k.put(ctx, org, data); err != nil {
+		return fmt.Errorf("failed to save scan state for %s: %w", org, err)
+	}
+
+	if state.Checkpoint != nil {
+		return k.SaveCheckpoint(ctx, org, state.Checkpoint)
+	}
+	if err := k.delete(ctx, kvCheckpointPrefix+org); err != nil {
+		return fmt.Errorf("failed to remove scan checkpoint for %s: %w", org, err)
+	}
+	return nil
+}
+
+// SaveCheckpoint writes the checkpoint of org to the bucket
+func (k *KVStateStore) SaveCheckpoint(ctx context.Context, org string, cp *ScanCheckpoint) error {
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return fmt.Errorf("failed to marshal scan checkpoint: %w", err)
+	}
+	if err := k.put(ctx, kvCheckpointPrefix+org, data); err != nil {
+		return fmt.Errorf("failed to save scan checkpoint for %s: %w", org, err)
+	}
+	return nil
+}
+
+// get returns the value of key, joining its chunks if it was split
+func (k *KVStateStore) get(ctx context.Context, key string) ([]byte, error) {
+	entry, err := k.kv.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	chunks, ok := parseChunks(entry.Value())
+	if !ok {
+		return entry.Value(), nil
+	}
+	var data []byte
+	for _, chunkKey := range chunks.Chunks {
+		chunk, err := k.kv.Get(ctx, chunkKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get chunk %s: %w", chunkKey, err)
+		}
+		data = append(data, chunk.Value()...)
+	}
+	return data, nil
+}
+
+// put stores data under key. Data larger than chunkSize is written to chunks
+// first, and key then replaced with their keys, so a failed write leaves the
+// previous value in place. The chunks of the previous value are removed.
+func (k *KVStateStore) put(ctx context.Context, key string, data []byte) error {
+	var prev kvChunks
+	if entry, err := k.kv.Get(ctx, key); err == nil {
+		prev, _ = parseChunks(entry.Value())
+	} else if !errors.Is(err, jetstream.ErrKeyNotFound) {
+		return err
+	}
+
+	value := data
+	if len(data) > k.chunkSize {
+		// The chunks are written under the other generation than the
+		// previous value's, which stays readable until key is replaced
+		chunks := kvChunks{Generation: 1 - prev.Generation}
+		if len(prev.Chunks) == 0 {
+			chunks.Generation = 0
+		}
+		for i := 0; len(data) > 0; i++ {
+			n := min(len(data), k.chunkSize)
+			chunkKey := kvChunkPrefix + key + "." + strconv.Itoa(chunks.Generation) + "." + strconv.Itoa(i)
+			if _, err := k.kv.Put(ctx, chunkKey, data[:n]); err != nil {
+				return fmt.Errorf("failed to save chunk %s: %w", chunkKey, err)
+			}
+			chunks.Chunks = append(chunks.Chunks, chunkKey)
+			data = data[n:]
+		}
+		var err error
+		if value, err = json.Marshal(chunks); err != nil {
+			return fmt.Errorf("failed to marshal chunks: %w", err)
+		}
+	}
+	if _, err := k.kv.Put(ctx, key, value); err != nil {
+		return err
+	}
+
+	k.purge(ctx, prev.Chunks)
+	return nil
+}
+
+// delete removes key and its chunks
+func (k *KVStateStore) delete(ctx context.Context, key string) error {
+	entry, err := k.kv.Get(ctx, key)
+	if errors.Is(err, jetstream.ErrKeyNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := k.kv.Purge(ctx, key); err != nil {
+		return err
+	}
+	if chunks, ok := parseChunks(entry.Value()); ok {
+		k.purge(ctx, chunks.Chunks)
+	}
+	return nil
+}
+
+// purge removes chunks that are no longer referenced. Failures only leave
+// unused keys behind, so they are logged rather than returned.
+func (k *KVStateStore) purge(ctx context.Context, keys []string) {
+	for _, key := range keys {
+		if err := k.kv.Purge(ctx, key); err != nil {
+			slog.Warn("Failed to remove stale state chunk", "key", key, "error", err)
+		}
+	}
+}
+
+// parseChunks returns the chunk keys stored in place of a value that was
+// split. Values that were not split are JSON objects without a chunks field.
+func parseChunks(value []byte) (kvChunks, bool) {
+	var chunks kvChunks
+	if !bytes.HasPrefix(value, []byte(`{"chunks":`)) {
+		return chunks, false
+	}
+	if err := json.Unmarshal(value, &chunks); err != nil || len(chunks.Chunks) == 0 {
+		return chunks, false
+	}
+	return chunks, true
+}
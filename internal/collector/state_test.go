@@ -0,0 +1,230 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+func TestScanStateChanged(t *testing.T) {
+	pushedAt := time.Date(2023, 12, 1, 0, 0, 0, 0, time.UTC)
+	updatedAt := time.Date(2023, 12, 2, 0, 0, 0, 0, time.UTC)
+
+	st := NewScanState()
+	st.Repos[1] = RepoState{Name: "repo1", PushedAt: pushedAt, UpdatedAt: updatedAt}
+	st.Repos[3] = RepoState{Name: "repo3", PushedAt: pushedAt, UpdatedAt: updatedAt, Filtered: true}
+
+	tests := []struct {
+		name      string
+		id        int64
+		pushedAt  time.Time
+		updatedAt time.Time
+		want      bool
+	}{
+		{"unchanged", 1, pushedAt, updatedAt, false},
+		{"pushed", 1, pushedAt.Add(time.Hour), updatedAt, true},
+		{"updated", 1, pushedAt, updatedAt.Add(time.Hour), true},
+		{"new", 2, pushedAt, updatedAt, true},
+		{"filtered", 3, pushedAt, updatedAt, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := st.Changed(tt.id, tt.pushedAt, tt.updatedAt); got != tt.want {
+				t.Errorf("Changed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFileStateStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	store := NewFileStateStore(path)
+
+	testStateStore(t, store)
+
+	// State survives a new store instance
+	st, err := NewFileStateStore(path).Load(context.Background(), "org1")
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if len(st.Repos) != 1 {
+		t.Errorf("Reloaded repos = %d, want 1", len(st.Repos))
+	}
+}
+
+func TestFileStateStoreCorrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := os.WriteFile(path, []byte("{not json"), 0o600); err != nil {
+		t.Fatalf("Failed to write state file: %v", err)
+	}
+
+	if _, err := NewFileStateStore(path).Load(context.Background(), "org1"); err == nil {
+		t.Error("Load() expected error for corrupt state file, got nil")
+	}
+}
+
+func TestKVStateStore(t *testing.T) {
+	server := runMockJetStreamServer(t)
+	defer server.Shutdown()
+
+	nc, err := nats.Connect(server.ClientURL())
+	if err != nil {
+		t.Fatalf("Failed to connect to NATS: %v", err)
+	}
+	defer nc.Close()
+
+	js, err := jetstream.New(nc)
+	if err != nil {
+		t.Fatalf("Failed to create JetStream context: %v", err)
+	}
+
+	store, err := NewKVStateStore(context.Background(), js, "secflow_collector_state")
+	if err != nil {
+		t.Fatalf("NewKVStateStore() unexpected error: %v", err)
+	}
+
+	testStateStore(t, store)
+}
+
+func TestKVStateStoreLarge(t *testing.T) {
+	server := runMockJetStreamServer(t)
+	defer server.Shutdown()
+
+	nc, err := nats.Connect(server.ClientURL())
+	if err != nil {
+		t.Fatalf("Failed to connect to NATS: %v", err)
+	}
+	defer nc.Close()
+
+	js, err := jetstream.New(nc)
+	if err != nil {
+		t.Fatalf("Failed to create JetStream context: %v", err)
+	}
+
+	ctx := context.Background()
+	store, err := NewKVStateStore(ctx, js, "secflow_collector_state")
+	if err != nil {
+		t.Fatalf("NewKVStateStore() unexpected error: %v", err)
+	}
+
+	// An inventory and a checkpoint well over the server's 1 MB max payload
+	pushedAt := time.Date(2023, 12, 1, 0, 0, 0, 0, time.UTC)
+	st := NewScanState()
+	for id := int64(1); id <= 20000; id++ {
+		st.Repos[id] = RepoState{Name: fmt.Sprintf("repository-with-a-long-name-%d", id), PushedAt: pushedAt, UpdatedAt: pushedAt}
+	}
+	cp := &ScanCheckpoint{StartedAt: pushedAt, Mode: ScanFull, Page: 200, Listed: st.Repos, Next: st.Repos}
+	if data, _ := json.Marshal(cp); len(data) <= int(nc.MaxPayload()) {
+		t.Fatalf("Checkpoint of %d bytes does not exceed the max payload of %d", len(data), nc.MaxPayload())
+	}
+
+	if err := store.Save(ctx, "org1", st); err != nil {
+		t.Fatalf("Save() unexpected error: %v", err)
+	}
+	if err := store.SaveCheckpoint(ctx, "org1", cp); err != nil {
+		t.Fatalf("SaveCheckpoint() unexpected error: %v", err)
+	}
+	// A second write replaces the chunks of the first
+	if err := store.SaveCheckpoint(ctx, "org1", cp); err != nil {
+		t.Fatalf("SaveCheckpoint() unexpected error: %v", err)
+	}
+
+	got, err := store.Load(ctx, "org1")
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if len(got.Repos) != 20000 || got.Repos[20000] != st.Repos[20000] {
+		t.Errorf("Load() = %d repos, want 20000", len(got.Repos))
+	}
+	if got.Checkpoint == nil || got.Checkpoint.Page != 200 || len(got.Checkpoint.Listed) != 20000 || len(got.Checkpoint.Next) != 20000 {
+		t.Fatalf("Checkpoint = %+v, want page 200 with 20000 repositories", got.Checkpoint)
+	}
+
+	// Saving a small state removes the checkpoint and every chunk
+	if err := store.Save(ctx, "org1", NewScanState()); err != nil {
+		t.Fatalf("Save() unexpected error: %v", err)
+	}
+	lister, err := store.kv.ListKeys(ctx)
+	if err != nil {
+		t.Fatalf("ListKeys() unexpected error: %v", err)
+	}
+	var keys []string
+	for key := range lister.Keys() {
+		keys = append(keys, key)
+	}
+	if len(keys) != 1 || keys[0] != "org1" {
+		t.Errorf("Keys = %v, want [org1]", keys)
+	}
+}
+
+// testStateStore checks the behaviour shared by all state stores
+func testStateStore(t *testing.T, store StateStore) {
+	t.Helper()
+	ctx := context.Background()
+
+	st, err := store.Load(ctx, "org1")
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if !st.LastScanAt.IsZero() || len(st.Repos) != 0 {
+		t.Errorf("Load() of unknown org = %+v, want empty state", st)
+	}
+
+	scannedAt := time.Date(2023, 12, 3, 0, 0, 0, 0, time.UTC)
+	st.LastScanAt = scannedAt
+	st.Repos[42] = RepoState{Name: "repo", PushedAt: scannedAt.Add(-time.Hour)}
+	if err := store.Save(ctx, "org1", st); err != nil {
+		t.Fatalf("Save() unexpected error: %v", err)
+	}
+
+	got, err := store.Load(ctx, "org1")
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if !got.LastScanAt.Equal(scannedAt) {
+		t.Errorf("LastScanAt = %v, want %v", got.LastScanAt, scannedAt)
+	}
+	if got.Repos[42].Name != "repo" {
+		t.Errorf("Repos[42].Name = %q, want %q", got.Repos[42].Name, "repo")
+	}
+
+	// A checkpoint leaves the inventory as it is, until the scan completes
+	cp := &ScanCheckpoint{StartedAt: scannedAt, Mode: ScanFull, Page: 3, Listed: map[int64]RepoState{7: {Name: "new"}}}
+	if err := store.SaveCheckpoint(ctx, "org1", cp); err != nil {
+		t.Fatalf("SaveCheckpoint() unexpected error: %v", err)
+	}
+	got, err = store.Load(ctx, "org1")
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if got.Checkpoint == nil || got.Checkpoint.Page != 3 || got.Checkpoint.Listed[7].Name != "new" {
+		t.Errorf("Checkpoint = %+v, want page 3", got.Checkpoint)
+	}
+	if got.Repos[42].Name != "repo" {
+		t.Errorf("Repos[42].Name = %q after checkpoint, want %q", got.Repos[42].Name, "repo")
+	}
+	got.Checkpoint = nil
+	if err := store.Save(ctx, "org1", got); err != nil {
+		t.Fatalf("Save() unexpected error: %v", err)
+	}
+	if got, err = store.Load(ctx, "org1"); err != nil || got.Checkpoint != nil {
+		t.Errorf("Load() = checkpoint %+v, %v, want none", got.Checkpoint, err)
+	}
+
+	// Organizations are stored independently
+	other, err := store.Load(ctx, "org2")
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if len(other.Repos) != 0 {
+		t.Errorf("Load() of org2 returned %d repos, want 0", len(other.Repos))
+	}
+}
@@ -2,47 +2,217 @@ package config
 
 import (
 	"fmt"
+	"log/slog"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// Supported source providers
+const (
+	ProviderGitHub = "github"
+	ProviderGitLab = "gitlab"
+)
+
+// Supported scan state backends
+const (
+	StateBackendFile = "file"
+	StateBackendKV   = "kv"
+)
+
+// Supported policies for scheduled scans that start while a scan is running
+const (
+	ScanOverlapSkip  = "skip"
+	ScanOverlapQueue = "queue"
+)
+
+// Supported log formats
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// Supported GitHub response cache backends
+const (
+	CacheBackendMemory = "memory"
+	CacheBackendDisk   = "disk"
+)
+
+// OrgConfig configures a single GitHub organization or GitLab group to scan
+type OrgConfig struct {
+	Name string
+	// Provider is ProviderGitHub or ProviderGitLab
+	Provider string
+	// Token overrides GitHubToken or GitLabToken for this organization
+	Token string
+	// Subject overrides NATSSubject for this organization
+	Subject string
+	// InstallationID is the GitHub App installation for this organization.
+	// When zero, GitHubAppInstallationID or a lookup by name is used.
+	InstallationID int64
+}
+
 // Config holds the application configuration
 type Config struct {
-	GitHubOrg           string
-	GitHubToken         string
-	NATSUrl             string
-	NATSSubject         string
-	CronSchedule        string
-	RunOnStartup        bool
+	GitHubOrg  string
+	GitHubOrgs []OrgConfig
+	// GitHub App authentication
+	GitHubAppID             int64
+	GitHubAppPrivateKeyFile string
+	GitHubAppInstallationID int64
+	GitHubToken             string
+	NATSUrl                 string
+	NATSSubject             string
+	CronSchedule            string
+	RunOnStartup            bool
+	// GitHub Enterprise Server endpoints, empty for github.com
+	GitHubAPIURL    string
+	GitHubUploadURL string
+	// GitHub API rate limit handling
+	GitHubRateLimitReserve int
+	GitHubRateLimitMaxWait time.Duration
+	GitHubRateLimitRetries int
+	// GitHub API response cache, disabled when GitHubCache is empty
+	GitHubCache          string
+	GitHubCacheDir       string
+	GitHubCacheMaxSizeMB int
+	GitHubCacheTTL       time.Duration
+	// GitLab configuration
+	GitLabURL    string
+	GitLabToken  string
+	GitLabGroups []OrgConfig
+	// Incremental scan configuration
+	IncrementalCronSchedule string
+	StateBackend            string
+	StateFile               string
+	StateBucket             string
+	// ScanPageConcurrency is the number of pages of an organization fetched
+	// at once
+	ScanPageConcurrency int
+	// ScanCheckpointMaxAge is how long an unfinished scan can be resumed
+	ScanCheckpointMaxAge time.Duration
+	// ScanTimeout bounds a single scan
+	ScanTimeout time.Duration
+	// ShutdownGracePeriod bounds the wait for in-flight scans and messages
+	// on shutdown, after which their work is abandoned
+	ShutdownGracePeriod time.Duration
+	// ScanOverlap decides whether a scheduled scan that starts while another
+	// scan is running is skipped or queued
+	ScanOverlap string
+	// Leader lock, so only one collector replica scans at a time
+	ScanLock       bool
+	ScanLockBucket string
+	ScanLockTTL    time.Duration
+	// HTTP server of the collector and the validator, serving the metrics.
+	// The collector's admin API is only served when AdminToken is set.
+	HTTPAddr   string
+	AdminToken string
+	// NATSService registers the collector's NATS micro service, which has
+	// no authentication of its own
+	NATSService bool
+	// OpenTelemetry tracing. Spans are only exported when OTLPEndpoint is
+	// set; TraceSampleRatio is the share of traces started by the collector
+	// that are sampled.
+	OTLPEndpoint     string
+	TraceSampleRatio float64
+	// Logging of the collector and the validator. Per-repository lines are
+	// only logged at LogLevel debug.
+	LogLevel  slog.Level
+	LogFormat string
+	// Repository filtering rules
+	Filters FilterConfig
+	// JetStream configuration
+	NATSJetStream       bool
+	NATSStream          string
+	NATSDuplicateWindow time.Duration
 	// Validator specific configuration
-	ValidReposSubject     string
-	InvalidReposSubject   string
-	SourceSubject         string
+	ValidReposSubject      string
+	InvalidReposSubject    string
+	SourceSubject          string
+	DeadLetterSubject      string
 	ProcessStartupMessages bool
+	// Validator specific JetStream consumer configuration
+	ConsumerName       string
+	ConsumerMaxDeliver int
+	ConsumerAckWait    time.Duration
+	// Validator worker pool configuration
+	WorkerPoolSize  int
+	WorkerQueueSize int
+	// Validator check retry configuration
+	CheckMaxAttempts     int
+	CheckRetryBackoff    time.Duration
+	CheckRetryMaxBackoff time.Duration
 }
 
 // Load loads configuration from environment variables
 func Load() (*Config, error) {
 	cfg := &Config{
-		GitHubOrg:           os.Getenv("GITHUB_ORG"),
-		GitHubToken:         os.Getenv("GITHUB_TOKEN"),
-		NATSUrl:             os.Getenv("NATS_URL"),
-		NATSSubject:         os.Getenv("NATS_SUBJECT"),
-		CronSchedule:        os.Getenv("CRON_SCHEDULE"),
-		ValidReposSubject:   os.Getenv("VALID_REPOS_SUBJECT"),
-		InvalidReposSubject: os.Getenv("INVALID_REPOS_SUBJECT"),
-		SourceSubject:       os.Getenv("SOURCE_SUBJECT"),
+		GitHubOrg:               os.Getenv("GITHUB_ORG"),
+		GitHubToken:             os.Getenv("GITHUB_TOKEN"),
+		GitHubAppPrivateKeyFile: os.Getenv("GITHUB_APP_PRIVATE_KEY_FILE"),
+		GitHubAPIURL:            os.Getenv("GITHUB_API_URL"),
+		GitHubUploadURL:         os.Getenv("GITHUB_UPLOAD_URL"),
+		GitHubCache:             os.Getenv("GITHUB_CACHE"),
+		GitHubCacheDir:          os.Getenv("GITHUB_CACHE_DIR"),
+		GitLabURL:               os.Getenv("GITLAB_URL"),
+		GitLabToken:             os.Getenv("GITLAB_TOKEN"),
+		NATSUrl:                 os.Getenv("NATS_URL"),
+		NATSSubject:             os.Getenv("NATS_SUBJECT"),
+		CronSchedule:            os.Getenv("CRON_SCHEDULE"),
+		IncrementalCronSchedule: os.Getenv("INCREMENTAL_CRON_SCHEDULE"),
+		StateBackend:            os.Getenv("STATE_BACKEND"),
+		StateFile:               os.Getenv("STATE_FILE"),
+		StateBucket:             os.Getenv("STATE_BUCKET"),
+		ScanOverlap:             os.Getenv("SCAN_OVERLAP"),
+		ScanLockBucket:          os.Getenv("SCAN_LOCK_BUCKET"),
+		ValidReposSubject:       os.Getenv("VALID_REPOS_SUBJECT"),
+		InvalidReposSubject:     os.Getenv("INVALID_REPOS_SUBJECT"),
+		SourceSubject:           os.Getenv("SOURCE_SUBJECT"),
+		DeadLetterSubject:       os.Getenv("DEAD_LETTER_SUBJECT"),
+		HTTPAddr:                os.Getenv("HTTP_ADDR"),
+		AdminToken:              os.Getenv("ADMIN_TOKEN"),
+		OTLPEndpoint:            os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"),
+		LogFormat:               os.Getenv("LOG_FORMAT"),
+		NATSStream:              os.Getenv("NATS_STREAM"),
+		ConsumerName:            os.Getenv("VALIDATOR_CONSUMER"),
 	}
 
 	// Set defaults
 	if cfg.NATSUrl == "" {
 		cfg.NATSUrl = "nats://localhost:4222"
 	}
+	if cfg.GitLabURL == "" {
+		cfg.GitLabURL = "https://gitlab.com"
+	}
 	if cfg.NATSSubject == "" {
 		cfg.NATSSubject = "github.repositories"
 	}
 	if cfg.CronSchedule == "" {
 		cfg.CronSchedule = "0 0 * * 0" // Weekly on Sunday at midnight
 	}
+	if cfg.GitHubCacheDir == "" {
+		cfg.GitHubCacheDir = "secflow-cache"
+	}
+	if cfg.HTTPAddr == "" {
+		cfg.HTTPAddr = ":8080"
+	}
+	if cfg.StateFile == "" {
+		cfg.StateFile = "secflow-state.json"
+	}
+	if cfg.StateBucket == "" {
+		cfg.StateBucket = "secflow_collector_state"
+	}
+	if cfg.ScanOverlap == "" {
+		cfg.ScanOverlap = ScanOverlapSkip
+	}
+	if cfg.LogFormat == "" {
+		cfg.LogFormat = LogFormatText
+	}
+	if cfg.ScanLockBucket == "" {
+		cfg.ScanLockBucket = "secflow_collector_lock"
+	}
 	if cfg.ValidReposSubject == "" {
 		cfg.ValidReposSubject = "repos.valid"
 	}
@@ -52,13 +222,118 @@ func Load() (*Config, error) {
 	if cfg.SourceSubject == "" {
 		cfg.SourceSubject = "github.repositories"
 	}
+	if cfg.DeadLetterSubject == "" {
+		cfg.DeadLetterSubject = "repos.deadletter"
+	}
+	if cfg.NATSStream == "" {
+		cfg.NATSStream = "GITHUB_REPOSITORIES"
+	}
+	if cfg.ConsumerName == "" {
+		cfg.ConsumerName = "secflow-validator"
+	}
+
+	// Parse the organizations to scan
+	var err error
+	if cfg.GitHubOrgs, err = parseOrgs(os.Getenv("GITHUB_ORGS"), cfg.GitHubOrg); err != nil {
+		return nil, err
+	}
+	if len(cfg.GitHubOrgs) > 0 {
+		cfg.GitHubOrg = cfg.GitHubOrgs[0].Name
+	}
+	cfg.GitLabGroups = parseGroups(os.Getenv("GITLAB_GROUPS"))
+
+	// Parse GitHub App authentication
+	if cfg.GitHubAppID, err = int64Env("GITHUB_APP_ID"); err != nil {
+		return nil, err
+	}
+	if cfg.GitHubAppInstallationID, err = int64Env("GITHUB_APP_INSTALLATION_ID"); err != nil {
+		return nil, err
+	}
 
 	// Validate required fields
-	if cfg.GitHubOrg == "" {
-		return nil, fmt.Errorf("GITHUB_ORG environment variable is required")
+	if cfg.GitHubOrg == "" && len(cfg.GitLabGroups) == 0 {
+		return nil, fmt.Errorf("GITHUB_ORG, GITHUB_ORGS or GITLAB_GROUPS environment variable is required")
 	}
-	if cfg.GitHubToken == "" {
-		return nil, fmt.Errorf("GITHUB_TOKEN environment variable is required")
+	if cfg.GitHubAppID != 0 {
+		if cfg.GitHubAppPrivateKeyFile == "" {
+			return nil, fmt.Errorf("GITHUB_APP_PRIVATE_KEY_FILE environment variable is required with GITHUB_APP_ID")
+		}
+	} else if cfg.GitHubToken == "" {
+		for _, org := range cfg.GitHubOrgs {
+			if org.Token == "" {
+				return nil, fmt.Errorf("GITHUB_TOKEN environment variable is required")
+			}
+		}
+	}
+
+	if cfg.GitHubAPIURL != "" {
+		if err := validateURL("GITHUB_API_URL", cfg.GitHubAPIURL); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.GitHubUploadURL != "" {
+		if cfg.GitHubAPIURL == "" {
+			return nil, fmt.Errorf("GITHUB_UPLOAD_URL requires GITHUB_API_URL to be set")
+		}
+		if err := validateURL("GITHUB_UPLOAD_URL", cfg.GitHubUploadURL); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.OTLPEndpoint != "" {
+		if err := validateURL("OTEL_EXPORTER_OTLP_ENDPOINT", cfg.OTLPEndpoint); err != nil {
+			return nil, err
+		}
+	}
+	if err := validateURL("GITLAB_URL", cfg.GitLabURL); err != nil {
+		return nil, err
+	}
+
+	switch cfg.GitHubCache {
+	case "", CacheBackendMemory, CacheBackendDisk:
+	default:
+		return nil, fmt.Errorf("invalid GITHUB_CACHE %q: must be %q or %q", cfg.GitHubCache, CacheBackendMemory, CacheBackendDisk)
+	}
+
+	switch cfg.StateBackend {
+	case "", StateBackendFile, StateBackendKV:
+	default:
+		return nil, fmt.Errorf("invalid STATE_BACKEND %q: must be %q or %q", cfg.StateBackend, StateBackendFile, StateBackendKV)
+	}
+	if cfg.IncrementalCronSchedule != "" && cfg.StateBackend == "" {
+		return nil, fmt.Errorf("INCREMENTAL_CRON_SCHEDULE requires STATE_BACKEND to be set")
+	}
+
+	if level := os.Getenv("LOG_LEVEL"); level != "" {
+		if err := cfg.LogLevel.UnmarshalText([]byte(level)); err != nil {
+			return nil, fmt.Errorf("invalid LOG_LEVEL %q: must be debug, info, warn or error", level)
+		}
+	}
+
+	switch cfg.LogFormat {
+	case LogFormatText, LogFormatJSON:
+	default:
+		return nil, fmt.Errorf("invalid LOG_FORMAT %q: must be %q or %q", cfg.LogFormat, LogFormatText, LogFormatJSON)
+	}
+
+	switch cfg.ScanOverlap {
+	case ScanOverlapSkip, ScanOverlapQueue:
+	default:
+		return nil, fmt.Errorf("invalid SCAN_OVERLAP %q: must be %q or %q", cfg.ScanOverlap, ScanOverlapSkip, ScanOverlapQueue)
+	}
+
+	// Check if only the replica holding the leader lock should scan
+	if os.Getenv("SCAN_LOCK") == "true" {
+		cfg.ScanLock = true
+	}
+
+	// Parse the repository filtering rules
+	if cfg.Filters, err = loadFilters(); err != nil {
+		return nil, err
+	}
+
+	// Check if the NATS service should be registered
+	if os.Getenv("NATS_SERVICE") == "true" {
+		cfg.NATSService = true
 	}
 
 	// Check if we should run on startup
@@ -66,6 +341,73 @@ func Load() (*Config, error) {
 		cfg.RunOnStartup = true
 	}
 
+	// Check if we should publish through JetStream
+	if os.Getenv("NATS_JETSTREAM") == "true" {
+		cfg.NATSJetStream = true
+	}
+
+	// Parse JetStream durations and limits
+	if cfg.NATSDuplicateWindow, err = durationEnv("NATS_DUPLICATE_WINDOW", time.Hour); err != nil {
+		return nil, err
+	}
+	if cfg.ConsumerAckWait, err = durationEnv("CONSUMER_ACK_WAIT", 30*time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.ConsumerMaxDeliver, err = intEnv("CONSUMER_MAX_DELIVER", 5); err != nil {
+		return nil, err
+	}
+	if cfg.WorkerPoolSize, err = intEnv("WORKER_POOL_SIZE", 10); err != nil {
+		return nil, err
+	}
+	if cfg.WorkerQueueSize, err = intEnv("WORKER_QUEUE_SIZE", 100); err != nil {
+		return nil, err
+	}
+	if cfg.ScanPageConcurrency, err = intEnv("SCAN_PAGE_CONCURRENCY", 1); err != nil {
+		return nil, err
+	}
+	if cfg.ScanCheckpointMaxAge, err = durationEnv("SCAN_CHECKPOINT_MAX_AGE", 24*time.Hour); err != nil {
+		return nil, err
+	}
+	if cfg.ScanTimeout, err = durationEnv("SCAN_TIMEOUT", 30*time.Minute); err != nil {
+		return nil, err
+	}
+	// Shorter than the 30 seconds Kubernetes waits before killing a pod
+	if cfg.ShutdownGracePeriod, err = durationEnv("SHUTDOWN_GRACE_PERIOD", 25*time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.ScanLockTTL, err = durationEnv("SCAN_LOCK_TTL", 30*time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.GitHubRateLimitReserve, err = nonNegativeIntEnv("GITHUB_RATE_LIMIT_RESERVE", 0); err != nil {
+		return nil, err
+	}
+	if cfg.GitHubRateLimitMaxWait, err = durationEnv("GITHUB_RATE_LIMIT_MAX_WAIT", time.Hour); err != nil {
+		return nil, err
+	}
+	if cfg.GitHubRateLimitRetries, err = nonNegativeIntEnv("GITHUB_RATE_LIMIT_RETRIES", 3); err != nil {
+		return nil, err
+	}
+	if cfg.GitHubCacheMaxSizeMB, err = intEnv("GITHUB_CACHE_MAX_SIZE_MB", 100); err != nil {
+		return nil, err
+	}
+	// Longer than the weekly default schedule, so consecutive scans revalidate
+	// the pages of the previous one
+	if cfg.GitHubCacheTTL, err = durationEnv("GITHUB_CACHE_TTL", 8*24*time.Hour); err != nil {
+		return nil, err
+	}
+	if cfg.TraceSampleRatio, err = ratioEnv("TRACE_SAMPLE_RATIO", 1); err != nil {
+		return nil, err
+	}
+	if cfg.CheckMaxAttempts, err = intEnv("CHECK_MAX_ATTEMPTS", 4); err != nil {
+		return nil, err
+	}
+	if cfg.CheckRetryBackoff, err = durationEnv("CHECK_RETRY_BACKOFF", time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.CheckRetryMaxBackoff, err = durationEnv("CHECK_RETRY_MAX_BACKOFF", 30*time.Second); err != nil {
+		return nil, err
+	}
+
 	// Check if we should process startup messages (default: true)
 	if os.Getenv("PROCESS_STARTUP_MESSAGES") == "false" {
 		cfg.ProcessStartupMessages = false
@@ -74,4 +416,200 @@ func Load() (*Config, error) {
 	}
 
 	return cfg, nil
-}
\ No newline at end of file
+}
+
+// Organizations returns the GitHub organizations and GitLab groups to scan,
+// with their Provider set. Configurations built without GitHubOrgs fall back
+// to the single GitHubOrg.
+func (c *Config) Organizations() []OrgConfig {
+	var orgs []OrgConfig
+	switch {
+	case len(c.GitHubOrgs) > 0:
+		for _, org := range c.GitHubOrgs {
+			if org.Provider == "" {
+				org.Provider = ProviderGitHub
+			}
+			orgs = append(orgs, org)
+		}
+	case c.GitHubOrg != "":
+		orgs = append(orgs, OrgConfig{Name: c.GitHubOrg, Provider: ProviderGitHub})
+	}
+	return append(orgs, c.GitLabGroups...)
+}
+
+// SourceSubjects returns the subjects the validator consumes repositories
+// from: SourceSubject and the NATS_SUBJECT_<ORG> override of every
+// organization, without duplicates
+func (c *Config) SourceSubjects() []string {
+	subjects := []string{c.SourceSubject}
+	seen := map[string]bool{c.SourceSubject: true}
+	for _, org := range c.Organizations() {
+		if org.Subject == "" || seen[org.Subject] {
+			continue
+		}
+		seen[org.Subject] = true
+		subjects = append(subjects, org.Subject)
+	}
+	return subjects
+}
+
+// ValidateValidator checks the configuration the validator needs on top of
+// Load. Without a GitHub App, the validator checks repositories of owners
+// without a token override, such as a repository transferred out of its
+// organization, with GITHUB_TOKEN, so it is required as soon as a GitHub
+// organization is configured.
+func (c *Config) ValidateValidator() error {
+	if c.GitHubAppID == 0 && c.GitHubToken == "" && c.GitHubOrg != "" {
+		return fmt.Errorf("GITHUB_TOKEN environment variable is required by the validator")
+	}
+	return nil
+}
+
+// parseOrgs parses the comma-separated GITHUB_ORGS list, falling back to the
+// single GITHUB_ORG. Per-organization overrides are read from
+// GITHUB_TOKEN_<ORG>, NATS_SUBJECT_<ORG> and GITHUB_APP_INSTALLATION_ID_<ORG>,
+// where <ORG> is the organization name upper-cased with every other character
+// replaced by an underscore.
+func parseOrgs(list, single string) ([]OrgConfig, error) {
+	if list == "" {
+		list = single
+	}
+
+	var orgs []OrgConfig
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		key := OrgEnvKey(name)
+		installationID, err := int64Env("GITHUB_APP_INSTALLATION_ID_" + key)
+		if err != nil {
+			return nil, err
+		}
+		orgs = append(orgs, OrgConfig{
+			Name:           name,
+			Token:          os.Getenv("GITHUB_TOKEN_" + key),
+			Subject:        os.Getenv("NATS_SUBJECT_" + key),
+			InstallationID: installationID,
+		})
+	}
+	return orgs, nil
+}
+
+// parseGroups parses the comma-separated GITLAB_GROUPS list. Subgroups are
+// given by their full path, such as "platform/backend". Per-group overrides
+// are read from GITLAB_TOKEN_<GROUP> and NATS_SUBJECT_<GROUP>.
+func parseGroups(list string) []OrgConfig {
+	var groups []OrgConfig
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(list, ",") {
+		name = strings.Trim(strings.TrimSpace(name), "/")
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		key := OrgEnvKey(name)
+		groups = append(groups, OrgConfig{
+			Name:     name,
+			Provider: ProviderGitLab,
+			Token:    os.Getenv("GITLAB_TOKEN_" + key),
+			Subject:  os.Getenv("NATS_SUBJECT_" + key),
+		})
+	}
+	return groups
+}
+
+// OrgEnvKey returns the environment variable suffix for an organization name
+func OrgEnvKey(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+}
+
+// durationEnv reads a positive duration from the named environment variable
+func durationEnv(name string, def time.Duration) (time.Duration, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid %s %q: must be a positive duration", name, v)
+	}
+	return d, nil
+}
+
+// intEnv reads a positive integer from the named environment variable
+func intEnv(name string, def int) (int, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid %s %q: must be a positive integer", name, v)
+	}
+	return n, nil
+}
+
+// nonNegativeIntEnv reads an optional integer that may be zero from the named
+// environment variable
+func nonNegativeIntEnv(name string, def int) (int, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid %s %q: must be a non-negative integer", name, v)
+	}
+	return n, nil
+}
+
+// int64Env reads an optional positive 64-bit integer, such as a GitHub ID,
+// from the named environment variable
+func int64Env(name string) (int64, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return 0, nil
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid %s %q: must be a positive integer", name, v)
+	}
+	return n, nil
+}
+
+// ratioEnv reads an optional ratio between 0 and 1 from the named environment
+// variable
+func ratioEnv(name string, def float64) (float64, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return def, nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || f < 0 || f > 1 {
+		return 0, fmt.Errorf("invalid %s %q: must be a number between 0 and 1", name, v)
+	}
+	return f, nil
+}
+
+// validateURL checks that the named variable holds an absolute HTTP(S) URL
+func validateURL(name, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid %s %q: must be an absolute http or https URL", name, rawURL)
+	}
+	return nil
+}
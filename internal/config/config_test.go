@@ -1,8 +1,10 @@
 package config
 
 import (
+	"log/slog"
 	"os"
 	"testing"
+	"time"
 )
 
 func TestLoad(t *testing.T) {
@@ -129,10 +131,830 @@ func TestLoad(t *testing.T) {
 	}
 }
 
+func TestLoadJetStream(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+
+	os.Setenv("GITHUB_ORG", "testorg")
+	os.Setenv("GITHUB_TOKEN", "token123")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.NATSJetStream {
+		t.Error("NATSJetStream should be disabled by default")
+	}
+	if cfg.NATSStream != "GITHUB_REPOSITORIES" {
+		t.Errorf("NATSStream = %v, want %v", cfg.NATSStream, "GITHUB_REPOSITORIES")
+	}
+	if cfg.NATSDuplicateWindow != time.Hour {
+		t.Errorf("NATSDuplicateWindow = %v, want %v", cfg.NATSDuplicateWindow, time.Hour)
+	}
+
+	os.Setenv("NATS_JETSTREAM", "true")
+	os.Setenv("NATS_STREAM", "REPOS")
+	os.Setenv("NATS_DUPLICATE_WINDOW", "30m")
+
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if !cfg.NATSJetStream {
+		t.Error("NATSJetStream should be enabled")
+	}
+	if cfg.NATSStream != "REPOS" {
+		t.Errorf("NATSStream = %v, want %v", cfg.NATSStream, "REPOS")
+	}
+	if cfg.NATSDuplicateWindow != 30*time.Minute {
+		t.Errorf("NATSDuplicateWindow = %v, want %v", cfg.NATSDuplicateWindow, 30*time.Minute)
+	}
+
+	os.Setenv("NATS_DUPLICATE_WINDOW", "soon")
+	if _, err := Load(); err == nil {
+		t.Error("Load() expected error for invalid NATS_DUPLICATE_WINDOW, got nil")
+	}
+}
+
+func TestLoadConsumer(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+
+	os.Setenv("GITHUB_ORG", "testorg")
+	os.Setenv("GITHUB_TOKEN", "token123")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.ConsumerName != "secflow-validator" {
+		t.Errorf("ConsumerName = %v, want %v", cfg.ConsumerName, "secflow-validator")
+	}
+	if cfg.ConsumerMaxDeliver != 5 {
+		t.Errorf("ConsumerMaxDeliver = %v, want %v", cfg.ConsumerMaxDeliver, 5)
+	}
+	if cfg.ConsumerAckWait != 30*time.Second {
+		t.Errorf("ConsumerAckWait = %v, want %v", cfg.ConsumerAckWait, 30*time.Second)
+	}
+	if cfg.WorkerPoolSize != 10 {
+		t.Errorf("WorkerPoolSize = %v, want %v", cfg.WorkerPoolSize, 10)
+	}
+	if cfg.WorkerQueueSize != 100 {
+		t.Errorf("WorkerQueueSize = %v, want %v", cfg.WorkerQueueSize, 100)
+	}
+
+	os.Setenv("VALIDATOR_CONSUMER", "validator-eu")
+	os.Setenv("CONSUMER_MAX_DELIVER", "10")
+	os.Setenv("CONSUMER_ACK_WAIT", "2m")
+	os.Setenv("WORKER_POOL_SIZE", "4")
+	os.Setenv("WORKER_QUEUE_SIZE", "8")
+
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.ConsumerName != "validator-eu" {
+		t.Errorf("ConsumerName = %v, want %v", cfg.ConsumerName, "validator-eu")
+	}
+	if cfg.ConsumerMaxDeliver != 10 {
+		t.Errorf("ConsumerMaxDeliver = %v, want %v", cfg.ConsumerMaxDeliver, 10)
+	}
+	if cfg.ConsumerAckWait != 2*time.Minute {
+		t.Errorf("ConsumerAckWait = %v, want %v", cfg.ConsumerAckWait, 2*time.Minute)
+	}
+	if cfg.WorkerPoolSize != 4 {
+		t.Errorf("WorkerPoolSize = %v, want %v", cfg.WorkerPoolSize, 4)
+	}
+	if cfg.WorkerQueueSize != 8 {
+		t.Errorf("WorkerQueueSize = %v, want %v", cfg.WorkerQueueSize, 8)
+	}
+
+	os.Setenv("CONSUMER_MAX_DELIVER", "0")
+	if _, err := Load(); err == nil {
+		t.Error("Load() expected error for invalid CONSUMER_MAX_DELIVER, got nil")
+	}
+}
+
+func TestLoadCheckRetry(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+
+	os.Setenv("GITHUB_ORG", "testorg")
+	os.Setenv("GITHUB_TOKEN", "token123")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.DeadLetterSubject != "repos.deadletter" {
+		t.Errorf("DeadLetterSubject = %v, want %v", cfg.DeadLetterSubject, "repos.deadletter")
+	}
+	if cfg.CheckMaxAttempts != 4 {
+		t.Errorf("CheckMaxAttempts = %v, want %v", cfg.CheckMaxAttempts, 4)
+	}
+	if cfg.CheckRetryBackoff != time.Second {
+		t.Errorf("CheckRetryBackoff = %v, want %v", cfg.CheckRetryBackoff, time.Second)
+	}
+	if cfg.CheckRetryMaxBackoff != 30*time.Second {
+		t.Errorf("CheckRetryMaxBackoff = %v, want %v", cfg.CheckRetryMaxBackoff, 30*time.Second)
+	}
+
+	os.Setenv("DEAD_LETTER_SUBJECT", "repos.failed")
+	os.Setenv("CHECK_MAX_ATTEMPTS", "2")
+	os.Setenv("CHECK_RETRY_BACKOFF", "500ms")
+	os.Setenv("CHECK_RETRY_MAX_BACKOFF", "5s")
+
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.DeadLetterSubject != "repos.failed" {
+		t.Errorf("DeadLetterSubject = %v, want %v", cfg.DeadLetterSubject, "repos.failed")
+	}
+	if cfg.CheckMaxAttempts != 2 {
+		t.Errorf("CheckMaxAttempts = %v, want %v", cfg.CheckMaxAttempts, 2)
+	}
+	if cfg.CheckRetryBackoff != 500*time.Millisecond {
+		t.Errorf("CheckRetryBackoff = %v, want %v", cfg.CheckRetryBackoff, 500*time.Millisecond)
+	}
+	if cfg.CheckRetryMaxBackoff != 5*time.Second {
+		t.Errorf("CheckRetryMaxBackoff = %v, want %v", cfg.CheckRetryMaxBackoff, 5*time.Second)
+	}
+}
+
+func TestLoadState(t *testing.T) {
+	tests := []struct {
+		name    string
+		envVars map[string]string
+		wantErr bool
+	}{
+		{
+			name:    "no state backend",
+			envVars: map[string]string{},
+		},
+		{
+			name: "file backend with incremental schedule",
+			envVars: map[string]string{
+				"STATE_BACKEND":             "file",
+				"STATE_FILE":                "/data/state.json",
+				"INCREMENTAL_CRON_SCHEDULE": "0 * * * *",
+			},
+		},
+		{
+			name: "kv backend",
+			envVars: map[string]string{
+				"STATE_BACKEND": "kv",
+				"STATE_BUCKET":  "scan_state",
+			},
+		},
+		{
+			name: "unknown backend",
+			envVars: map[string]string{
+				"STATE_BACKEND": "redis",
+			},
+			wantErr: true,
+		},
+		{
+			name: "incremental schedule without backend",
+			envVars: map[string]string{
+				"INCREMENTAL_CRON_SCHEDULE": "0 * * * *",
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv()
+			defer clearEnv()
+
+			os.Setenv("GITHUB_ORG", "testorg")
+			os.Setenv("GITHUB_TOKEN", "token123")
+			for k, v := range tt.envVars {
+				os.Setenv(k, v)
+			}
+
+			cfg, err := Load()
+			if tt.wantErr {
+				if err == nil {
+					t.Error("Load() expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load() unexpected error: %v", err)
+			}
+
+			if cfg.StateBackend != tt.envVars["STATE_BACKEND"] {
+				t.Errorf("StateBackend = %v, want %v", cfg.StateBackend, tt.envVars["STATE_BACKEND"])
+			}
+			if want := tt.envVars["STATE_FILE"]; want != "" && cfg.StateFile != want {
+				t.Errorf("StateFile = %v, want %v", cfg.StateFile, want)
+			}
+			if want := tt.envVars["STATE_BUCKET"]; want != "" && cfg.StateBucket != want {
+				t.Errorf("StateBucket = %v, want %v", cfg.StateBucket, want)
+			}
+			if cfg.IncrementalCronSchedule != tt.envVars["INCREMENTAL_CRON_SCHEDULE"] {
+				t.Errorf("IncrementalCronSchedule = %v, want %v", cfg.IncrementalCronSchedule, tt.envVars["INCREMENTAL_CRON_SCHEDULE"])
+			}
+		})
+	}
+}
+
+func TestLoadOrgs(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+
+	os.Setenv("GITHUB_ORGS", "org1, org-two,org1")
+	os.Setenv("GITHUB_TOKEN", "token123")
+	os.Setenv("GITHUB_TOKEN_ORG_TWO", "token456")
+	os.Setenv("NATS_SUBJECT_ORG_TWO", "two.repositories")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+
+	want := []OrgConfig{
+		{Name: "org1"},
+		{Name: "org-two", Token: "token456", Subject: "two.repositories"},
+	}
+	if len(cfg.GitHubOrgs) != len(want) {
+		t.Fatalf("GitHubOrgs = %+v, want %+v", cfg.GitHubOrgs, want)
+	}
+	for i := range want {
+		if cfg.GitHubOrgs[i] != want[i] {
+			t.Errorf("GitHubOrgs[%d] = %+v, want %+v", i, cfg.GitHubOrgs[i], want[i])
+		}
+	}
+	if cfg.GitHubOrg != "org1" {
+		t.Errorf("GitHubOrg = %v, want %v", cfg.GitHubOrg, "org1")
+	}
+
+	// The shared token may be omitted when every organization has its own
+	os.Setenv("GITHUB_ORGS", "org-two")
+	os.Unsetenv("GITHUB_TOKEN")
+	if _, err := Load(); err != nil {
+		t.Errorf("Load() unexpected error: %v", err)
+	}
+
+	os.Setenv("GITHUB_ORGS", "org1,org-two")
+	if _, err := Load(); err == nil {
+		t.Error("Load() expected error for organization without token, got nil")
+	}
+}
+
+func TestLoadGitHubApp(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+
+	os.Setenv("GITHUB_ORGS", "org1,org-two")
+	os.Setenv("GITHUB_APP_ID", "1234")
+	os.Setenv("GITHUB_APP_PRIVATE_KEY_FILE", "/etc/secflow/app.pem")
+	os.Setenv("GITHUB_APP_INSTALLATION_ID", "42")
+	os.Setenv("GITHUB_APP_INSTALLATION_ID_ORG_TWO", "43")
+
+	// No token is required with GitHub App authentication
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.GitHubAppID != 1234 {
+		t.Errorf("GitHubAppID = %v, want %v", cfg.GitHubAppID, 1234)
+	}
+	if cfg.GitHubAppPrivateKeyFile != "/etc/secflow/app.pem" {
+		t.Errorf("GitHubAppPrivateKeyFile = %v, want %v", cfg.GitHubAppPrivateKeyFile, "/etc/secflow/app.pem")
+	}
+	if cfg.GitHubAppInstallationID != 42 {
+		t.Errorf("GitHubAppInstallationID = %v, want %v", cfg.GitHubAppInstallationID, 42)
+	}
+	if cfg.GitHubOrgs[0].InstallationID != 0 || cfg.GitHubOrgs[1].InstallationID != 43 {
+		t.Errorf("GitHubOrgs = %+v, want installation 43 for org-two only", cfg.GitHubOrgs)
+	}
+
+	os.Unsetenv("GITHUB_APP_PRIVATE_KEY_FILE")
+	if _, err := Load(); err == nil {
+		t.Error("Load() expected error without GITHUB_APP_PRIVATE_KEY_FILE, got nil")
+	}
+
+	os.Setenv("GITHUB_APP_PRIVATE_KEY_FILE", "/etc/secflow/app.pem")
+	os.Setenv("GITHUB_APP_ID", "not-a-number")
+	if _, err := Load(); err == nil {
+		t.Error("Load() expected error for invalid GITHUB_APP_ID, got nil")
+	}
+}
+
+func TestLoadEnterprise(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+
+	os.Setenv("GITHUB_ORG", "testorg")
+	os.Setenv("GITHUB_TOKEN", "token123")
+	os.Setenv("GITHUB_API_URL", "https://ghes.example.com/api/v3")
+	os.Setenv("GITHUB_UPLOAD_URL", "https://ghes.example.com/api/uploads")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.GitHubAPIURL != "https://ghes.example.com/api/v3" {
+		t.Errorf("GitHubAPIURL = %v, want %v", cfg.GitHubAPIURL, "https://ghes.example.com/api/v3")
+	}
+	if cfg.GitHubUploadURL != "https://ghes.example.com/api/uploads" {
+		t.Errorf("GitHubUploadURL = %v, want %v", cfg.GitHubUploadURL, "https://ghes.example.com/api/uploads")
+	}
+
+	os.Setenv("GITHUB_API_URL", "ghes.example.com")
+	if _, err := Load(); err == nil {
+		t.Error("Load() expected error for relative GITHUB_API_URL, got nil")
+	}
+
+	os.Unsetenv("GITHUB_API_URL")
+	if _, err := Load(); err == nil {
+		t.Error("Load() expected error for GITHUB_UPLOAD_URL without GITHUB_API_URL, got nil")
+	}
+}
+
+func TestLoadRateLimit(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+
+	os.Setenv("GITHUB_ORG", "testorg")
+	os.Setenv("GITHUB_TOKEN", "token123")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.GitHubRateLimitReserve != 0 || cfg.GitHubRateLimitMaxWait != time.Hour || cfg.GitHubRateLimitRetries != 3 {
+		t.Errorf("rate limit defaults = %d, %v, %d, want 0, 1h, 3",
+			cfg.GitHubRateLimitReserve, cfg.GitHubRateLimitMaxWait, cfg.GitHubRateLimitRetries)
+	}
+
+	os.Setenv("GITHUB_RATE_LIMIT_RESERVE", "100")
+	os.Setenv("GITHUB_RATE_LIMIT_MAX_WAIT", "10m")
+	os.Setenv("GITHUB_RATE_LIMIT_RETRIES", "0")
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.GitHubRateLimitReserve != 100 || cfg.GitHubRateLimitMaxWait != 10*time.Minute || cfg.GitHubRateLimitRetries != 0 {
+		t.Errorf("rate limit settings = %d, %v, %d, want 100, 10m, 0",
+			cfg.GitHubRateLimitReserve, cfg.GitHubRateLimitMaxWait, cfg.GitHubRateLimitRetries)
+	}
+
+	os.Setenv("GITHUB_RATE_LIMIT_RESERVE", "-1")
+	if _, err := Load(); err == nil {
+		t.Error("Load() expected error for negative GITHUB_RATE_LIMIT_RESERVE, got nil")
+	}
+}
+
+func TestLoadCache(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+
+	os.Setenv("GITHUB_ORG", "testorg")
+	os.Setenv("GITHUB_TOKEN", "token123")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.GitHubCache != "" {
+		t.Errorf("GitHubCache = %v, want caching disabled", cfg.GitHubCache)
+	}
+	if cfg.GitHubCacheDir != "secflow-cache" || cfg.GitHubCacheMaxSizeMB != 100 || cfg.GitHubCacheTTL != 8*24*time.Hour {
+		t.Errorf("cache defaults = %v, %d, %v, want secflow-cache, 100, 192h",
+			cfg.GitHubCacheDir, cfg.GitHubCacheMaxSizeMB, cfg.GitHubCacheTTL)
+	}
+
+	os.Setenv("GITHUB_CACHE", "disk")
+	os.Setenv("GITHUB_CACHE_DIR", "/var/cache/secflow")
+	os.Setenv("GITHUB_CACHE_MAX_SIZE_MB", "512")
+	os.Setenv("GITHUB_CACHE_TTL", "24h")
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.GitHubCache != CacheBackendDisk || cfg.GitHubCacheDir != "/var/cache/secflow" ||
+		cfg.GitHubCacheMaxSizeMB != 512 || cfg.GitHubCacheTTL != 24*time.Hour {
+		t.Errorf("cache settings = %v, %v, %d, %v", cfg.GitHubCache, cfg.GitHubCacheDir, cfg.GitHubCacheMaxSizeMB, cfg.GitHubCacheTTL)
+	}
+
+	os.Setenv("GITHUB_CACHE", "redis")
+	if _, err := Load(); err == nil {
+		t.Error("Load() expected error for unsupported GITHUB_CACHE, got nil")
+	}
+}
+
+func TestLoadScanPipeline(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+
+	os.Setenv("GITHUB_ORG", "testorg")
+	os.Setenv("GITHUB_TOKEN", "token123")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.ScanPageConcurrency != 1 || cfg.ScanCheckpointMaxAge != 24*time.Hour {
+		t.Errorf("ScanPageConcurrency = %d, ScanCheckpointMaxAge = %v, want 1 and 24h", cfg.ScanPageConcurrency, cfg.ScanCheckpointMaxAge)
+	}
+
+	os.Setenv("SCAN_PAGE_CONCURRENCY", "4")
+	os.Setenv("SCAN_CHECKPOINT_MAX_AGE", "6h")
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.ScanPageConcurrency != 4 || cfg.ScanCheckpointMaxAge != 6*time.Hour {
+		t.Errorf("ScanPageConcurrency = %d, ScanCheckpointMaxAge = %v, want 4 and 6h", cfg.ScanPageConcurrency, cfg.ScanCheckpointMaxAge)
+	}
+
+	os.Setenv("SCAN_PAGE_CONCURRENCY", "0")
+	if _, err := Load(); err == nil {
+		t.Error("Load() expected error for SCAN_PAGE_CONCURRENCY=0, got nil")
+	}
+}
+
+func TestLoadAdmin(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+
+	os.Setenv("GITHUB_ORG", "testorg")
+	os.Setenv("GITHUB_TOKEN", "token123")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.HTTPAddr != ":8080" || cfg.AdminToken != "" || cfg.ScanTimeout != 30*time.Minute {
+		t.Errorf("HTTPAddr = %q, AdminToken = %q, ScanTimeout = %v, want :8080, none and 30m", cfg.HTTPAddr, cfg.AdminToken, cfg.ScanTimeout)
+	}
+	if cfg.NATSService {
+		t.Error("NATSService = true, want false by default")
+	}
+
+	os.Setenv("HTTP_ADDR", "127.0.0.1:9090")
+	os.Setenv("ADMIN_TOKEN", "secret")
+	os.Setenv("SCAN_TIMEOUT", "2h")
+	os.Setenv("NATS_SERVICE", "true")
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.HTTPAddr != "127.0.0.1:9090" || cfg.AdminToken != "secret" || cfg.ScanTimeout != 2*time.Hour {
+		t.Errorf("HTTPAddr = %q, AdminToken = %q, ScanTimeout = %v", cfg.HTTPAddr, cfg.AdminToken, cfg.ScanTimeout)
+	}
+	if !cfg.NATSService {
+		t.Error("NATSService = false, want true")
+	}
+}
+
+func TestLoadShutdownGracePeriod(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+
+	os.Setenv("GITHUB_ORG", "testorg")
+	os.Setenv("GITHUB_TOKEN", "token123")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.ShutdownGracePeriod != 25*time.Second {
+		t.Errorf("ShutdownGracePeriod = %v, want 25s", cfg.ShutdownGracePeriod)
+	}
+
+	os.Setenv("SHUTDOWN_GRACE_PERIOD", "2m")
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.ShutdownGracePeriod != 2*time.Minute {
+		t.Errorf("ShutdownGracePeriod = %v, want 2m", cfg.ShutdownGracePeriod)
+	}
+
+	os.Setenv("SHUTDOWN_GRACE_PERIOD", "0s")
+	if _, err := Load(); err == nil {
+		t.Error("Load() expected error for SHUTDOWN_GRACE_PERIOD=0s, got nil")
+	}
+}
+
+func TestLoadTracing(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+
+	os.Setenv("GITHUB_ORG", "testorg")
+	os.Setenv("GITHUB_TOKEN", "token123")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.OTLPEndpoint != "" || cfg.TraceSampleRatio != 1 {
+		t.Errorf("OTLPEndpoint = %q, TraceSampleRatio = %v, want none and 1", cfg.OTLPEndpoint, cfg.TraceSampleRatio)
+	}
+
+	os.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://otel-collector:4318")
+	os.Setenv("TRACE_SAMPLE_RATIO", "0.25")
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.OTLPEndpoint != "http://otel-collector:4318" || cfg.TraceSampleRatio != 0.25 {
+		t.Errorf("OTLPEndpoint = %q, TraceSampleRatio = %v", cfg.OTLPEndpoint, cfg.TraceSampleRatio)
+	}
+
+	os.Setenv("TRACE_SAMPLE_RATIO", "1.5")
+	if _, err := Load(); err == nil {
+		t.Error("Load() expected error for TRACE_SAMPLE_RATIO=1.5, got nil")
+	}
+	os.Setenv("TRACE_SAMPLE_RATIO", "1")
+	os.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "otel-collector:4318")
+	if _, err := Load(); err == nil {
+		t.Error("Load() expected error for an OTEL_EXPORTER_OTLP_ENDPOINT without scheme, got nil")
+	}
+}
+
+func TestLoadLogging(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+
+	os.Setenv("GITHUB_ORG", "testorg")
+	os.Setenv("GITHUB_TOKEN", "token123")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.LogLevel != slog.LevelInfo || cfg.LogFormat != LogFormatText {
+		t.Errorf("LogLevel = %v, LogFormat = %q, want INFO and text", cfg.LogLevel, cfg.LogFormat)
+	}
+
+	os.Setenv("LOG_LEVEL", "debug")
+	os.Setenv("LOG_FORMAT", "json")
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.LogLevel != slog.LevelDebug || cfg.LogFormat != LogFormatJSON {
+		t.Errorf("LogLevel = %v, LogFormat = %q, want DEBUG and json", cfg.LogLevel, cfg.LogFormat)
+	}
+
+	os.Setenv("LOG_LEVEL", "verbose")
+	if _, err := Load(); err == nil {
+		t.Error("Load() expected error for LOG_LEVEL=verbose, got nil")
+	}
+	os.Setenv("LOG_LEVEL", "warn")
+	os.Setenv("LOG_FORMAT", "logfmt")
+	if _, err := Load(); err == nil {
+		t.Error("Load() expected error for LOG_FORMAT=logfmt, got nil")
+	}
+}
+
+func TestLoadScanLock(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+
+	os.Setenv("GITHUB_ORG", "testorg")
+	os.Setenv("GITHUB_TOKEN", "token123")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.ScanOverlap != ScanOverlapSkip || cfg.ScanLock || cfg.ScanLockBucket != "secflow_collector_lock" || cfg.ScanLockTTL != 30*time.Second {
+		t.Errorf("defaults = %q, %v, %q, %v", cfg.ScanOverlap, cfg.ScanLock, cfg.ScanLockBucket, cfg.ScanLockTTL)
+	}
+
+	os.Setenv("SCAN_OVERLAP", "queue")
+	os.Setenv("SCAN_LOCK", "true")
+	os.Setenv("SCAN_LOCK_BUCKET", "locks")
+	os.Setenv("SCAN_LOCK_TTL", "1m")
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.ScanOverlap != ScanOverlapQueue || !cfg.ScanLock || cfg.ScanLockBucket != "locks" || cfg.ScanLockTTL != time.Minute {
+		t.Errorf("settings = %q, %v, %q, %v", cfg.ScanOverlap, cfg.ScanLock, cfg.ScanLockBucket, cfg.ScanLockTTL)
+	}
+
+	os.Setenv("SCAN_OVERLAP", "parallel")
+	if _, err := Load(); err == nil {
+		t.Error("Load() expected error for unsupported SCAN_OVERLAP, got nil")
+	}
+}
+
+func TestLoadGitLab(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+
+	os.Setenv("GITLAB_GROUPS", "platform, platform/backend/")
+	os.Setenv("GITLAB_TOKEN", "gl-token")
+	os.Setenv("GITLAB_TOKEN_PLATFORM_BACKEND", "backend-token")
+	os.Setenv("NATS_SUBJECT_PLATFORM", "gitlab.repositories")
+
+	// GitHub settings are not required when only GitLab groups are scanned
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if cfg.GitLabURL != "https://gitlab.com" {
+		t.Errorf("GitLabURL = %v, want %v", cfg.GitLabURL, "https://gitlab.com")
+	}
+	if cfg.GitLabToken != "gl-token" {
+		t.Errorf("GitLabToken = %v, want %v", cfg.GitLabToken, "gl-token")
+	}
+
+	want := []OrgConfig{
+		{Name: "platform", Provider: ProviderGitLab, Subject: "gitlab.repositories"},
+		{Name: "platform/backend", Provider: ProviderGitLab, Token: "backend-token"},
+	}
+	orgs := cfg.Organizations()
+	if len(orgs) != len(want) {
+		t.Fatalf("Organizations() = %+v, want %+v", orgs, want)
+	}
+	for i := range want {
+		if orgs[i] != want[i] {
+			t.Errorf("Organizations()[%d] = %+v, want %+v", i, orgs[i], want[i])
+		}
+	}
+
+	// GitHub organizations are listed before GitLab groups
+	os.Setenv("GITHUB_ORG", "gh-org")
+	os.Setenv("GITHUB_TOKEN", "token123")
+	os.Setenv("GITLAB_URL", "https://gitlab.example.com")
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	orgs = cfg.Organizations()
+	if len(orgs) != 3 || orgs[0].Name != "gh-org" || orgs[0].Provider != ProviderGitHub {
+		t.Errorf("Organizations() = %+v, want gh-org first", orgs)
+	}
+	if cfg.GitLabURL != "https://gitlab.example.com" {
+		t.Errorf("GitLabURL = %v, want %v", cfg.GitLabURL, "https://gitlab.example.com")
+	}
+
+	os.Setenv("GITLAB_URL", "gitlab.example.com")
+	if _, err := Load(); err == nil {
+		t.Error("Load() expected error for relative GITLAB_URL, got nil")
+	}
+}
+
+func TestLoadFilters(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+
+	os.Setenv("GITHUB_ORG", "testorg")
+	os.Setenv("GITHUB_TOKEN", "token123")
+	os.Setenv("FILTER_EXCLUDE_ARCHIVED", "true")
+	os.Setenv("FILTER_EXCLUDE_FORKS", "true")
+	os.Setenv("FILTER_VISIBILITY", "private, internal")
+	os.Setenv("FILTER_LANGUAGES", "Go,Java")
+	os.Setenv("FILTER_EXCLUDE_TOPICS", "deprecated")
+	os.Setenv("FILTER_NAME_EXCLUDE", "sandbox-*,*-demo")
+	os.Setenv("FILTER_NAME_REGEX", "^[a-z]")
+	os.Setenv("FILTER_MIN_SIZE_KB", "1")
+	os.Setenv("FILTER_MAX_PUSHED_AGE", "8760h")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+
+	f := cfg.Filters
+	if !f.ExcludeArchived || !f.ExcludeForks || f.ExcludeTemplates {
+		t.Errorf("Exclude flags = %v %v %v, want true true false", f.ExcludeArchived, f.ExcludeForks, f.ExcludeTemplates)
+	}
+	if len(f.Visibility) != 2 || f.Visibility[1] != "internal" {
+		t.Errorf("Visibility = %v, want [private internal]", f.Visibility)
+	}
+	if len(f.Languages) != 2 || len(f.ExcludeTopics) != 1 || len(f.NameExclude) != 2 {
+		t.Errorf("Filters = %+v", f)
+	}
+	if f.NameRegex != "^[a-z]" || f.MinSizeKB != 1 || f.MaxPushedAge != 8760*time.Hour {
+		t.Errorf("Filters = %+v", f)
+	}
+
+	invalid := map[string]string{
+		"FILTER_VISIBILITY":     "secret",
+		"FILTER_NAME_REGEX":     "[",
+		"FILTER_NAME_INCLUDE":   "[",
+		"FILTER_MAX_PUSHED_AGE": "1y",
+		"FILTER_MAX_SIZE_KB":    "0",
+	}
+	for name, value := range invalid {
+		old := os.Getenv(name)
+		os.Setenv(name, value)
+		if _, err := Load(); err == nil {
+			t.Errorf("Load() expected error for %s=%q, got nil", name, value)
+		}
+		os.Setenv(name, old)
+	}
+}
+
+func TestOrganizations(t *testing.T) {
+	cfg := &Config{GitHubOrg: "single"}
+	orgs := cfg.Organizations()
+	if len(orgs) != 1 || orgs[0].Name != "single" {
+		t.Errorf("Organizations() = %+v, want [single]", orgs)
+	}
+
+	if got := OrgEnvKey("my-org.io"); got != "MY_ORG_IO" {
+		t.Errorf("OrgEnvKey() = %q, want %q", got, "MY_ORG_IO")
+	}
+}
+
+func TestSourceSubjects(t *testing.T) {
+	cfg := &Config{
+		SourceSubject: "github.repositories",
+		GitHubOrgs: []OrgConfig{
+			{Name: "org-one"},
+			{Name: "org-two", Subject: "org-two.repositories"},
+			{Name: "org-three", Subject: "github.repositories"},
+		},
+		GitLabGroups: []OrgConfig{
+			{Name: "platform", Provider: ProviderGitLab, Subject: "platform.repositories"},
+			{Name: "platform/backend", Provider: ProviderGitLab, Subject: "org-two.repositories"},
+		},
+	}
+
+	want := []string{"github.repositories", "org-two.repositories", "platform.repositories"}
+	got := cfg.SourceSubjects()
+	if len(got) != len(want) {
+		t.Fatalf("SourceSubjects() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("SourceSubjects()[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestValidateValidator(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr bool
+	}{
+		{
+			name: "default token",
+			cfg:  Config{GitHubOrg: "org", GitHubToken: "token"},
+		},
+		{
+			name:    "only organization tokens",
+			cfg:     Config{GitHubOrg: "org", GitHubOrgs: []OrgConfig{{Name: "org", Token: "org-token"}}},
+			wantErr: true,
+		},
+		{
+			name: "GitHub App",
+			cfg:  Config{GitHubOrg: "org", GitHubAppID: 1},
+		},
+		{
+			name: "only GitLab groups",
+			cfg:  Config{GitLabGroups: []OrgConfig{{Name: "platform", Provider: ProviderGitLab}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.ValidateValidator()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateValidator() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func clearEnv() {
 	envVars := []string{
 		"GITHUB_ORG", "GITHUB_TOKEN", "NATS_URL",
 		"NATS_SUBJECT", "CRON_SCHEDULE", "RUN_ON_STARTUP",
+		"NATS_JETSTREAM", "NATS_STREAM", "NATS_DUPLICATE_WINDOW",
+		"VALIDATOR_CONSUMER", "CONSUMER_MAX_DELIVER", "CONSUMER_ACK_WAIT",
+		"WORKER_POOL_SIZE", "WORKER_QUEUE_SIZE", "DEAD_LETTER_SUBJECT",
+		"CHECK_MAX_ATTEMPTS", "CHECK_RETRY_BACKOFF", "CHECK_RETRY_MAX_BACKOFF",
+		"INCREMENTAL_CRON_SCHEDULE", "STATE_BACKEND", "STATE_FILE", "STATE_BUCKET",
+		"GITHUB_ORGS", "GITHUB_TOKEN_ORG_TWO", "NATS_SUBJECT_ORG_TWO",
+		"GITHUB_APP_ID", "GITHUB_APP_PRIVATE_KEY_FILE", "GITHUB_APP_INSTALLATION_ID",
+		"GITHUB_APP_INSTALLATION_ID_ORG_TWO", "GITHUB_API_URL", "GITHUB_UPLOAD_URL",
+		"GITLAB_URL", "GITLAB_TOKEN", "GITLAB_GROUPS", "GITLAB_TOKEN_PLATFORM_BACKEND",
+		"NATS_SUBJECT_PLATFORM",
+		"FILTER_EXCLUDE_ARCHIVED", "FILTER_EXCLUDE_FORKS", "FILTER_EXCLUDE_TEMPLATES",
+		"FILTER_VISIBILITY", "FILTER_LANGUAGES", "FILTER_EXCLUDE_LANGUAGES",
+		"FILTER_TOPICS", "FILTER_EXCLUDE_TOPICS", "FILTER_NAME_INCLUDE", "FILTER_NAME_EXCLUDE",
+		"FILTER_NAME_REGEX", "FILTER_NAME_EXCLUDE_REGEX", "FILTER_MIN_SIZE_KB",
+		"FILTER_MAX_SIZE_KB", "FILTER_MAX_PUSHED_AGE",
+		"GITHUB_RATE_LIMIT_RESERVE", "GITHUB_RATE_LIMIT_MAX_WAIT", "GITHUB_RATE_LIMIT_RETRIES",
+		"GITHUB_CACHE", "GITHUB_CACHE_DIR", "GITHUB_CACHE_MAX_SIZE_MB", "GITHUB_CACHE_TTL",
+		"SCAN_PAGE_CONCURRENCY", "SCAN_CHECKPOINT_MAX_AGE", "SCAN_TIMEOUT",
+		"HTTP_ADDR", "ADMIN_TOKEN", "NATS_SERVICE",
+		"SCAN_OVERLAP", "SCAN_LOCK", "SCAN_LOCK_BUCKET", "SCAN_LOCK_TTL",
+		"OTEL_EXPORTER_OTLP_ENDPOINT", "TRACE_SAMPLE_RATIO", "LOG_LEVEL", "LOG_FORMAT",
+		"SHUTDOWN_GRACE_PERIOD",
 	}
 	for _, env := range envVars {
 		os.Unsetenv(env)
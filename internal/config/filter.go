@@ -0,0 +1,100 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// FilterConfig holds the rules that decide which repositories the collector
+// publishes. Zero values disable a rule.
+type FilterConfig struct {
+	ExcludeArchived  bool
+	ExcludeForks     bool
+	ExcludeTemplates bool
+	// Visibility lists the visibilities to keep: public, private or internal
+	Visibility []string
+	// Languages keeps repositories whose primary language is listed
+	Languages        []string
+	ExcludeLanguages []string
+	// Topics keeps repositories with at least one of the listed topics
+	Topics        []string
+	ExcludeTopics []string
+	// NameInclude and NameExclude are glob patterns matched against the
+	// repository name
+	NameInclude      []string
+	NameExclude      []string
+	NameRegex        string
+	NameExcludeRegex string
+	MinSizeKB        int
+	MaxSizeKB        int
+	// MaxPushedAge drops repositories not pushed to within this duration
+	MaxPushedAge time.Duration
+}
+
+// loadFilters reads the FILTER_* environment variables
+func loadFilters() (FilterConfig, error) {
+	f := FilterConfig{
+		ExcludeArchived:  os.Getenv("FILTER_EXCLUDE_ARCHIVED") == "true",
+		ExcludeForks:     os.Getenv("FILTER_EXCLUDE_FORKS") == "true",
+		ExcludeTemplates: os.Getenv("FILTER_EXCLUDE_TEMPLATES") == "true",
+		Visibility:       listEnv("FILTER_VISIBILITY"),
+		Languages:        listEnv("FILTER_LANGUAGES"),
+		ExcludeLanguages: listEnv("FILTER_EXCLUDE_LANGUAGES"),
+		Topics:           listEnv("FILTER_TOPICS"),
+		ExcludeTopics:    listEnv("FILTER_EXCLUDE_TOPICS"),
+		NameInclude:      listEnv("FILTER_NAME_INCLUDE"),
+		NameExclude:      listEnv("FILTER_NAME_EXCLUDE"),
+		NameRegex:        os.Getenv("FILTER_NAME_REGEX"),
+		NameExcludeRegex: os.Getenv("FILTER_NAME_EXCLUDE_REGEX"),
+	}
+
+	var err error
+	if f.MinSizeKB, err = intEnv("FILTER_MIN_SIZE_KB", 0); err != nil {
+		return f, err
+	}
+	if f.MaxSizeKB, err = intEnv("FILTER_MAX_SIZE_KB", 0); err != nil {
+		return f, err
+	}
+	if f.MaxPushedAge, err = durationEnv("FILTER_MAX_PUSHED_AGE", 0); err != nil {
+		return f, err
+	}
+
+	for _, v := range f.Visibility {
+		switch strings.ToLower(v) {
+		case "public", "private", "internal":
+		default:
+			return f, fmt.Errorf("invalid FILTER_VISIBILITY %q: must be public, private or internal", v)
+		}
+	}
+	for _, pattern := range append(append([]string{}, f.NameInclude...), f.NameExclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return f, fmt.Errorf("invalid name filter pattern %q: %w", pattern, err)
+		}
+	}
+	if _, err := regexp.Compile(f.NameRegex); err != nil {
+		return f, fmt.Errorf("invalid FILTER_NAME_REGEX %q: %w", f.NameRegex, err)
+	}
+	if _, err := regexp.Compile(f.NameExcludeRegex); err != nil {
+		return f, fmt.Errorf("invalid FILTER_NAME_EXCLUDE_REGEX %q: %w", f.NameExcludeRegex, err)
+	}
+	if f.MaxSizeKB > 0 && f.MinSizeKB > f.MaxSizeKB {
+		return f, fmt.Errorf("FILTER_MIN_SIZE_KB must not be greater than FILTER_MAX_SIZE_KB")
+	}
+
+	return f, nil
+}
+
+// listEnv reads a comma-separated list from the named environment variable
+func listEnv(name string) []string {
+	var list []string
+	for _, v := range strings.Split(os.Getenv(name), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
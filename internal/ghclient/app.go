@@ -0,0 +1,156 @@
+package ghclient
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/google/go-github/v57/github"
+	"golang.org/x/oauth2"
+)
+
+const (
+	// jwtLifetime is how long an app JWT is valid. GitHub accepts at most
+	// ten minutes.
+	jwtLifetime = 9 * time.Minute
+	// jwtClockSkew backdates the JWT issue time to allow for clock drift
+	jwtClockSkew = time.Minute
+	// jwtRefreshWindow is how long before expiry a new JWT is minted
+	jwtRefreshWindow = time.Minute
+	// installationRefreshWindow is how long before expiry a new installation
+	// token is requested. Installation tokens are valid for an hour.
+	installationRefreshWindow = 5 * time.Minute
+)
+
+// appAuth mints the tokens used to authenticate as a GitHub App
+type appAuth struct {
+	appID int64
+	key   *rsa.PrivateKey
+	now   func() time.Time
+}
+
+// newAppAuth loads the app's private key from a PEM file
+func newAppAuth(appID int64, keyFile string) (*appAuth, error) {
+	data, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read GitHub App private key: %w", err)
+	}
+
+	key, err := parsePrivateKey(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &appAuth{appID: appID, key: key, now: time.Now}, nil
+}
+
+// parsePrivateKey parses a PKCS#1 or PKCS#8 PEM encoded RSA private key
+func parsePrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("failed to decode GitHub App private key: no PEM data found")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse GitHub App private key: %w", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("failed to parse GitHub App private key: not an RSA key")
+	}
+	return key, nil
+}
+
+// jwtSource returns a token source of app JWTs, minting a new one shortly
+// before the current one expires
+func (a *appAuth) jwtSource() oauth2.TokenSource {
+	return oauth2.ReuseTokenSourceWithExpiry(nil, jwtTokenSource{a}, jwtRefreshWindow)
+}
+
+// installationSource returns a token source of installation access tokens,
+// requesting a new one through appClient shortly before the current one
+// expires
+func (a *appAuth) installationSource(appClient *github.Client, installationID int64) oauth2.TokenSource {
+	src := &installationTokenSource{appClient: appClient, installationID: installationID}
+	return oauth2.ReuseTokenSourceWithExpiry(nil, src, installationRefreshWindow)
+}
+
+// signJWT returns an RS256 signed JWT identifying the app and its expiry
+func (a *appAuth) signJWT() (string, time.Time, error) {
+	now := a.now()
+	expiresAt := now.Add(jwtLifetime)
+
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	claims, err := json.Marshal(map[string]interface{}{
+		"iat": now.Add(-jwtClockSkew).Unix(),
+		"exp": expiresAt.Unix(),
+		"iss": strconv.FormatInt(a.appID, 10),
+	})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, a.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to sign GitHub App JWT: %w", err)
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), expiresAt, nil
+}
+
+// jwtTokenSource mints app JWTs
+type jwtTokenSource struct {
+	app *appAuth
+}
+
+// Token returns a freshly signed app JWT
+func (s jwtTokenSource) Token() (*oauth2.Token, error) {
+	jwt, expiresAt, err := s.app.signJWT()
+	if err != nil {
+		return nil, err
+	}
+	return &oauth2.Token{AccessToken: jwt, TokenType: "Bearer", Expiry: expiresAt}, nil
+}
+
+// installationTokenSource requests installation access tokens
+type installationTokenSource struct {
+	appClient      *github.Client
+	installationID int64
+}
+
+// Token requests a new installation access token
+func (s *installationTokenSource) Token() (*oauth2.Token, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	token, _, err := s.appClient.Apps.CreateInstallationToken(ctx, s.installationID, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create installation token for installation %d: %w", s.installationID, err)
+	}
+
+	return &oauth2.Token{
+		AccessToken: token.GetToken(),
+		TokenType:   "Bearer",
+		Expiry:      token.GetExpiresAt().Time,
+	}, nil
+}
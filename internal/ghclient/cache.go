@@ -0,0 +1,350 @@
+package ghclient
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// headerFromCache marks responses served from the cache. go-github does not
+// update its rate limits from such responses.
+const headerFromCache = "X-From-Cache"
+
+// CacheStats describes the response cache
+type CacheStats struct {
+	// Hits counts requests answered with 304 Not Modified and served from
+	// the cache, Misses requests that downloaded a full response
+	Hits      int64
+	Misses    int64
+	Evictions int64
+	Entries   int
+	SizeBytes int64
+}
+
+// cacheEntry is a cached response
+type cacheEntry struct {
+	Key        string      `json:"key"`
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header"`
+	Body       []byte      `json:"body"`
+	StoredAt   time.Time   `json:"stored_at"`
+}
+
+// size returns the approximate memory used by the entry
+func (e *cacheEntry) size() int64 {
+	size := int64(len(e.Key) + len(e.Body))
+	for name, values := range e.Header {
+		for _, v := range values {
+			size += int64(len(name) + len(v))
+		}
+	}
+	return size
+}
+
+// cacheItem is the index entry of a cached response. For the disk backend
+// the entry itself is only kept on disk.
+type cacheItem struct {
+	key      string
+	size     int64
+	storedAt time.Time
+	entry    *cacheEntry
+}
+
+// responseCache stores GitHub API responses by request, in memory or in a
+// directory, evicting the least recently used responses beyond maxSize and
+// responses older than ttl
+type responseCache struct {
+	// dir holds the cached responses, or is empty to keep them in memory
+	dir     string
+	maxSize int64
+	ttl     time.Duration
+	now     func() time.Time
+
+	mu    sync.Mutex
+	lru   *list.List
+	items map[string]*list.Element
+	size  int64
+	stats CacheStats
+}
+
+// newResponseCache creates an in-memory cache, or a disk cache in dir that
+// picks up the responses cached by earlier runs
+func newResponseCache(dir string, maxSize int64, ttl time.Duration) (*responseCache, error) {
+	c := &responseCache{
+		dir:     dir,
+		maxSize: maxSize,
+		ttl:     ttl,
+		now:     time.Now,
+		lru:     list.New(),
+		items:   make(map[string]*list.Element),
+	}
+	if dir == "" {
+		return c, nil
+	}
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list cache directory: %w", err)
+	}
+
+	var items []*cacheItem
+	for _, file := range files {
+		entry, err := readCacheEntry(file)
+		if err != nil {
+			slog.Warn("Removing unreadable cache entry", "file", file, "error", err)
+			_ = os.Remove(file)
+			continue
+		}
+		items = append(items, &cacheItem{key: entry.Key, size: entry.size(), storedAt: entry.StoredAt})
+	}
+	// The oldest entries are evicted first
+	sort.Slice(items, func(i, j int) bool { return items[i].storedAt.Before(items[j].storedAt) })
+	for _, item := range items {
+		c.items[item.key] = c.lru.PushFront(item)
+		c.size += item.size
+	}
+	c.evict()
+	return c, nil
+}
+
+// get returns the cached response for key
+func (c *responseCache) get(key string) (*cacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	item := elem.Value.(*cacheItem)
+	if c.now().Sub(item.storedAt) > c.ttl {
+		c.remove(elem)
+		return nil, false
+	}
+
+	var entry *cacheEntry
+	if c.dir != "" {
+		var err error
+		if entry, err = readCacheEntry(c.path(key)); err != nil {
+			slog.Warn("Failed to read cache entry", "error", err)
+			c.remove(elem)
+			return nil, false
+		}
+	} else {
+		// Callers may update the headers of the returned entry
+		copied := *item.entry
+		copied.Header = item.entry.Header.Clone()
+		entry = &copied
+	}
+	c.lru.MoveToFront(elem)
+	return entry, true
+}
+
+// set stores the response for key
+func (c *responseCache) set(entry *cacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[entry.Key]; ok {
+		c.remove(elem)
+	}
+
+	item := &cacheItem{key: entry.Key, size: entry.size(), storedAt: entry.StoredAt}
+	if item.size > c.maxSize {
+		return
+	}
+	if c.dir != "" {
+		if err := writeCacheEntry(c.path(entry.Key), entry); err != nil {
+			slog.Warn("Failed to write cache entry", "error", err)
+			return
+		}
+	} else {
+		item.entry = entry
+	}
+
+	c.items[entry.Key] = c.lru.PushFront(item)
+	c.size += item.size
+	c.evict()
+}
+
+// evict removes the least recently used responses until the cache fits in
+// maxSize
+func (c *responseCache) evict() {
+	for c.size > c.maxSize {
+		c.remove(c.lru.Back())
+		c.stats.Evictions++
+	}
+}
+
+// remove drops a response from the cache
+func (c *responseCache) remove(elem *list.Element) {
+	item := c.lru.Remove(elem).(*cacheItem)
+	delete(c.items, item.key)
+	c.size -= item.size
+	if c.dir != "" {
+		_ = os.Remove(c.path(item.key))
+	}
+}
+
+// count increments the hit or miss counter
+func (c *responseCache) count(hit bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if hit {
+		c.stats.Hits++
+	} else {
+		c.stats.Misses++
+	}
+}
+
+// Stats returns the cache counters and size
+func (c *responseCache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.Entries = len(c.items)
+	stats.SizeBytes = c.size
+	return stats
+}
+
+// path returns the file holding the response for key
+func (c *responseCache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+// readCacheEntry reads a cached response from file
+func readCacheEntry(file string) (*cacheEntry, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// writeCacheEntry writes a cached response to file, replacing it atomically
+func writeCacheEntry(file string, entry *cacheEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+// cacheTransport sends conditional requests for responses in the cache and
+// serves 304 Not Modified responses from it. Conditional requests answered
+// with 304 do not count against the GitHub rate limit.
+type cacheTransport struct {
+	// name is the client the transport belongs to. Responses are only
+	// shared between requests made with the same credentials.
+	name  string
+	base  http.RoundTripper
+	cache *responseCache
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *cacheTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet || req.Header.Get("If-None-Match") != "" || req.Header.Get("If-Modified-Since") != "" {
+		return t.base.RoundTrip(req)
+	}
+
+	key := t.name + " " + req.Header.Get("Accept") + " " + req.URL.String()
+	cached, ok := t.cache.get(key)
+	if ok {
+		req = req.Clone(req.Context())
+		if etag := cached.Header.Get("ETag"); etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		if modified := cached.Header.Get("Last-Modified"); modified != "" {
+			req.Header.Set("If-Modified-Since", modified)
+		}
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if ok && resp.StatusCode == http.StatusNotModified {
+		t.cache.count(true)
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+
+		// The 304 carries the current rate limit and validators
+		for name, values := range resp.Header {
+			if name != "Content-Length" {
+				cached.Header[name] = values
+			}
+		}
+		cached.StoredAt = t.cache.now()
+		t.cache.set(cached)
+
+		header := cached.Header.Clone()
+		header.Set(headerFromCache, "1")
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", cached.StatusCode, http.StatusText(cached.StatusCode)),
+			StatusCode:    cached.StatusCode,
+			Proto:         resp.Proto,
+			ProtoMajor:    resp.ProtoMajor,
+			ProtoMinor:    resp.ProtoMinor,
+			Header:        header,
+			Body:          io.NopCloser(bytes.NewReader(cached.Body)),
+			ContentLength: int64(len(cached.Body)),
+			Request:       req,
+		}, nil
+	}
+
+	t.cache.count(false)
+	if resp.StatusCode != http.StatusOK || !cacheable(resp) {
+		return resp, nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	t.cache.set(&cacheEntry{
+		Key:        key,
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header.Clone(),
+		Body:       body,
+		StoredAt:   t.cache.now(),
+	})
+	return resp, nil
+}
+
+// cacheable reports whether resp can be revalidated with a conditional
+// request and may be stored
+func cacheable(resp *http.Response) bool {
+	if resp.Header.Get("ETag") == "" && resp.Header.Get("Last-Modified") == "" {
+		return false
+	}
+	return !strings.Contains(resp.Header.Get("Cache-Control"), "no-store")
+}
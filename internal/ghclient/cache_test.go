@@ -0,0 +1,208 @@
+package ghclient
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v57/github"
+	"github.com/klimeurt/secflow-collector/internal/config"
+)
+
+func TestCacheTransport(t *testing.T) {
+	for _, backend := range []string{config.CacheBackendMemory, config.CacheBackendDisk} {
+		t.Run(backend, func(t *testing.T) {
+			var full, notModified int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set(headerRateRemaining, "4999")
+				w.Header().Set(headerRateLimit, "5000")
+				if r.Header.Get("If-None-Match") == `"v1"` {
+					atomic.AddInt32(&notModified, 1)
+					w.WriteHeader(http.StatusNotModified)
+					return
+				}
+				atomic.AddInt32(&full, 1)
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("ETag", `"v1"`)
+				_ = json.NewEncoder(w).Encode([]map[string]interface{}{{"id": 1, "name": "repo-1"}})
+			}))
+			defer server.Close()
+
+			cfg := &config.Config{
+				GitHubToken:          "token",
+				GitHubCache:          backend,
+				GitHubCacheDir:       t.TempDir(),
+				GitHubCacheMaxSizeMB: 1,
+				GitHubCacheTTL:       time.Hour,
+			}
+			f := newTestFactory(t, cfg, server.URL)
+
+			for i := 0; i < 3; i++ {
+				repos, resp, err := f.Default().Repositories.ListByOrg(context.Background(), "testorg", nil)
+				if err != nil {
+					t.Fatalf("ListByOrg() unexpected error: %v", err)
+				}
+				if len(repos) != 1 || repos[0].GetName() != "repo-1" {
+					t.Errorf("ListByOrg() = %v, want repo-1", repos)
+				}
+				if fromCache := resp.Header.Get(headerFromCache) != ""; fromCache != (i > 0) {
+					t.Errorf("request %d: served from cache = %v, want %v", i+1, fromCache, i > 0)
+				}
+			}
+
+			if full != 1 || notModified != 2 {
+				t.Errorf("full responses = %d, 304 responses = %d, want 1 and 2", full, notModified)
+			}
+			stats, ok := f.CacheStats()
+			if !ok {
+				t.Fatal("CacheStats() reports caching disabled")
+			}
+			if stats.Hits != 2 || stats.Misses != 1 || stats.Entries != 1 {
+				t.Errorf("CacheStats() = %+v, want 2 hits, 1 miss and 1 entry", stats)
+			}
+		})
+	}
+}
+
+func TestCacheTransportNotCacheable(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if r.Header.Get("If-None-Match") != "" {
+			t.Errorf("Unexpected conditional request")
+		}
+		if strings.HasSuffix(r.URL.Path, "/missing") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		// No validator to revalidate with
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	f := newTestFactory(t, &config.Config{
+		GitHubToken:          "token",
+		GitHubCache:          config.CacheBackendMemory,
+		GitHubCacheMaxSizeMB: 1,
+		GitHubCacheTTL:       time.Hour,
+	}, server.URL)
+
+	for i := 0; i < 2; i++ {
+		_, _, _ = f.Default().Organizations.Get(context.Background(), "testorg")
+		_, _, _ = f.Default().Organizations.Get(context.Background(), "missing")
+	}
+	if requests != 4 {
+		t.Errorf("requests = %d, want 4", requests)
+	}
+	if stats, _ := f.CacheStats(); stats.Entries != 0 || stats.Misses != 4 {
+		t.Errorf("CacheStats() = %+v, want no entries and 4 misses", stats)
+	}
+
+	if _, ok := newTestFactory(t, &config.Config{GitHubToken: "token"}, server.URL).CacheStats(); ok {
+		t.Error("CacheStats() reports caching enabled without GITHUB_CACHE")
+	}
+}
+
+func TestResponseCache(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Unix(1700000000, 0)
+
+	entry := func(key string, size int) *cacheEntry {
+		return &cacheEntry{Key: key, StatusCode: http.StatusOK, Header: http.Header{}, Body: make([]byte, size), StoredAt: now}
+	}
+
+	cache, err := newResponseCache(dir, 2500, time.Hour)
+	if err != nil {
+		t.Fatalf("newResponseCache() unexpected error: %v", err)
+	}
+	cache.now = func() time.Time { return now }
+
+	cache.set(entry("a", 1000))
+	cache.set(entry("b", 1000))
+	if _, ok := cache.get("a"); !ok {
+		t.Fatal("get(a) missing")
+	}
+	// b is now the least recently used response
+	cache.set(entry("c", 1000))
+	if _, ok := cache.get("b"); ok {
+		t.Error("get(b) found an evicted response")
+	}
+	if stats := cache.Stats(); stats.Evictions != 1 || stats.Entries != 2 {
+		t.Errorf("Stats() = %+v, want 1 eviction and 2 entries", stats)
+	}
+
+	// Responses that do not fit are not stored
+	cache.set(entry("d", 5000))
+	if _, ok := cache.get("d"); ok {
+		t.Error("get(d) found a response larger than the cache")
+	}
+
+	// A disk cache picks up the responses of an earlier run
+	reopened, err := newResponseCache(dir, 2500, time.Hour)
+	if err != nil {
+		t.Fatalf("newResponseCache() unexpected error: %v", err)
+	}
+	reopened.now = func() time.Time { return now }
+	if got, ok := reopened.get("c"); !ok || len(got.Body) != 1000 {
+		t.Errorf("get(c) after reopening = %v, %v, want the stored response", got, ok)
+	}
+
+	// Responses older than the TTL are dropped
+	reopened.now = func() time.Time { return now.Add(2 * time.Hour) }
+	if _, ok := reopened.get("a"); ok {
+		t.Error("get(a) found an expired response")
+	}
+	if stats := reopened.Stats(); stats.Entries != 1 {
+		t.Errorf("Stats() = %+v, want 1 entry", stats)
+	}
+}
+
+func TestCacheKeyPerClient(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if r.Header.Get("If-None-Match") != "" {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		_ = json.NewEncoder(w).Encode(&github.Repository{Name: github.String(r.Header.Get("Authorization"))})
+	}))
+	defer server.Close()
+
+	f := newTestFactory(t, &config.Config{
+		GitHubToken:          "default-token",
+		GitHubOrgs:           []config.OrgConfig{{Name: "other", Token: "other-token"}},
+		GitHubCache:          config.CacheBackendMemory,
+		GitHubCacheMaxSizeMB: 1,
+		GitHubCacheTTL:       time.Hour,
+	}, server.URL)
+	other, err := f.ForOrg(context.Background(), "other")
+	if err != nil {
+		t.Fatalf("ForOrg() unexpected error: %v", err)
+	}
+
+	// Responses fetched with one token are not served to another
+	repo, _, err := f.Default().Repositories.Get(context.Background(), "other", "repo")
+	if err != nil {
+		t.Fatalf("Get() unexpected error: %v", err)
+	}
+	if repo.GetName() != "Bearer default-token" {
+		t.Errorf("default client got %q", repo.GetName())
+	}
+	repo, _, err = other.Repositories.Get(context.Background(), "other", "repo")
+	if err != nil {
+		t.Fatalf("Get() unexpected error: %v", err)
+	}
+	if repo.GetName() != "Bearer other-token" {
+		t.Errorf("organization client got %q", repo.GetName())
+	}
+	if requests != 2 {
+		t.Errorf("requests = %d, want 2", requests)
+	}
+}
@@ -0,0 +1,254 @@
+// Package ghclient creates the GitHub clients shared by the collector and the
+// validator.
+package ghclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+
+	"github.com/google/go-github/v57/github"
+	"github.com/klimeurt/secflow-collector/internal/config"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/oauth2"
+)
+
+// Factory creates GitHub clients authenticated either with personal access
+// tokens or as a GitHub App installation. Clients are cached per
+// organization.
+type Factory struct {
+	config    *config.Config
+	transport http.RoundTripper
+	// baseURL and uploadURL point clients at a GitHub Enterprise Server
+	// instance, and are nil for github.com
+	baseURL   *url.URL
+	uploadURL *url.URL
+
+	// defaultClient is authenticated with GitHubToken, or as the app itself
+	// when GitHub App authentication is configured
+	defaultClient *github.Client
+	app           *appAuth
+	// requests counts the requests sent by every client
+	requests *prometheus.CounterVec
+
+	mu      sync.Mutex
+	clients map[string]*github.Client
+	// limiters tracks the rate limits of every client created
+	limiters []*rateLimitTransport
+	// cache holds GitHub API responses, and is nil when caching is disabled
+	cache *responseCache
+}
+
+// NewFactory creates a client factory for the configured authentication
+func NewFactory(cfg *config.Config) (*Factory, error) {
+	f := &Factory{
+		config:    cfg,
+		transport: http.DefaultTransport,
+		requests:  newRequestsCounter(),
+		clients:   make(map[string]*github.Client),
+	}
+
+	if cfg.GitHubAPIURL != "" {
+		if err := f.setEnterpriseURLs(cfg.GitHubAPIURL, cfg.GitHubUploadURL); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.GitHubCache != "" {
+		// An empty directory keeps the responses in memory
+		var dir string
+		if cfg.GitHubCache == config.CacheBackendDisk {
+			dir = cfg.GitHubCacheDir
+		}
+		cache, err := newResponseCache(dir, int64(cfg.GitHubCacheMaxSizeMB)<<20, cfg.GitHubCacheTTL)
+		if err != nil {
+			return nil, err
+		}
+		f.cache = cache
+	}
+
+	if cfg.GitHubAppID != 0 {
+		app, err := newAppAuth(cfg.GitHubAppID, cfg.GitHubAppPrivateKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		f.app = app
+		f.defaultClient = f.newClient("default", app.jwtSource())
+		return f, nil
+	}
+
+	f.defaultClient = f.newClient("default", staticTokenSource(cfg.GitHubToken))
+	return f, nil
+}
+
+// Default returns the client used when no organization-specific client
+// applies. With GitHub App authentication it is authenticated as the app and
+// can only call the app endpoints.
+func (f *Factory) Default() *github.Client {
+	return f.defaultClient
+}
+
+// ForOrg returns the client for repositories owned by org. With personal
+// access tokens this is a client for the organization's token override, or
+// the default client. With GitHub App authentication it is a client for the
+// organization's installation, whose token is refreshed before it expires.
+func (f *Factory) ForOrg(ctx context.Context, org string) (*github.Client, error) {
+	if client, ok := f.cachedClient(org); ok {
+		return client, nil
+	}
+
+	// The installation is looked up without holding the lock, as the
+	// lookup may wait out a rate limit. Concurrent first calls for the same
+	// organization may both look it up; the first client saved is kept.
+	orgCfg := f.orgConfig(org)
+	var installationID int64
+	if orgCfg.Token == "" && f.app != nil {
+		id, err := f.installationID(ctx, orgCfg)
+		if err != nil {
+			return nil, err
+		}
+		installationID = id
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if client, ok := f.clients[org]; ok {
+		return client, nil
+	}
+
+	var client *github.Client
+	switch {
+	case orgCfg.Token != "":
+		client = f.newClient(org, staticTokenSource(orgCfg.Token))
+	case f.app != nil:
+		client = f.newClient(org, f.app.installationSource(f.defaultClient, installationID))
+	default:
+		client = f.defaultClient
+	}
+
+	f.clients[org] = client
+	return client, nil
+}
+
+// cachedClient returns the client already created for org
+func (f *Factory) cachedClient(org string) (*github.Client, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	client, ok := f.clients[org]
+	return client, ok
+}
+
+// RateLimits returns the rate limits seen by each client, sorted by client
+func (f *Factory) RateLimits() []RateLimitStats {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	stats := make([]RateLimitStats, 0, len(f.limiters))
+	for _, limiter := range f.limiters {
+		stats = append(stats, limiter.Stats())
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Client < stats[j].Client })
+	return stats
+}
+
+// CacheStats returns the hit and miss counts and size of the response cache,
+// and false when caching is disabled
+func (f *Factory) CacheStats() (CacheStats, bool) {
+	if f.cache == nil {
+		return CacheStats{}, false
+	}
+	return f.cache.Stats(), true
+}
+
+// orgConfig returns the configuration of org, or an empty configuration for
+// owners that are not configured, such as those seen by the validator
+func (f *Factory) orgConfig(org string) config.OrgConfig {
+	for _, o := range f.config.Organizations() {
+		if o.Provider == config.ProviderGitHub && o.Name == org {
+			return o
+		}
+	}
+	return config.OrgConfig{Name: org}
+}
+
+// installationID returns the app installation for an organization, either
+// from the configuration or by looking it up
+func (f *Factory) installationID(ctx context.Context, org config.OrgConfig) (int64, error) {
+	if org.InstallationID != 0 {
+		return org.InstallationID, nil
+	}
+	if f.config.GitHubAppInstallationID != 0 {
+		return f.config.GitHubAppInstallationID, nil
+	}
+
+	installation, _, err := f.defaultClient.Apps.FindOrganizationInstallation(ctx, org.Name)
+	if err != nil {
+		// The owner may be a user rather than an organization
+		var userErr error
+		installation, _, userErr = f.defaultClient.Apps.FindUserInstallation(ctx, org.Name)
+		if userErr != nil {
+			return 0, fmt.Errorf("failed to find GitHub App installation for %s: %w", org.Name, err)
+		}
+	}
+	return installation.GetID(), nil
+}
+
+// newClient creates a GitHub client called name authenticated by ts. Rate
+// limits are handled above the authentication so that requests retried after
+// a long wait use a fresh token, and see the quota reported by conditional
+// requests answered from the cache.
+func (f *Factory) newClient(name string, ts oauth2.TokenSource) *github.Client {
+	var transport http.RoundTripper = &oauth2.Transport{
+		Source: ts,
+		Base:   &metricsTransport{name: name, base: f.transport, requests: f.requests},
+	}
+	if f.cache != nil {
+		transport = &cacheTransport{name: name, base: transport, cache: f.cache}
+	}
+
+	limiter := newRateLimitTransport(name, transport,
+		f.config.GitHubRateLimitReserve, f.config.GitHubRateLimitMaxWait, f.config.GitHubRateLimitRetries)
+	f.limiters = append(f.limiters, limiter)
+
+	client := github.NewClient(&http.Client{Transport: limiter})
+	if f.baseURL != nil {
+		u := *f.baseURL
+		client.BaseURL = &u
+	}
+	if f.uploadURL != nil {
+		u := *f.uploadURL
+		client.UploadURL = &u
+	}
+	return client
+}
+
+// setEnterpriseURLs points every client at a GitHub Enterprise Server
+// instance. The API path (/api/v3/) and upload path (/api/uploads/) are
+// appended when missing, and the upload URL defaults to the API host.
+func (f *Factory) setEnterpriseURLs(apiURL, uploadURL string) error {
+	if uploadURL == "" {
+		u, err := url.Parse(apiURL)
+		if err != nil {
+			return fmt.Errorf("failed to parse GitHub API URL: %w", err)
+		}
+		u.Path = ""
+		uploadURL = u.String()
+	}
+
+	client, err := github.NewClient(nil).WithEnterpriseURLs(apiURL, uploadURL)
+	if err != nil {
+		return fmt.Errorf("failed to configure GitHub Enterprise URLs: %w", err)
+	}
+	f.baseURL = client.BaseURL
+	f.uploadURL = client.UploadURL
+	return nil
+}
+
+// staticTokenSource returns a token source for a personal access token
+func staticTokenSource(token string) oauth2.TokenSource {
+	return oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token})
+}
@@ -0,0 +1,415 @@
+package ghclient
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/klimeurt/secflow-collector/internal/config"
+)
+
+func TestSignJWT(t *testing.T) {
+	key, keyFile := writePrivateKey(t)
+
+	app, err := newAppAuth(1234, keyFile)
+	if err != nil {
+		t.Fatalf("newAppAuth() unexpected error: %v", err)
+	}
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	app.now = func() time.Time { return now }
+
+	jwt, expiresAt, err := app.signJWT()
+	if err != nil {
+		t.Fatalf("signJWT() unexpected error: %v", err)
+	}
+	if !expiresAt.Equal(now.Add(jwtLifetime)) {
+		t.Errorf("expiresAt = %v, want %v", expiresAt, now.Add(jwtLifetime))
+	}
+
+	parts := strings.Split(jwt, ".")
+	if len(parts) != 3 {
+		t.Fatalf("JWT has %d parts, want 3", len(parts))
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		t.Fatalf("Failed to decode signature: %v", err)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], signature); err != nil {
+		t.Errorf("Signature does not verify: %v", err)
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		t.Fatalf("Failed to decode claims: %v", err)
+	}
+	var claims struct {
+		IssuedAt  int64  `json:"iat"`
+		ExpiresAt int64  `json:"exp"`
+		Issuer    string `json:"iss"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		t.Fatalf("Failed to unmarshal claims: %v", err)
+	}
+	if claims.Issuer != "1234" {
+		t.Errorf("iss = %v, want %v", claims.Issuer, "1234")
+	}
+	if claims.IssuedAt != now.Add(-jwtClockSkew).Unix() {
+		t.Errorf("iat = %v, want %v", claims.IssuedAt, now.Add(-jwtClockSkew).Unix())
+	}
+	if claims.ExpiresAt != now.Add(jwtLifetime).Unix() {
+		t.Errorf("exp = %v, want %v", claims.ExpiresAt, now.Add(jwtLifetime).Unix())
+	}
+}
+
+func TestParsePrivateKey(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+
+	if _, err := parsePrivateKey(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8})); err != nil {
+		t.Errorf("parsePrivateKey() unexpected error for PKCS#8 key: %v", err)
+	}
+	if _, err := parsePrivateKey([]byte("not a key")); err == nil {
+		t.Error("parsePrivateKey() expected error for invalid key, got nil")
+	}
+}
+
+func TestForOrgInstallationToken(t *testing.T) {
+	_, keyFile := writePrivateKey(t)
+
+	var mu sync.Mutex
+	tokenRequests := 0
+	var repoAuth []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.URL.Path == "/orgs/acme/installation":
+			if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ey") {
+				t.Errorf("Installation lookup not authenticated with a JWT: %q", r.Header.Get("Authorization"))
+			}
+			fmt.Fprint(w, `{"id": 42}`)
+		case r.URL.Path == "/app/installations/42/access_tokens" && r.Method == http.MethodPost:
+			tokenRequests++
+			// Expire within the refresh window so every request needs a new token
+			expiresAt := time.Now().Add(time.Minute).UTC().Format(time.RFC3339)
+			fmt.Fprintf(w, `{"token": "installation-token-%d", "expires_at": %q}`, tokenRequests, expiresAt)
+		case r.URL.Path == "/repos/acme/repo":
+			repoAuth = append(repoAuth, r.Header.Get("Authorization"))
+			fmt.Fprint(w, `{"id": 1, "name": "repo"}`)
+		default:
+			t.Errorf("Unexpected request: %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{
+		GitHubOrg:               "acme",
+		GitHubAppID:             1234,
+		GitHubAppPrivateKeyFile: keyFile,
+	}
+	f := newTestFactory(t, cfg, server.URL)
+
+	ctx := context.Background()
+	client, err := f.ForOrg(ctx, "acme")
+	if err != nil {
+		t.Fatalf("ForOrg() unexpected error: %v", err)
+	}
+	if cached, _ := f.ForOrg(ctx, "acme"); cached != client {
+		t.Error("ForOrg() did not return the cached client")
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, _, err := client.Repositories.Get(ctx, "acme", "repo"); err != nil {
+			t.Fatalf("Repositories.Get() unexpected error: %v", err)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if tokenRequests != 2 {
+		t.Errorf("Token requests = %d, want 2", tokenRequests)
+	}
+	want := []string{"Bearer installation-token-1", "Bearer installation-token-2"}
+	if len(repoAuth) != len(want) {
+		t.Fatalf("Repository requests = %v, want %v", repoAuth, want)
+	}
+	for i := range want {
+		if repoAuth[i] != want[i] {
+			t.Errorf("Authorization[%d] = %q, want %q", i, repoAuth[i], want[i])
+		}
+	}
+}
+
+func TestForOrgLookupDoesNotBlock(t *testing.T) {
+	_, keyFile := writePrivateKey(t)
+
+	// An installation lookup that hangs, as it would waiting out a rate limit
+	lookup := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/orgs/slow/installation" {
+			close(lookup)
+			<-r.Context().Done()
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"id": 42}`)
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{
+		GitHubOrg:               "slow",
+		GitHubAppID:             1234,
+		GitHubAppPrivateKeyFile: keyFile,
+	}
+	f := newTestFactory(t, cfg, server.URL)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		_, err := f.ForOrg(ctx, "slow")
+		done <- err
+	}()
+	<-lookup
+
+	// Other organizations and the rate limit stats are served meanwhile
+	result := make(chan error, 1)
+	go func() {
+		f.RateLimits()
+		_, err := f.ForOrg(context.Background(), "fast")
+		result <- err
+	}()
+	select {
+	case err := <-result:
+		if err != nil {
+			t.Errorf("ForOrg(fast) unexpected error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("ForOrg(fast) blocked by the lookup for another organization")
+	}
+
+	cancel()
+	if err := <-done; err == nil {
+		t.Error("ForOrg(slow) error = nil after its context was cancelled, want error")
+	}
+}
+
+func TestForOrgConfiguredInstallation(t *testing.T) {
+	_, keyFile := writePrivateKey(t)
+
+	var mu sync.Mutex
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths = append(paths, r.URL.Path)
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		expiresAt := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+		fmt.Fprintf(w, `{"token": "installation-token", "expires_at": %q}`, expiresAt)
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{
+		GitHubOrgs: []config.OrgConfig{
+			{Name: "org1"},
+			{Name: "org2", InstallationID: 43},
+		},
+		GitHubAppID:             1234,
+		GitHubAppPrivateKeyFile: keyFile,
+		GitHubAppInstallationID: 42,
+	}
+	f := newTestFactory(t, cfg, server.URL)
+
+	ctx := context.Background()
+	for _, org := range []string{"org1", "org2"} {
+		client, err := f.ForOrg(ctx, org)
+		if err != nil {
+			t.Fatalf("ForOrg(%s) unexpected error: %v", org, err)
+		}
+		_, _, _ = client.Organizations.Get(ctx, org)
+	}
+
+	// Configured installations are used without looking them up
+	want := []string{
+		"/app/installations/42/access_tokens", "/orgs/org1",
+		"/app/installations/43/access_tokens", "/orgs/org2",
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if strings.Join(paths, " ") != strings.Join(want, " ") {
+		t.Errorf("Requests = %v, want %v", paths, want)
+	}
+}
+
+func TestForOrgToken(t *testing.T) {
+	var mu sync.Mutex
+	auth := make(map[string]string)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		auth[r.URL.Path] = r.Header.Get("Authorization")
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{}`)
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{
+		GitHubToken: "default-token",
+		GitHubOrgs: []config.OrgConfig{
+			{Name: "org1"},
+			{Name: "org2", Token: "org2-token"},
+		},
+	}
+	f := newTestFactory(t, cfg, server.URL)
+
+	ctx := context.Background()
+	org1, err := f.ForOrg(ctx, "org1")
+	if err != nil {
+		t.Fatalf("ForOrg() unexpected error: %v", err)
+	}
+	if org1 != f.Default() {
+		t.Error("ForOrg() without token override did not return the default client")
+	}
+
+	for _, org := range []string{"org1", "org2", "unconfigured"} {
+		client, err := f.ForOrg(ctx, org)
+		if err != nil {
+			t.Fatalf("ForOrg(%s) unexpected error: %v", org, err)
+		}
+		_, _, _ = client.Organizations.Get(ctx, org)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := map[string]string{
+		"/orgs/org1":         "Bearer default-token",
+		"/orgs/org2":         "Bearer org2-token",
+		"/orgs/unconfigured": "Bearer default-token",
+	}
+	for path, header := range want {
+		if auth[path] != header {
+			t.Errorf("Authorization for %s = %q, want %q", path, auth[path], header)
+		}
+	}
+}
+
+func TestEnterpriseURLs(t *testing.T) {
+	tests := []struct {
+		name       string
+		apiURL     string
+		uploadURL  string
+		wantBase   string
+		wantUpload string
+	}{
+		{
+			name:       "host only",
+			apiURL:     "https://ghes.example.com",
+			wantBase:   "https://ghes.example.com/api/v3/",
+			wantUpload: "https://ghes.example.com/api/uploads/",
+		},
+		{
+			name:       "API path",
+			apiURL:     "https://ghes.example.com/api/v3",
+			wantBase:   "https://ghes.example.com/api/v3/",
+			wantUpload: "https://ghes.example.com/api/uploads/",
+		},
+		{
+			name:       "separate upload host",
+			apiURL:     "https://ghes.example.com/api/v3/",
+			uploadURL:  "https://uploads.ghes.example.com",
+			wantBase:   "https://ghes.example.com/api/v3/",
+			wantUpload: "https://uploads.ghes.example.com/api/uploads/",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := NewFactory(&config.Config{
+				GitHubOrg:       "org",
+				GitHubToken:     "token",
+				GitHubAPIURL:    tt.apiURL,
+				GitHubUploadURL: tt.uploadURL,
+			})
+			if err != nil {
+				t.Fatalf("NewFactory() unexpected error: %v", err)
+			}
+
+			client, err := f.ForOrg(context.Background(), "org")
+			if err != nil {
+				t.Fatalf("ForOrg() unexpected error: %v", err)
+			}
+			if got := client.BaseURL.String(); got != tt.wantBase {
+				t.Errorf("BaseURL = %v, want %v", got, tt.wantBase)
+			}
+			if got := client.UploadURL.String(); got != tt.wantUpload {
+				t.Errorf("UploadURL = %v, want %v", got, tt.wantUpload)
+			}
+		})
+	}
+}
+
+// Test helper functions
+
+// newTestFactory creates a factory whose clients send requests to serverURL
+func newTestFactory(t *testing.T, cfg *config.Config, serverURL string) *Factory {
+	t.Helper()
+
+	f, err := NewFactory(cfg)
+	if err != nil {
+		t.Fatalf("NewFactory() unexpected error: %v", err)
+	}
+	baseURL, err := url.Parse(serverURL + "/")
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %v", err)
+	}
+	f.baseURL = baseURL
+	f.defaultClient.BaseURL = baseURL
+	return f
+}
+
+// writePrivateKey generates an RSA key and writes it as a PKCS#1 PEM file
+func writePrivateKey(t *testing.T) (*rsa.PrivateKey, string) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "app.pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+	return key, path
+}
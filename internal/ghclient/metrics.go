@@ -0,0 +1,152 @@
+package ghclient
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Descriptions of the metrics read from the rate limit transports and the
+// response cache when scraped
+var (
+	rateLimitRemainingDesc = prometheus.NewDesc("secflow_github_rate_limit_remaining",
+		"Requests left in the current GitHub API rate limit window.", []string{"client", "resource"}, nil)
+	rateLimitLimitDesc = prometheus.NewDesc("secflow_github_rate_limit_limit",
+		"Requests allowed per GitHub API rate limit window.", []string{"client", "resource"}, nil)
+	rateLimitResetDesc = prometheus.NewDesc("secflow_github_rate_limit_reset_timestamp_seconds",
+		"Time at which the GitHub API rate limit window resets.", []string{"client", "resource"}, nil)
+	rateLimitedDesc = prometheus.NewDesc("secflow_github_rate_limited_total",
+		"GitHub API responses rejected by the primary or secondary rate limit.", []string{"client", "limit"}, nil)
+	rateLimitWaitsDesc = prometheus.NewDesc("secflow_github_rate_limit_waits_total",
+		"Waits for a GitHub API rate limit to reset.", []string{"client"}, nil)
+	rateLimitWaitSecondsDesc = prometheus.NewDesc("secflow_github_rate_limit_wait_seconds_total",
+		"Time spent waiting for GitHub API rate limits to reset.", []string{"client"}, nil)
+
+	cacheHitsDesc = prometheus.NewDesc("secflow_github_cache_hits_total",
+		"GitHub API requests answered with 304 Not Modified and served from the cache.", nil, nil)
+	cacheMissesDesc = prometheus.NewDesc("secflow_github_cache_misses_total",
+		"GitHub API requests that downloaded a full response.", nil, nil)
+	cacheEvictionsDesc = prometheus.NewDesc("secflow_github_cache_evictions_total",
+		"Responses evicted from the GitHub response cache.", nil, nil)
+	cacheEntriesDesc = prometheus.NewDesc("secflow_github_cache_entries",
+		"Responses held in the GitHub response cache.", nil, nil)
+	cacheSizeDesc = prometheus.NewDesc("secflow_github_cache_size_bytes",
+		"Size of the responses held in the GitHub response cache.", nil, nil)
+)
+
+// newRequestsCounter returns the counter of GitHub API requests by client,
+// endpoint and status
+func newRequestsCounter() *prometheus.CounterVec {
+	return prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "secflow_github_requests_total",
+		Help: "GitHub API requests sent, by client, endpoint and response status.",
+	}, []string{"client", "endpoint", "status"})
+}
+
+// Collector returns a Prometheus collector for the GitHub API requests sent
+// by the factory's clients, their rate limits and the response cache
+func (f *Factory) Collector() prometheus.Collector {
+	return factoryCollector{f}
+}
+
+// factoryCollector reads the rate limits and cache statistics of a factory
+// when scraped
+type factoryCollector struct {
+	f *Factory
+}
+
+// Describe implements prometheus.Collector
+func (c factoryCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.f.requests.Describe(ch)
+	for _, desc := range []*prometheus.Desc{
+		rateLimitRemainingDesc, rateLimitLimitDesc, rateLimitResetDesc,
+		rateLimitedDesc, rateLimitWaitsDesc, rateLimitWaitSecondsDesc,
+		cacheHitsDesc, cacheMissesDesc, cacheEvictionsDesc, cacheEntriesDesc, cacheSizeDesc,
+	} {
+		ch <- desc
+	}
+}
+
+// Collect implements prometheus.Collector
+func (c factoryCollector) Collect(ch chan<- prometheus.Metric) {
+	c.f.requests.Collect(ch)
+
+	for _, stats := range c.f.RateLimits() {
+		for _, q := range stats.Quotas {
+			ch <- prometheus.MustNewConstMetric(rateLimitRemainingDesc, prometheus.GaugeValue, float64(q.Remaining), stats.Client, q.Resource)
+			ch <- prometheus.MustNewConstMetric(rateLimitLimitDesc, prometheus.GaugeValue, float64(q.Limit), stats.Client, q.Resource)
+			ch <- prometheus.MustNewConstMetric(rateLimitResetDesc, prometheus.GaugeValue, float64(q.Reset.Unix()), stats.Client, q.Resource)
+		}
+		ch <- prometheus.MustNewConstMetric(rateLimitedDesc, prometheus.CounterValue, float64(stats.PrimaryLimited), stats.Client, "primary")
+		ch <- prometheus.MustNewConstMetric(rateLimitedDesc, prometheus.CounterValue, float64(stats.SecondaryLimited), stats.Client, "secondary")
+		ch <- prometheus.MustNewConstMetric(rateLimitWaitsDesc, prometheus.CounterValue, float64(stats.Waits), stats.Client)
+		ch <- prometheus.MustNewConstMetric(rateLimitWaitSecondsDesc, prometheus.CounterValue, stats.WaitTime.Seconds(), stats.Client)
+	}
+
+	if stats, ok := c.f.CacheStats(); ok {
+		ch <- prometheus.MustNewConstMetric(cacheHitsDesc, prometheus.CounterValue, float64(stats.Hits))
+		ch <- prometheus.MustNewConstMetric(cacheMissesDesc, prometheus.CounterValue, float64(stats.Misses))
+		ch <- prometheus.MustNewConstMetric(cacheEvictionsDesc, prometheus.CounterValue, float64(stats.Evictions))
+		ch <- prometheus.MustNewConstMetric(cacheEntriesDesc, prometheus.GaugeValue, float64(stats.Entries))
+		ch <- prometheus.MustNewConstMetric(cacheSizeDesc, prometheus.GaugeValue, float64(stats.SizeBytes))
+	}
+}
+
+// metricsTransport counts the requests sent by a client. It sits below the
+// rate limit and cache transports, so every retry and conditional request
+// is counted.
+type metricsTransport struct {
+	name     string
+	base     http.RoundTripper
+	requests *prometheus.CounterVec
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *metricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	status := "error"
+	if err == nil {
+		status = strconv.Itoa(resp.StatusCode)
+	}
+	t.requests.WithLabelValues(t.name, endpointFor(req.URL.Path), status).Inc()
+	return resp, err
+}
+
+// endpointFor returns the endpoint a request path belongs to, with owners,
+// repository names, file paths and numeric IDs replaced by placeholders to
+// keep the number of label values bounded
+func endpointFor(path string) string {
+	path = strings.TrimPrefix(path, "/api/v3")
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) == 1 && parts[0] == "" {
+		return "/"
+	}
+
+	switch parts[0] {
+	case "orgs":
+		if len(parts) > 1 {
+			parts[1] = "{org}"
+		}
+	case "users":
+		if len(parts) > 1 {
+			parts[1] = "{user}"
+		}
+	case "repos":
+		if len(parts) > 2 {
+			parts[1], parts[2] = "{owner}", "{repo}"
+		}
+	}
+
+	for i, part := range parts {
+		if part == "contents" && i+1 < len(parts) {
+			parts = append(parts[:i+1], "{path}")
+			break
+		}
+		if _, err := strconv.ParseInt(part, 10, 64); err == nil {
+			parts[i] = "{id}"
+		}
+	}
+	return "/" + strings.Join(parts, "/")
+}
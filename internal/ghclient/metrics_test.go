@@ -0,0 +1,81 @@
+package ghclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/klimeurt/secflow-collector/internal/config"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestEndpointFor(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/", "/"},
+		{"/orgs/testorg/repos", "/orgs/{org}/repos"},
+		{"/users/octocat/installation", "/users/{user}/installation"},
+		{"/repos/testorg/service", "/repos/{owner}/{repo}"},
+		{"/repos/testorg/service/contents/appsec-config.yml", "/repos/{owner}/{repo}/contents/{path}"},
+		{"/repos/testorg/service/contents/docs/guide.md", "/repos/{owner}/{repo}/contents/{path}"},
+		{"/repositories/1234", "/repositories/{id}"},
+		{"/app/installations/42/access_tokens", "/app/installations/{id}/access_tokens"},
+		{"/api/v3/orgs/testorg/repos", "/orgs/{org}/repos"},
+		{"/rate_limit", "/rate_limit"},
+	}
+
+	for _, tt := range tests {
+		if got := endpointFor(tt.path); got != tt.want {
+			t.Errorf("endpointFor(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestFactoryCollector(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(headerRateRemaining, "4990")
+		w.Header().Set(headerRateLimit, "5000")
+		w.Header().Set(headerRateReset, "1700000000")
+		w.Header().Set(headerRateResource, "core")
+		if strings.HasSuffix(r.URL.Path, "/contents/appsec-config.yml") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`[]`))
+	}))
+	defer server.Close()
+
+	f := newTestFactory(t, &config.Config{GitHubToken: "token"}, server.URL)
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		if _, _, err := f.Default().Repositories.ListByOrg(ctx, "testorg", nil); err != nil {
+			t.Fatalf("ListByOrg() unexpected error: %v", err)
+		}
+	}
+	_, _, _, _ = f.Default().Repositories.GetContents(ctx, "testorg", "service", "appsec-config.yml", nil)
+
+	expected := `
+# HELP secflow_github_rate_limit_remaining Requests left in the current GitHub API rate limit window.
+# TYPE secflow_github_rate_limit_remaining gauge
+secflow_github_rate_limit_remaining{client="default",resource="core"} 4990
+# HELP secflow_github_requests_total GitHub API requests sent, by client, endpoint and response status.
+# TYPE secflow_github_requests_total counter
+secflow_github_requests_total{client="default",endpoint="/orgs/{org}/repos",status="200"} 2
+secflow_github_requests_total{client="default",endpoint="/repos/{owner}/{repo}/contents/{path}",status="404"} 1
+`
+	err := testutil.CollectAndCompare(f.Collector(), strings.NewReader(expected),
+		"secflow_github_requests_total", "secflow_github_rate_limit_remaining")
+	if err != nil {
+		t.Error(err)
+	}
+
+	// Cache metrics are only reported with a cache
+	if n := testutil.CollectAndCount(f.Collector(), "secflow_github_cache_hits_total"); n != 0 {
+		t.Errorf("cache metrics without a cache = %d, want 0", n)
+	}
+}
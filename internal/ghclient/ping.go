@@ -0,0 +1,34 @@
+package ghclient
+
+import (
+	"context"
+	"fmt"
+)
+
+// Ping checks that the GitHub API is reachable and that the credentials of
+// the default client and of the clients for orgs are valid. Token clients
+// call the rate limit endpoint, which does not count against the quota; with
+// GitHub App authentication the default client fetches the app itself.
+func (f *Factory) Ping(ctx context.Context, orgs []string) error {
+	if f.app != nil {
+		if _, _, err := f.defaultClient.Apps.Get(ctx, ""); err != nil {
+			return fmt.Errorf("failed to authenticate as GitHub App: %w", err)
+		}
+	} else if _, _, err := f.defaultClient.RateLimit.Get(ctx); err != nil {
+		return fmt.Errorf("failed to reach GitHub API: %w", err)
+	}
+
+	for _, org := range orgs {
+		client, err := f.ForOrg(ctx, org)
+		if err != nil {
+			return err
+		}
+		if client == f.defaultClient {
+			continue
+		}
+		if _, _, err := client.RateLimit.Get(ctx); err != nil {
+			return fmt.Errorf("failed to reach GitHub API for %s: %w", org, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package ghclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/klimeurt/secflow-collector/internal/config"
+)
+
+func TestPing(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/rate_limit" {
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		if r.Header.Get("Authorization") != "Bearer good" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"message":"Bad credentials"}`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"resources":{"core":{"limit":5000,"remaining":4999,"reset":1700000000}}}`))
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{
+		GitHubToken: "good",
+		GitHubOrgs:  []config.OrgConfig{{Name: "one"}, {Name: "two", Token: "bad"}},
+	}
+	f := newTestFactory(t, cfg, server.URL)
+	ctx := context.Background()
+
+	if err := f.Ping(ctx, []string{"one"}); err != nil {
+		t.Errorf("Ping() unexpected error: %v", err)
+	}
+	// A token override of an organization is checked too
+	if err := f.Ping(ctx, []string{"one", "two"}); err == nil {
+		t.Error("Ping() expected error for an invalid organization token, got nil")
+	}
+
+	cfg.GitHubToken = "bad"
+	f = newTestFactory(t, cfg, server.URL)
+	if err := f.Ping(ctx, nil); err == nil {
+		t.Error("Ping() expected error for an invalid token, got nil")
+	}
+}
@@ -0,0 +1,274 @@
+package ghclient
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Rate limit headers returned by the GitHub API
+const (
+	headerRateLimit     = "X-RateLimit-Limit"
+	headerRateRemaining = "X-RateLimit-Remaining"
+	headerRateReset     = "X-RateLimit-Reset"
+	headerRateResource  = "X-RateLimit-Resource"
+	headerRetryAfter    = "Retry-After"
+)
+
+// secondaryLimitWait is how long to wait after a secondary rate limit
+// response without a Retry-After header, as recommended by GitHub
+const secondaryLimitWait = time.Minute
+
+// Quota is the last seen rate limit of one API resource, such as core or
+// search
+type Quota struct {
+	Resource  string
+	Limit     int
+	Remaining int
+	Reset     time.Time
+}
+
+// RateLimitStats describes the rate limits seen by one client
+type RateLimitStats struct {
+	// Client is the organization the client belongs to, or "default"
+	Client string
+	Quotas []Quota
+	// PrimaryLimited and SecondaryLimited count the responses rejected by
+	// the primary and secondary rate limits
+	PrimaryLimited   int64
+	SecondaryLimited int64
+	// Waits and WaitTime count the waits for a rate limit to reset
+	Waits    int64
+	WaitTime time.Duration
+}
+
+// rateLimitTransport tracks the remaining quota of a client from the rate
+// limit headers of each response. Requests wait for the quota to reset once
+// it is exhausted, and requests rejected by the primary or secondary rate
+// limit are retried once the limit has passed.
+type rateLimitTransport struct {
+	name       string
+	base       http.RoundTripper
+	reserve    int
+	maxWait    time.Duration
+	maxRetries int
+	// now and sleep are replaced in tests
+	now   func() time.Time
+	sleep func(ctx context.Context, d time.Duration) error
+
+	mu    sync.Mutex
+	stats RateLimitStats
+	// quotas holds the last seen quota per resource
+	quotas map[string]Quota
+}
+
+// newRateLimitTransport creates a transport for the client called name that
+// keeps reserve requests of each quota unused and waits at most maxWait for a
+// limit to reset
+func newRateLimitTransport(name string, base http.RoundTripper, reserve int, maxWait time.Duration, maxRetries int) *rateLimitTransport {
+	return &rateLimitTransport{
+		name:       name,
+		base:       base,
+		reserve:    reserve,
+		maxWait:    maxWait,
+		maxRetries: maxRetries,
+		now:        time.Now,
+		sleep:      sleepContext,
+		stats:      RateLimitStats{Client: name},
+		quotas:     make(map[string]Quota),
+	}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+
+	// Wait for the reset when an earlier response exhausted the quota
+	if quota, ok := t.quota(resourceFor(req.URL.Path)); ok && quota.Remaining <= t.reserve {
+		if wait := quota.Reset.Sub(t.now()); wait > 0 && wait <= t.maxWait {
+			slog.Warn("Waiting for the GitHub rate limit to reset", "client", t.name, "resource", quota.Resource,
+				"remaining", quota.Remaining, "limit", quota.Limit, "wait", wait.Round(time.Second).String(), "reset", quota.Reset.Format(time.RFC3339))
+			if err := t.wait(ctx, wait); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		resp, err := t.base.RoundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+
+		quota, hasQuota := t.update(resp)
+		wait, limited := t.limitedFor(resp, quota, hasQuota)
+		if !limited {
+			// go-github fails every request until the reset, without
+			// sending it, once it has seen an exhausted quota. Hide the
+			// reset from it so the next request reaches this transport,
+			// which waits for the reset before sending it.
+			if hasQuota && quota.Remaining == 0 {
+				resp.Header.Del(headerRateReset)
+			}
+			return resp, nil
+		}
+
+		// Give up and let the caller see the rate limit error
+		if attempt >= t.maxRetries || wait > t.maxWait || (req.Body != nil && req.GetBody == nil) {
+			return resp, nil
+		}
+
+		slog.Warn("GitHub rate limit hit, retrying", "client", t.name, "method", req.Method, "path", req.URL.Path,
+			"wait", wait.Round(time.Second).String(), "attempt", attempt+1, "max_retries", t.maxRetries)
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+
+		if err := t.wait(ctx, wait); err != nil {
+			return nil, err
+		}
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(ctx)
+			req.Body = body
+		}
+	}
+}
+
+// limitedFor reports whether resp was rejected by a rate limit, and how long
+// to wait before retrying
+func (t *rateLimitTransport) limitedFor(resp *http.Response, quota Quota, hasQuota bool) (time.Duration, bool) {
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests {
+		return 0, false
+	}
+
+	// Secondary rate limits tell how long to wait
+	if v := resp.Header.Get(headerRetryAfter); v != "" {
+		if seconds, err := strconv.Atoi(v); err == nil {
+			t.count(&t.stats.SecondaryLimited)
+			return time.Duration(seconds) * time.Second, true
+		}
+	}
+
+	// The primary rate limit is exhausted until the reset
+	if hasQuota && quota.Remaining == 0 {
+		t.count(&t.stats.PrimaryLimited)
+		wait := quota.Reset.Sub(t.now())
+		if wait < 0 {
+			wait = 0
+		}
+		return wait, true
+	}
+
+	// Secondary rate limits without a Retry-After header are only
+	// recognizable by their message
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	resp.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), resp.Body))
+	if err == nil && strings.Contains(strings.ToLower(string(body)), "secondary rate limit") {
+		t.count(&t.stats.SecondaryLimited)
+		return secondaryLimitWait, true
+	}
+
+	return 0, false
+}
+
+// update records the quota reported by the rate limit headers of resp
+func (t *rateLimitTransport) update(resp *http.Response) (Quota, bool) {
+	remaining, err := strconv.Atoi(resp.Header.Get(headerRateRemaining))
+	if err != nil {
+		return Quota{}, false
+	}
+
+	quota := Quota{Resource: resp.Header.Get(headerRateResource), Remaining: remaining}
+	if quota.Resource == "" {
+		quota.Resource = resourceFor(resp.Request.URL.Path)
+	}
+	quota.Limit, _ = strconv.Atoi(resp.Header.Get(headerRateLimit))
+	if reset, err := strconv.ParseInt(resp.Header.Get(headerRateReset), 10, 64); err == nil {
+		quota.Reset = time.Unix(reset, 0)
+	}
+
+	t.mu.Lock()
+	t.quotas[quota.Resource] = quota
+	t.mu.Unlock()
+	return quota, true
+}
+
+// quota returns the last seen quota of resource
+func (t *rateLimitTransport) quota(resource string) (Quota, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	quota, ok := t.quotas[resource]
+	return quota, ok
+}
+
+// wait sleeps for d, recording the wait
+func (t *rateLimitTransport) wait(ctx context.Context, d time.Duration) error {
+	t.mu.Lock()
+	t.stats.Waits++
+	t.stats.WaitTime += d
+	t.mu.Unlock()
+	return t.sleep(ctx, d)
+}
+
+// count increments one of the stats counters
+func (t *rateLimitTransport) count(counter *int64) {
+	t.mu.Lock()
+	*counter++
+	t.mu.Unlock()
+}
+
+// Stats returns the quotas and counters of the transport
+func (t *rateLimitTransport) Stats() RateLimitStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	stats := t.stats
+	stats.Quotas = make([]Quota, 0, len(t.quotas))
+	for _, quota := range t.quotas {
+		stats.Quotas = append(stats.Quotas, quota)
+	}
+	sort.Slice(stats.Quotas, func(i, j int) bool { return stats.Quotas[i].Resource < stats.Quotas[j].Resource })
+	return stats
+}
+
+// resourceFor returns the rate limit resource a request path is counted
+// against, before its response says so. The rate limit endpoint counts
+// against none, so requests to it never wait for a reset.
+func resourceFor(path string) string {
+	path = strings.TrimPrefix(path, "/api/v3")
+	switch {
+	case path == "/rate_limit":
+		return ""
+	case strings.HasPrefix(path, "/search/code"):
+		return "code_search"
+	case strings.HasPrefix(path, "/search/"):
+		return "search"
+	case strings.HasPrefix(path, "/graphql"), strings.HasPrefix(path, "/api/graphql"):
+		return "graphql"
+	default:
+		return "core"
+	}
+}
+
+// sleepContext sleeps for d or until ctx is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
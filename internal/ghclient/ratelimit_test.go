@@ -0,0 +1,252 @@
+package ghclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v57/github"
+	"github.com/klimeurt/secflow-collector/internal/config"
+)
+
+// fakeClock replaces the clock of a rate limit transport, recording waits
+// instead of sleeping
+type fakeClock struct {
+	now   time.Time
+	waits []time.Duration
+}
+
+func (c *fakeClock) install(t *rateLimitTransport) {
+	t.now = func() time.Time { return c.now }
+	t.sleep = func(_ context.Context, d time.Duration) error {
+		c.waits = append(c.waits, d)
+		c.now = c.now.Add(d)
+		return nil
+	}
+}
+
+func TestRateLimitTransport(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	reset := strconv.FormatInt(now.Add(30*time.Second).Unix(), 10)
+
+	tests := []struct {
+		name          string
+		maxWait       time.Duration
+		limited       func(w http.ResponseWriter)
+		wantStatus    int
+		wantWaits     []time.Duration
+		wantRequests  int32
+		wantPrimary   int64
+		wantSecondary int64
+	}{
+		{
+			name:    "primary limit waits until reset",
+			maxWait: time.Hour,
+			limited: func(w http.ResponseWriter) {
+				w.Header().Set(headerRateRemaining, "0")
+				w.Header().Set(headerRateReset, reset)
+				w.WriteHeader(http.StatusForbidden)
+			},
+			wantStatus:   http.StatusOK,
+			wantWaits:    []time.Duration{30 * time.Second},
+			wantRequests: 2,
+			wantPrimary:  1,
+		},
+		{
+			name:    "secondary limit honors Retry-After",
+			maxWait: time.Hour,
+			limited: func(w http.ResponseWriter) {
+				w.Header().Set(headerRetryAfter, "5")
+				w.WriteHeader(http.StatusForbidden)
+			},
+			wantStatus:    http.StatusOK,
+			wantWaits:     []time.Duration{5 * time.Second},
+			wantRequests:  2,
+			wantSecondary: 1,
+		},
+		{
+			name:    "secondary limit without Retry-After",
+			maxWait: time.Hour,
+			limited: func(w http.ResponseWriter) {
+				w.WriteHeader(http.StatusForbidden)
+				_, _ = w.Write([]byte(`{"message":"You have exceeded a secondary rate limit."}`))
+			},
+			wantStatus:    http.StatusOK,
+			wantWaits:     []time.Duration{time.Minute},
+			wantRequests:  2,
+			wantSecondary: 1,
+		},
+		{
+			name:    "wait longer than the maximum",
+			maxWait: 10 * time.Second,
+			limited: func(w http.ResponseWriter) {
+				w.Header().Set(headerRateRemaining, "0")
+				w.Header().Set(headerRateReset, reset)
+				w.WriteHeader(http.StatusForbidden)
+			},
+			wantStatus:   http.StatusForbidden,
+			wantRequests: 1,
+			wantPrimary:  1,
+		},
+		{
+			name:    "other forbidden responses",
+			maxWait: time.Hour,
+			limited: func(w http.ResponseWriter) {
+				w.WriteHeader(http.StatusForbidden)
+				_, _ = w.Write([]byte(`{"message":"Resource not accessible by integration"}`))
+			},
+			wantStatus:   http.StatusForbidden,
+			wantRequests: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if atomic.AddInt32(&requests, 1) == 1 {
+					tt.limited(w)
+					return
+				}
+				w.Header().Set(headerRateRemaining, "4999")
+				w.Header().Set(headerRateLimit, "5000")
+				w.Header().Set(headerRateReset, reset)
+			}))
+			defer server.Close()
+
+			transport := newRateLimitTransport("testorg", http.DefaultTransport, 0, tt.maxWait, 3)
+			clock := &fakeClock{now: now}
+			clock.install(transport)
+
+			resp, err := (&http.Client{Transport: transport}).Get(server.URL + "/orgs/testorg/repos")
+			if err != nil {
+				t.Fatalf("Get() unexpected error: %v", err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("StatusCode = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if requests != tt.wantRequests {
+				t.Errorf("requests = %d, want %d", requests, tt.wantRequests)
+			}
+			if len(clock.waits) != len(tt.wantWaits) || (len(tt.wantWaits) > 0 && clock.waits[0] != tt.wantWaits[0]) {
+				t.Errorf("waits = %v, want %v", clock.waits, tt.wantWaits)
+			}
+
+			stats := transport.Stats()
+			if stats.PrimaryLimited != tt.wantPrimary || stats.SecondaryLimited != tt.wantSecondary {
+				t.Errorf("PrimaryLimited = %d, SecondaryLimited = %d, want %d and %d",
+					stats.PrimaryLimited, stats.SecondaryLimited, tt.wantPrimary, tt.wantSecondary)
+			}
+		})
+	}
+}
+
+func TestRateLimitTransportExhausted(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	reset := now.Add(time.Minute)
+
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		remaining := 1 - atomic.AddInt32(&requests, 1)
+		if remaining < 0 {
+			remaining = 4999
+		}
+		w.Header().Set(headerRateLimit, "5000")
+		w.Header().Set(headerRateRemaining, strconv.Itoa(int(remaining)))
+		w.Header().Set(headerRateReset, strconv.FormatInt(reset.Unix(), 10))
+		w.Header().Set(headerRateResource, "core")
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"login":"testorg"}`))
+	}))
+	defer server.Close()
+
+	f := newTestFactory(t, &config.Config{GitHubToken: "token", GitHubRateLimitMaxWait: time.Hour}, server.URL)
+	clock := &fakeClock{now: now}
+	clock.install(f.limiters[0])
+	client := f.Default()
+
+	// The first response uses the last request of the quota. It is
+	// returned right away, and the second call waits for the reset instead
+	// of go-github failing it without sending it.
+	for i := 0; i < 3; i++ {
+		if _, _, err := client.Organizations.Get(context.Background(), "testorg"); err != nil {
+			var rateErr *github.RateLimitError
+			if errors.As(err, &rateErr) {
+				t.Fatalf("call %d: unexpected rate limit error: %v", i+1, err)
+			}
+			t.Fatalf("call %d: unexpected error: %v", i+1, err)
+		}
+		if i == 0 && len(clock.waits) != 0 {
+			t.Errorf("call 1 waited %v before returning", clock.waits)
+		}
+	}
+	if len(clock.waits) != 1 || clock.waits[0] != time.Minute {
+		t.Errorf("waits = %v, want [1m0s]", clock.waits)
+	}
+
+	stats := f.RateLimits()
+	if len(stats) != 1 || stats[0].Client != "default" {
+		t.Fatalf("RateLimits() = %+v, want one default client", stats)
+	}
+	if len(stats[0].Quotas) != 1 || stats[0].Quotas[0].Resource != "core" || stats[0].Quotas[0].Remaining != 4999 {
+		t.Errorf("Quotas = %+v, want core with 4999 remaining", stats[0].Quotas)
+	}
+	if stats[0].Waits != 1 || stats[0].WaitTime != time.Minute {
+		t.Errorf("Waits = %d, WaitTime = %v, want 1 and 1m", stats[0].Waits, stats[0].WaitTime)
+	}
+}
+
+func TestPingExhaustedQuota(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(headerRateLimit, "5000")
+		w.Header().Set(headerRateRemaining, "0")
+		w.Header().Set(headerRateReset, strconv.FormatInt(now.Add(time.Hour).Unix(), 10))
+		w.Header().Set(headerRateResource, "core")
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"login":"testorg","resources":{"core":{"limit":5000,"remaining":0}}}`))
+	}))
+	defer server.Close()
+
+	f := newTestFactory(t, &config.Config{GitHubToken: "token", GitHubRateLimitMaxWait: 2 * time.Hour}, server.URL)
+	clock := &fakeClock{now: now}
+	clock.install(f.limiters[0])
+
+	// Use up the core quota
+	if _, _, err := f.Default().Organizations.Get(context.Background(), "testorg"); err != nil {
+		t.Fatalf("Get() unexpected error: %v", err)
+	}
+
+	// The readiness ping is not held up until the reset
+	if err := f.Ping(context.Background(), nil); err != nil {
+		t.Errorf("Ping() unexpected error: %v", err)
+	}
+	if len(clock.waits) != 0 {
+		t.Errorf("waits = %v, want none", clock.waits)
+	}
+}
+
+func TestResourceFor(t *testing.T) {
+	tests := map[string]string{
+		"/orgs/testorg/repos":        "core",
+		"/api/v3/orgs/testorg/repos": "core",
+		"/search/repositories":       "search",
+		"/api/v3/search/code":        "code_search",
+		"/graphql":                   "graphql",
+		"/repos/testorg/search/git":  "core",
+		"/rate_limit":                "",
+		"/api/v3/rate_limit":         "",
+	}
+	for path, want := range tests {
+		if got := resourceFor(path); got != want {
+			t.Errorf("resourceFor(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+// Package gitlab is a minimal client for the parts of the GitLab REST API
+// used by the collector and the validator.
+package gitlab
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client calls the GitLab REST API (v4)
+type Client struct {
+	baseURL    *url.URL
+	token      string
+	httpClient *http.Client
+}
+
+// Project is a GitLab project
+type Project struct {
+	ID                int64     `json:"id"`
+	Name              string    `json:"name"`
+	Path              string    `json:"path"`
+	PathWithNamespace string    `json:"path_with_namespace"`
+	DefaultBranch     string    `json:"default_branch"`
+	HTTPURLToRepo     string    `json:"http_url_to_repo"`
+	SSHURLToRepo      string    `json:"ssh_url_to_repo"`
+	WebURL            string    `json:"web_url"`
+	Visibility        string    `json:"visibility"`
+	Archived          bool      `json:"archived"`
+	Topics            []string  `json:"topics"`
+	CreatedAt         time.Time `json:"created_at"`
+	LastActivityAt    time.Time `json:"last_activity_at"`
+	Namespace         Namespace `json:"namespace"`
+	// ForkedFromProject is set for forks
+	ForkedFromProject *struct {
+		ID int64 `json:"id"`
+	} `json:"forked_from_project"`
+	// Statistics is only returned to members with at least the Reporter role
+	Statistics *ProjectStatistics `json:"statistics"`
+}
+
+// ProjectStatistics holds the storage statistics of a project
+type ProjectStatistics struct {
+	RepositorySize int64 `json:"repository_size"`
+}
+
+// RepositorySizeKB returns the repository size in kilobytes, or zero when no
+// statistics were returned
+func (s *ProjectStatistics) RepositorySizeKB() int {
+	if s == nil {
+		return 0
+	}
+	return int(s.RepositorySize / 1024)
+}
+
+// Namespace is the group or user a project belongs to
+type Namespace struct {
+	ID       int64  `json:"id"`
+	Path     string `json:"path"`
+	FullPath string `json:"full_path"`
+	Kind     string `json:"kind"`
+}
+
+// ErrorResponse is returned for API responses with an error status
+type ErrorResponse struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *ErrorResponse) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("GitLab API error: %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("GitLab API error: %d %s", e.StatusCode, e.Message)
+}
+
+// IsNotFound reports whether err is a 404 response
+func IsNotFound(err error) bool {
+	var errResp *ErrorResponse
+	return errors.As(err, &errResp) && errResp.StatusCode == http.StatusNotFound
+}
+
+// NewClient creates a client for the GitLab instance at baseURL, such as
+// https://gitlab.com. /api/v4/ is appended when missing. An empty token
+// makes unauthenticated requests.
+func NewClient(baseURL, token string, httpClient *http.Client) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse GitLab URL: %w", err)
+	}
+	if !strings.HasSuffix(u.Path, "/") {
+		u.Path += "/"
+	}
+	if !strings.HasSuffix(u.Path, "/api/v4/") {
+		u.Path += "api/v4/"
+	}
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	return &Client{baseURL: u, token: token, httpClient: httpClient}, nil
+}
+
+// Pagination describes the position of a page in a paginated list
+type Pagination struct {
+	// Next is the number of the next page, or zero on the last page
+	Next int
+	// TotalPages is the number of pages, or zero when GitLab omits it, as it
+	// does for lists of more than 10,000 items
+	TotalPages int
+}
+
+// ListGroupProjects returns a page of the projects of group, including those
+// of its subgroups, and its pagination. Projects of other namespaces shared
+// with the group are left out.
+func (c *Client) ListGroupProjects(ctx context.Context, group string, page int) ([]*Project, Pagination, error) {
+	query := url.Values{
+		"include_subgroups": {"true"},
+		"with_shared":       {"false"},
+		"statistics":        {"true"},
+		"per_page":          {"100"},
+		"order_by":          {"id"},
+		"sort":              {"asc"},
+	}
+	if page > 0 {
+		query.Set("page", strconv.Itoa(page))
+	}
+
+	var projects []*Project
+	resp, err := c.get(ctx, "groups/"+url.PathEscape(group)+"/projects", query, &projects)
+	if err != nil {
+		return nil, Pagination{}, err
+	}
+
+	var pagination Pagination
+	pagination.Next, _ = strconv.Atoi(resp.Header.Get("X-Next-Page"))
+	pagination.TotalPages, _ = strconv.Atoi(resp.Header.Get("X-Total-Pages"))
+	return projects, pagination, nil
+}
+
+// GetProject returns a project by ID or by its full path
+func (c *Client) GetProject(ctx context.Context, project string) (*Project, error) {
+	var p Project
+	if _, err := c.get(ctx, "projects/"+url.PathEscape(project), nil, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// FileExists reports whether the file at path exists in project on ref. An
+// empty ref checks the project's default branch.
+func (c *Client) FileExists(ctx context.Context, project, ref, path string) (bool, error) {
+	if ref == "" {
+		p, err := c.GetProject(ctx, project)
+		if err != nil {
+			return false, err
+		}
+		// Empty projects have no default branch and no files
+		if p.DefaultBranch == "" {
+			return false, nil
+		}
+		ref = p.DefaultBranch
+	}
+
+	endpoint := "projects/" + url.PathEscape(project) + "/repository/files/" + url.PathEscape(path)
+	_, err := c.do(ctx, http.MethodHead, endpoint, url.Values{"ref": {ref}}, nil)
+	if IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// get sends a GET request and decodes the JSON response into v
+func (c *Client) get(ctx context.Context, endpoint string, query url.Values, v interface{}) (*http.Response, error) {
+	return c.do(ctx, http.MethodGet, endpoint, query, v)
+}
+
+// do sends a request for endpoint, a path relative to the API root whose
+// parameters are already escaped, and decodes a JSON response into v
+func (c *Client) do(ctx context.Context, method, endpoint string, query url.Values, v interface{}) (*http.Response, error) {
+	u, err := url.Parse(c.baseURL.String() + endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build GitLab request URL: %w", err)
+	}
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GitLab request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.token != "" {
+		req.Header.Set("PRIVATE-TOKEN", c.token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		errResp := &ErrorResponse{StatusCode: resp.StatusCode}
+		var body struct {
+			Message interface{} `json:"message"`
+			Error   string      `json:"error"`
+		}
+		if data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10)); json.Unmarshal(data, &body) == nil {
+			switch {
+			case body.Message != nil:
+				errResp.Message = fmt.Sprint(body.Message)
+			case body.Error != "":
+				errResp.Message = body.Error
+			}
+		}
+		return resp, errResp
+	}
+
+	if v != nil {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			return resp, fmt.Errorf("failed to decode GitLab response: %w", err)
+		}
+	}
+	return resp, nil
+}
@@ -0,0 +1,141 @@
+package gitlab
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNewClient(t *testing.T) {
+	tests := []struct {
+		baseURL string
+		want    string
+	}{
+		{"https://gitlab.com", "https://gitlab.com/api/v4/"},
+		{"https://gitlab.example.com/api/v4", "https://gitlab.example.com/api/v4/"},
+		{"https://example.com/gitlab/", "https://example.com/gitlab/api/v4/"},
+	}
+
+	for _, tt := range tests {
+		client, err := NewClient(tt.baseURL, "", nil)
+		if err != nil {
+			t.Fatalf("NewClient(%q) unexpected error: %v", tt.baseURL, err)
+		}
+		if got := client.baseURL.String(); got != tt.want {
+			t.Errorf("NewClient(%q) base URL = %v, want %v", tt.baseURL, got, tt.want)
+		}
+	}
+}
+
+func TestListGroupProjects(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.EscapedPath(); got != "/api/v4/groups/platform%2Fbackend/projects" {
+			t.Errorf("Path = %v, want %v", got, "/api/v4/groups/platform%2Fbackend/projects")
+		}
+		if got := r.Header.Get("PRIVATE-TOKEN"); got != "secret" {
+			t.Errorf("PRIVATE-TOKEN = %q, want %q", got, "secret")
+		}
+		if got := r.URL.Query().Get("include_subgroups"); got != "true" {
+			t.Errorf("include_subgroups = %q, want %q", got, "true")
+		}
+		if got := r.URL.Query().Get("with_shared"); got != "false" {
+			t.Errorf("with_shared = %q, want %q", got, "false")
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Query().Get("page") {
+		case "1":
+			w.Header().Set("X-Next-Page", "2")
+			w.Header().Set("X-Total-Pages", "2")
+			_ = json.NewEncoder(w).Encode([]map[string]interface{}{{"id": 1, "path": "api"}})
+		case "2":
+			w.Header().Set("X-Next-Page", "")
+			_ = json.NewEncoder(w).Encode([]map[string]interface{}{{"id": 2, "path": "worker"}})
+		default:
+			t.Errorf("Unexpected page %q", r.URL.Query().Get("page"))
+		}
+	}))
+	defer server.Close()
+
+	client, err := NewClient(server.URL, "secret", nil)
+	if err != nil {
+		t.Fatalf("NewClient() unexpected error: %v", err)
+	}
+
+	ctx := context.Background()
+	projects, pagination, err := client.ListGroupProjects(ctx, "platform/backend", 1)
+	if err != nil {
+		t.Fatalf("ListGroupProjects() unexpected error: %v", err)
+	}
+	if len(projects) != 1 || projects[0].Path != "api" || pagination != (Pagination{Next: 2, TotalPages: 2}) {
+		t.Errorf("ListGroupProjects() page 1 = %+v, %+v", projects, pagination)
+	}
+
+	projects, pagination, err = client.ListGroupProjects(ctx, "platform/backend", pagination.Next)
+	if err != nil {
+		t.Fatalf("ListGroupProjects() unexpected error: %v", err)
+	}
+	if len(projects) != 1 || projects[0].Path != "worker" || pagination.Next != 0 {
+		t.Errorf("ListGroupProjects() page 2 = %+v, %+v", projects, pagination)
+	}
+}
+
+func TestFileExists(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.EscapedPath() {
+		case "/api/v4/projects/platform%2Fwith-config":
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"id": 1, "default_branch": "main"})
+		case "/api/v4/projects/platform%2Fwithout-config":
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"id": 2, "default_branch": "main"})
+		case "/api/v4/projects/platform%2Fempty":
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"id": 3})
+		case "/api/v4/projects/platform%2Fwith-config/repository/files/appsec-config.yml":
+			if r.Method != http.MethodHead || r.URL.Query().Get("ref") != "main" {
+				t.Errorf("Unexpected file request: %s ref=%s", r.Method, r.URL.Query().Get("ref"))
+			}
+		case "/api/v4/projects/platform%2Fbroken":
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_ = json.NewEncoder(w).Encode(map[string]string{"message": "404 Not Found"})
+		}
+	}))
+	defer server.Close()
+
+	client, err := NewClient(server.URL, "", nil)
+	if err != nil {
+		t.Fatalf("NewClient() unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		project string
+		want    bool
+		wantErr bool
+	}{
+		{project: "platform/with-config", want: true},
+		{project: "platform/without-config", want: false},
+		{project: "platform/empty", want: false},
+		{project: "platform/missing", wantErr: true},
+		{project: "platform/broken", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.project, func(t *testing.T) {
+			got, err := client.FileExists(context.Background(), tt.project, "", "appsec-config.yml")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("FileExists() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("FileExists() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	_, err = client.GetProject(context.Background(), "platform/missing")
+	if !IsNotFound(err) {
+		t.Errorf("GetProject() error = %v, want not found", err)
+	}
+}
@@ -0,0 +1,125 @@
+// Package health serves the liveness and readiness probes of the collector
+// and the validator.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// Paths the probes are served on
+const (
+	LivenessPath  = "/healthz"
+	ReadinessPath = "/readyz"
+)
+
+// RemoteCheckTTL is how long the result of a check calling a remote API is
+// reused, so that frequent probes do not add to its load or rate limits
+const RemoteCheckTTL = 30 * time.Second
+
+// checkTimeout bounds every check of a probe
+const checkTimeout = 5 * time.Second
+
+// Check is a named check of a probe
+type Check struct {
+	Name string
+	// Check returns an error when the checked dependency is unhealthy
+	Check func(ctx context.Context) error
+	// TTL is how long a result is reused, and zero to check on every probe
+	TTL time.Duration
+}
+
+// Response is the body of a probe response
+type Response struct {
+	Status string `json:"status"`
+	// Checks maps the name of every check to "ok" or its error
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// Statuses of a probe response
+const (
+	StatusOK          = "ok"
+	StatusUnavailable = "unavailable"
+)
+
+// Handler returns an HTTP handler running every check concurrently. It
+// answers 200 when all of them pass and 503 otherwise.
+func Handler(checks ...Check) http.Handler {
+	cached := make([]*cachedCheck, len(checks))
+	for i, c := range checks {
+		cached[i] = &cachedCheck{Check: c}
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), checkTimeout)
+		defer cancel()
+
+		errs := make([]error, len(cached))
+		var wg sync.WaitGroup
+		for i, c := range cached {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs[i] = c.run(ctx)
+			}()
+		}
+		wg.Wait()
+
+		resp := Response{Status: StatusOK, Checks: make(map[string]string, len(cached))}
+		status := http.StatusOK
+		for i, c := range cached {
+			resp.Checks[c.Name] = StatusOK
+			if errs[i] != nil {
+				resp.Checks[c.Name] = errs[i].Error()
+				resp.Status = StatusUnavailable
+				status = http.StatusServiceUnavailable
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(resp)
+	})
+}
+
+// cachedCheck reuses the result of a check for its TTL
+type cachedCheck struct {
+	Check
+
+	mu        sync.Mutex
+	err       error
+	checkedAt time.Time
+}
+
+// run runs the check, or returns its last result while it is fresh
+func (c *cachedCheck) run(ctx context.Context) error {
+	if c.TTL <= 0 {
+		return c.Check.Check(ctx)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.checkedAt.IsZero() && time.Since(c.checkedAt) < c.TTL {
+		return c.err
+	}
+	c.err = c.Check.Check(ctx)
+	c.checkedAt = time.Now()
+	return c.err
+}
+
+// NATS returns a check that passes while nc is connected
+func NATS(nc *nats.Conn) Check {
+	return Check{Name: "nats", Check: func(context.Context) error {
+		if status := nc.Status(); status != nats.CONNECTED {
+			return fmt.Errorf("NATS connection is %s", status)
+		}
+		return nil
+	}}
+}
@@ -0,0 +1,54 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHandler(t *testing.T) {
+	calls := 0
+	var remoteErr error
+	handler := Handler(
+		Check{Name: "local", Check: func(context.Context) error { return nil }},
+		Check{Name: "remote", TTL: time.Hour, Check: func(context.Context) error {
+			calls++
+			return remoteErr
+		}},
+	)
+
+	probe := func() (int, Response) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, ReadinessPath, nil))
+		var resp Response
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return rec.Code, resp
+	}
+
+	remoteErr = errors.New("connection refused")
+	code, resp := probe()
+	if code != http.StatusServiceUnavailable || resp.Status != StatusUnavailable {
+		t.Errorf("probe = %d %s, want 503 unavailable", code, resp.Status)
+	}
+	if resp.Checks["local"] != StatusOK || resp.Checks["remote"] != "connection refused" {
+		t.Errorf("checks = %v", resp.Checks)
+	}
+
+	// The remote result is reused within its TTL
+	remoteErr = nil
+	if code, _ := probe(); code != http.StatusServiceUnavailable || calls != 1 {
+		t.Errorf("probe = %d after %d calls, want the cached failure after 1 call", code, calls)
+	}
+
+	handler = Handler(Check{Name: "local", Check: func(context.Context) error { return nil }})
+	if code, resp := probe(); code != http.StatusOK || resp.Status != StatusOK {
+		t.Errorf("probe = %d %s, want 200 ok", code, resp.Status)
+	}
+}
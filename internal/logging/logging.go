@@ -0,0 +1,28 @@
+// Package logging sets up the structured logger of the collector and the
+// validator.
+package logging
+
+import (
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/klimeurt/secflow-collector/internal/config"
+)
+
+// New returns a logger writing records at level and above to w, as JSON
+// when format is config.LogFormatJSON and as key=value text otherwise
+func New(w io.Writer, level slog.Level, format string) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: level}
+	if format == config.LogFormatJSON {
+		return slog.New(slog.NewJSONHandler(w, opts))
+	}
+	return slog.New(slog.NewTextHandler(w, opts))
+}
+
+// Setup installs a logger writing to stderr as the default logger, with
+// every record tagged with the name of the service. Lines written with the
+// standard log package go through it too, at info level.
+func Setup(service string, level slog.Level, format string) {
+	slog.SetDefault(New(os.Stderr, level, format).With("service", service))
+}
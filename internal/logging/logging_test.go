@@ -0,0 +1,37 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/klimeurt/secflow-collector/internal/config"
+)
+
+func TestNew(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, slog.LevelInfo, config.LogFormatJSON)
+	logger.Debug("Published repository", "repo", "testorg/service")
+	logger.Info("Scan completed", "org", "testorg", "run_id", "run-1")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("logged %d lines, want 1 without debug records: %q", len(lines), buf.String())
+	}
+	var record map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+		t.Fatalf("Failed to unmarshal log line: %v", err)
+	}
+	if record["level"] != "INFO" || record["msg"] != "Scan completed" || record["org"] != "testorg" || record["run_id"] != "run-1" {
+		t.Errorf("record = %v", record)
+	}
+
+	buf.Reset()
+	logger = New(&buf, slog.LevelDebug, config.LogFormatText)
+	logger.Debug("Published repository", "repo", "testorg/service")
+	if got := buf.String(); !strings.Contains(got, "level=DEBUG") || !strings.Contains(got, "repo=testorg/service") {
+		t.Errorf("text line = %q, want a debug record with the repo", got)
+	}
+}
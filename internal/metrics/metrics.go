@@ -0,0 +1,26 @@
+// Package metrics serves the Prometheus metrics of the collector and the
+// validator.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Path is where the metrics are served
+const Path = "/metrics"
+
+// Handler returns an HTTP handler serving the given collectors together
+// with the Go runtime and process metrics, in the Prometheus text format
+func Handler(cs ...prometheus.Collector) http.Handler {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	registry.MustRegister(cs...)
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{Registry: registry})
+}
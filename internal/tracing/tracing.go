@@ -0,0 +1,118 @@
+// Package tracing sets up OpenTelemetry tracing and carries the W3C trace
+// context of a repository through the NATS messages between the collector,
+// the validator and the downstream scanners.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/nats-io/nats.go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Attributes set on the spans of NATS messages
+var (
+	MessagingSystem = attribute.Key("messaging.system").String("nats")
+	// MessagingDestination is the subject a message is published or
+	// received on
+	MessagingDestination = attribute.Key("messaging.destination.name")
+)
+
+// Attributes describing scans and repositories
+const (
+	RunID        = attribute.Key("secflow.run_id")
+	ScanMode     = attribute.Key("secflow.scan.mode")
+	Provider     = attribute.Key("secflow.provider")
+	Org          = attribute.Key("secflow.org")
+	Repository   = attribute.Key("secflow.repository")
+	RepositoryID = attribute.Key("secflow.repository.id")
+)
+
+// Setup installs the global propagator and, when endpoint is set, a tracer
+// provider exporting spans over OTLP/HTTP to endpoint. Traces without a
+// sampled parent are sampled at sampleRatio. The returned function flushes
+// and stops the exporter.
+func Setup(ctx context.Context, service, version, endpoint string, sampleRatio float64) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	if endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	// The endpoint is the base URL of the collector, as with the
+	// OTEL_EXPORTER_OTLP_ENDPOINT variable of the OpenTelemetry SDKs
+	url := strings.TrimSuffix(endpoint, "/") + "/v1/traces"
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(url))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRatio))),
+		sdktrace.WithResource(resource.NewSchemaless(
+			semconv.ServiceName(service),
+			semconv.ServiceVersion(version),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// HeaderCarrier adapts NATS message headers to the OpenTelemetry propagators.
+// Unlike HTTP headers, NATS headers are case-sensitive, so the traceparent
+// and tracestate keys are kept in lower case.
+type HeaderCarrier nats.Header
+
+// Get implements propagation.TextMapCarrier
+func (c HeaderCarrier) Get(key string) string {
+	return nats.Header(c).Get(key)
+}
+
+// Set implements propagation.TextMapCarrier
+func (c HeaderCarrier) Set(key, value string) {
+	nats.Header(c).Set(key, value)
+}
+
+// Keys implements propagation.TextMapCarrier
+func (c HeaderCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// Inject writes the trace context of ctx into the headers of msg
+func Inject(ctx context.Context, msg *nats.Msg) {
+	if msg.Header == nil {
+		msg.Header = nats.Header{}
+	}
+	otel.GetTextMapPropagator().Inject(ctx, HeaderCarrier(msg.Header))
+}
+
+// Extract returns ctx with the trace context read from the headers of msg
+func Extract(ctx context.Context, msg *nats.Msg) context.Context {
+	if msg.Header == nil {
+		return ctx
+	}
+	return otel.GetTextMapPropagator().Extract(ctx, HeaderCarrier(msg.Header))
+}
+
+// End records err, if any, as the status of span and ends it
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,109 @@
+package tracing
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestInjectExtract(t *testing.T) {
+	if _, err := Setup(context.Background(), "test", "1.0.0", "", 1); err != nil {
+		t.Fatalf("Setup() unexpected error: %v", err)
+	}
+
+	parent := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36},
+		SpanID:     trace.SpanID{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7},
+		TraceFlags: trace.FlagsSampled,
+	})
+	msg := nats.NewMsg("github.repositories")
+	Inject(trace.ContextWithSpanContext(context.Background(), parent), msg)
+
+	want := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	if got := msg.Header.Get("traceparent"); got != want {
+		t.Errorf("traceparent header = %q, want %q", got, want)
+	}
+
+	extracted := trace.SpanContextFromContext(Extract(context.Background(), msg))
+	if !extracted.IsRemote() || extracted.TraceID() != parent.TraceID() || extracted.SpanID() != parent.SpanID() {
+		t.Errorf("Extract() = %v, want remote span context %v", extracted, parent)
+	}
+
+	// Messages without headers carry no trace
+	if sc := trace.SpanContextFromContext(Extract(context.Background(), &nats.Msg{})); sc.IsValid() {
+		t.Errorf("Extract() without headers = %v, want an invalid span context", sc)
+	}
+}
+
+func TestSetupExport(t *testing.T) {
+	// An OTLP/HTTP collector stand-in recording the exported spans
+	requests := make(chan *coltracepb.ExportTraceServiceRequest, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v1/traces" {
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("Failed to read request: %v", err)
+		}
+		var req coltracepb.ExportTraceServiceRequest
+		if err := proto.Unmarshal(body, &req); err != nil {
+			t.Errorf("Failed to unmarshal export request: %v", err)
+		}
+		requests <- &req
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		out, _ := proto.Marshal(&coltracepb.ExportTraceServiceResponse{})
+		_, _ = w.Write(out)
+	}))
+	defer server.Close()
+
+	previous := otel.GetTracerProvider()
+	defer otel.SetTracerProvider(previous)
+
+	shutdown, err := Setup(context.Background(), "secflow-test", "1.2.3", server.URL+"/", 1)
+	if err != nil {
+		t.Fatalf("Setup() unexpected error: %v", err)
+	}
+
+	_, span := otel.Tracer("test").Start(context.Background(), "test span")
+	span.SetAttributes(Repository.String("testorg/repo"))
+	span.End()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := shutdown(ctx); err != nil {
+		t.Fatalf("shutdown() unexpected error: %v", err)
+	}
+
+	select {
+	case req := <-requests:
+		spans := req.GetResourceSpans()
+		if len(spans) != 1 {
+			t.Fatalf("resource spans = %d, want 1", len(spans))
+		}
+		attrs := map[string]string{}
+		for _, kv := range spans[0].GetResource().GetAttributes() {
+			attrs[kv.GetKey()] = kv.GetValue().GetStringValue()
+		}
+		if attrs["service.name"] != "secflow-test" || attrs["service.version"] != "1.2.3" {
+			t.Errorf("resource attributes = %v, want service secflow-test 1.2.3", attrs)
+		}
+		scopes := spans[0].GetScopeSpans()
+		if len(scopes) != 1 || len(scopes[0].GetSpans()) != 1 || scopes[0].GetSpans()[0].GetName() != "test span" {
+			t.Errorf("exported spans = %v, want test span", scopes)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timeout waiting for exported spans")
+	}
+}
@@ -2,40 +2,115 @@ package validator
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"strings"
 
 	"github.com/google/go-github/v57/github"
 	"github.com/klimeurt/secflow-collector/internal/config"
-	"golang.org/x/oauth2"
+	"github.com/klimeurt/secflow-collector/internal/ghclient"
+	"github.com/klimeurt/secflow-collector/internal/gitlab"
+	"github.com/klimeurt/secflow-collector/internal/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
-// Checker handles GitHub API operations for file validation
+// Checker handles GitHub and GitLab API operations for file validation
 type Checker struct {
 	config   *config.Config
 	ghClient *github.Client
+	clients  *ghclient.Factory
+	gitlab   *gitlab.Client
+	// groupClients holds the GitLab clients of groups with a token override
+	groupClients map[string]*gitlab.Client
 }
 
 // NewChecker creates a new Checker instance
 func NewChecker(cfg *config.Config) (*Checker, error) {
-	// Create GitHub client with OAuth2 token
-	ctx := context.Background()
-	ts := oauth2.StaticTokenSource(
-		&oauth2.Token{AccessToken: cfg.GitHubToken},
-	)
-	tc := oauth2.NewClient(ctx, ts)
-	ghClient := github.NewClient(tc)
+	// Create GitHub client factory
+	clients, err := ghclient.NewFactory(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GitHub client: %w", err)
+	}
+
+	// Create GitLab clients
+	gitlabClient, err := gitlab.NewClient(cfg.GitLabURL, cfg.GitLabToken, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GitLab client: %w", err)
+	}
+	groupClients := make(map[string]*gitlab.Client)
+	for _, group := range cfg.GitLabGroups {
+		if group.Token == "" {
+			continue
+		}
+		if groupClients[group.Name], err = gitlab.NewClient(cfg.GitLabURL, group.Token, nil); err != nil {
+			return nil, fmt.Errorf("failed to create GitLab client for %s: %w", group.Name, err)
+		}
+	}
 
 	return &Checker{
-		config:   cfg,
-		ghClient: ghClient,
+		config:       cfg,
+		ghClient:     clients.Default(),
+		clients:      clients,
+		gitlab:       gitlabClient,
+		groupClients: groupClients,
 	}, nil
 }
 
-// HasAppSecConfig checks if the repository has an appsec-config.yml file in the root
-func (c *Checker) HasAppSecConfig(ctx context.Context, owner, repo string) (bool, error) {
+// gitlabFor returns the GitLab client for projects owned by owner, the full
+// path of a group or subgroup. It uses the token override of the closest
+// configured group the owner belongs to, or GitLabToken.
+func (c *Checker) gitlabFor(owner string) *gitlab.Client {
+	var client *gitlab.Client
+	var matched string
+	for group, groupClient := range c.groupClients {
+		if owner != group && !strings.HasPrefix(owner, group+"/") {
+			continue
+		}
+		if len(group) > len(matched) {
+			client, matched = groupClient, group
+		}
+	}
+	if client == nil {
+		return c.gitlab
+	}
+	return client
+}
+
+// Check checks if a repository hosted by provider has an appsec-config.yml
+// file in the root. An empty provider is GitHub.
+func (c *Checker) Check(ctx context.Context, provider, owner, repo string) (bool, error) {
+	switch provider {
+	case "", config.ProviderGitHub:
+		return c.HasAppSecConfig(ctx, owner, repo)
+	case config.ProviderGitLab:
+		return c.HasGitLabAppSecConfig(ctx, owner, repo)
+	default:
+		return false, fmt.Errorf("unsupported provider %q", provider)
+	}
+}
+
+// HasAppSecConfig checks if the GitHub repository has an appsec-config.yml file in the root
+func (c *Checker) HasAppSecConfig(ctx context.Context, owner, repo string) (found bool, err error) {
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "validator.HasAppSecConfig", trace.WithAttributes(
+		tracing.Provider.String(config.ProviderGitHub),
+		tracing.Repository.String(owner+"/"+repo),
+	))
+	defer func() {
+		span.SetAttributes(attribute.Bool("secflow.appsec_config", found))
+		tracing.End(span, err)
+	}()
+
+	client, err := c.clients.ForOrg(ctx, owner)
+	if err != nil {
+		return false, err
+	}
+
 	// Try to get the file content to check if it exists
-	_, _, resp, err := c.ghClient.Repositories.GetContents(
+	_, _, resp, err := client.Repositories.GetContents(
 		ctx,
 		owner,
 		repo,
@@ -52,4 +127,42 @@ func (c *Checker) HasAppSecConfig(ctx context.Context, owner, repo string) (bool
 	}
 
 	return true, nil
-}
\ No newline at end of file
+}
+
+// IsTransient reports whether a HasAppSecConfig error is worth retrying:
+// rate limits, server errors, timeouts and connection failures. Other errors,
+// such as bad credentials or missing permissions, will not go away on retry.
+func IsTransient(err error) bool {
+	var rateLimitErr *github.RateLimitError
+	if errors.As(err, &rateLimitErr) {
+		return true
+	}
+
+	var abuseErr *github.AbuseRateLimitError
+	if errors.As(err, &abuseErr) {
+		return true
+	}
+
+	var respErr *github.ErrorResponse
+	if errors.As(err, &respErr) && respErr.Response != nil {
+		code := respErr.Response.StatusCode
+		return code >= http.StatusInternalServerError || code == http.StatusTooManyRequests
+	}
+
+	var gitlabErr *gitlab.ErrorResponse
+	if errors.As(err, &gitlabErr) {
+		code := gitlabErr.StatusCode
+		return code >= http.StatusInternalServerError || code == http.StatusTooManyRequests
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	return false
+}
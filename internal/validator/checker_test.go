@@ -2,8 +2,13 @@ package validator
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"net/http"
 	"testing"
 
+	"github.com/google/go-github/v57/github"
+
 	"github.com/klimeurt/secflow-collector/internal/config"
 )
 
@@ -51,4 +56,35 @@ func TestHasAppSecConfig(t *testing.T) {
 	}
 	// We expect an error here since we're using a test token
 	// The important thing is that the method doesn't panic
-}
\ No newline at end of file
+}
+
+func TestIsTransient(t *testing.T) {
+	respErr := func(code int) error {
+		return &github.ErrorResponse{Response: &http.Response{StatusCode: code}}
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"server error", respErr(http.StatusInternalServerError), true},
+		{"bad gateway", respErr(http.StatusBadGateway), true},
+		{"too many requests", respErr(http.StatusTooManyRequests), true},
+		{"primary rate limit", &github.RateLimitError{}, true},
+		{"secondary rate limit", &github.AbuseRateLimitError{}, true},
+		{"wrapped rate limit", fmt.Errorf("check failed: %w", &github.RateLimitError{}), true},
+		{"timeout", context.DeadlineExceeded, true},
+		{"bad credentials", respErr(http.StatusUnauthorized), false},
+		{"forbidden", respErr(http.StatusForbidden), false},
+		{"other error", errors.New("boom"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsTransient(tt.err); got != tt.want {
+				t.Errorf("IsTransient(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,17 @@
+package validator
+
+import (
+	"context"
+	"fmt"
+)
+
+// HasGitLabAppSecConfig checks if the GitLab project owner/repo has an
+// appsec-config.yml file in the root of its default branch. The owner is the
+// full path of the project's group, including any subgroups.
+func (c *Checker) HasGitLabAppSecConfig(ctx context.Context, owner, repo string) (bool, error) {
+	exists, err := c.gitlabFor(owner).FileExists(ctx, owner+"/"+repo, "", "appsec-config.yml")
+	if err != nil {
+		return false, fmt.Errorf("failed to check for appsec-config.yml: %w", err)
+	}
+	return exists, nil
+}
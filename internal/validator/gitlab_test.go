@@ -0,0 +1,148 @@
+package validator
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/klimeurt/secflow-collector/internal/collector"
+	"github.com/klimeurt/secflow-collector/internal/config"
+	"github.com/nats-io/nats.go"
+)
+
+func TestProcessMessageGitLab(t *testing.T) {
+	glServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.EscapedPath() {
+		case "/api/v4/projects/platform%2Fbackend%2Fwith-config",
+			"/api/v4/projects/platform%2Fbackend%2Fwithout-config":
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"id": 1, "default_branch": "main"})
+		case "/api/v4/projects/platform%2Fbackend%2Fwith-config/repository/files/appsec-config.yml":
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_ = json.NewEncoder(w).Encode(map[string]string{"message": "404 Not Found"})
+		}
+	}))
+	defer glServer.Close()
+
+	natsServer := runMockJetStreamServer(t)
+	defer natsServer.Shutdown()
+
+	nc, err := nats.Connect(natsServer.ClientURL())
+	if err != nil {
+		t.Fatalf("Failed to connect to NATS: %v", err)
+	}
+	defer nc.Close()
+
+	cfg := &config.Config{
+		GitLabURL:           glServer.URL,
+		ValidReposSubject:   "repos.valid",
+		InvalidReposSubject: "repos.invalid",
+		DeadLetterSubject:   "repos.deadletter",
+		CheckMaxAttempts:    1,
+	}
+
+	checker, err := NewChecker(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create checker: %v", err)
+	}
+	processor := NewProcessor(cfg, checker, nc)
+
+	messages := make(chan *nats.Msg, 10)
+	if _, err := nc.ChanSubscribe("repos.>", messages); err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		provider    string
+		wantSubject string
+	}{
+		{name: "with-config", provider: config.ProviderGitLab, wantSubject: "repos.valid"},
+		{name: "without-config", provider: config.ProviderGitLab, wantSubject: "repos.invalid"},
+		{name: "with-config", provider: "bitbucket", wantSubject: "repos.deadletter"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.provider+"/"+tt.name, func(t *testing.T) {
+			data, _ := json.Marshal(collector.Repository{
+				Name:     tt.name,
+				CloneURL: "https://gitlab.example.com/platform/backend/" + tt.name + ".git",
+				Provider: tt.provider,
+			})
+			if err := processor.ProcessMessage(context.Background(), &nats.Msg{Subject: "gitlab.repositories", Data: data}); err != nil {
+				t.Fatalf("ProcessMessage() unexpected error: %v", err)
+			}
+
+			select {
+			case routed := <-messages:
+				if routed.Subject != tt.wantSubject {
+					t.Errorf("Routed to %s, want %s", routed.Subject, tt.wantSubject)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("Timeout waiting for routed message")
+			}
+		})
+	}
+}
+
+func TestHasGitLabAppSecConfigGroupToken(t *testing.T) {
+	var mu sync.Mutex
+	var token string
+	glServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		token = r.Header.Get("PRIVATE-TOKEN")
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		if !strings.Contains(r.URL.Path, "/repository/files/") {
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"id": 1, "default_branch": "main"})
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(w).Encode(map[string]string{"message": "404 Not Found"})
+	}))
+	defer glServer.Close()
+
+	cfg := &config.Config{
+		GitLabURL:   glServer.URL,
+		GitLabToken: "default-token",
+		GitLabGroups: []config.OrgConfig{
+			{Name: "platform", Provider: config.ProviderGitLab, Token: "platform-token"},
+			{Name: "platform/backend", Provider: config.ProviderGitLab, Token: "backend-token"},
+			{Name: "security", Provider: config.ProviderGitLab},
+		},
+	}
+	checker, err := NewChecker(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create checker: %v", err)
+	}
+
+	tests := []struct {
+		owner     string
+		wantToken string
+	}{
+		{owner: "platform", wantToken: "platform-token"},
+		{owner: "platform/frontend", wantToken: "platform-token"},
+		{owner: "platform/backend/api", wantToken: "backend-token"},
+		{owner: "platform-tools", wantToken: "default-token"},
+		{owner: "security", wantToken: "default-token"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.owner, func(t *testing.T) {
+			if _, err := checker.HasGitLabAppSecConfig(context.Background(), tt.owner, "repo"); err != nil {
+				t.Fatalf("HasGitLabAppSecConfig() unexpected error: %v", err)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if token != tt.wantToken {
+				t.Errorf("PRIVATE-TOKEN = %q, want %q", token, tt.wantToken)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package validator
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/klimeurt/secflow-collector/internal/config"
+	"github.com/klimeurt/secflow-collector/internal/health"
+)
+
+// ReadinessChecks returns the checks of the readiness probe: the NATS
+// connection, the subscription or JetStream consumer, and the reachability
+// of the GitHub API with the configured credentials
+func (v *Validator) ReadinessChecks() []health.Check {
+	var orgs []string
+	for _, org := range v.config.Organizations() {
+		if org.Provider == config.ProviderGitHub {
+			orgs = append(orgs, org.Name)
+		}
+	}
+
+	return []health.Check{
+		health.NATS(v.nc),
+		{Name: "consumer", Check: v.checkConsuming},
+		{
+			Name:  "github",
+			Check: func(ctx context.Context) error { return v.checker.clients.Ping(ctx, orgs) },
+			TTL:   health.RemoteCheckTTL,
+		},
+	}
+}
+
+// checkConsuming returns an error unless the validator is receiving messages
+// through its subscriptions or JetStream consumer
+func (v *Validator) checkConsuming(context.Context) error {
+	if v.consumeCtx != nil {
+		select {
+		case <-v.consumeCtx.Closed():
+			return fmt.Errorf("consumer %s stopped", v.config.ConsumerName)
+		default:
+			return nil
+		}
+	}
+	if len(v.subs) == 0 {
+		return fmt.Errorf("not subscribed to %s", v.config.SourceSubject)
+	}
+	for _, sub := range v.subs {
+		if !sub.IsValid() {
+			return fmt.Errorf("not subscribed to %s", sub.Subject)
+		}
+	}
+	return nil
+}
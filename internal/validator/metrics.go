@@ -0,0 +1,64 @@
+package validator
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Outcomes of processing a message
+const (
+	outcomeValid   = "valid"
+	outcomeInvalid = "invalid"
+	outcomeError   = "error"
+)
+
+// processorMetrics holds the Prometheus metrics of a processor
+type processorMetrics struct {
+	processed     *prometheus.CounterVec
+	checkDuration *prometheus.HistogramVec
+}
+
+// newProcessorMetrics creates the processor metrics, unregistered
+func newProcessorMetrics() *processorMetrics {
+	m := &processorMetrics{
+		processed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "secflow_validator_messages_processed_total",
+			Help: "Repository messages processed, by outcome: valid, invalid or error.",
+		}, []string{"outcome"}),
+		checkDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "secflow_validator_check_duration_seconds",
+			Help:    "Duration of appsec-config.yml checks, by provider and result: found, missing or error.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"provider", "result"}),
+	}
+	// Report every outcome from the start, so rates work before the first
+	// message of each kind
+	for _, outcome := range []string{outcomeValid, outcomeInvalid, outcomeError} {
+		m.processed.WithLabelValues(outcome)
+	}
+	return m
+}
+
+// Collectors returns the Prometheus collectors of the validator: the
+// processed messages, check latencies, busy workers, dropped messages, and
+// the requests, rate limits and cache of its GitHub clients
+func (v *Validator) Collectors() []prometheus.Collector {
+	inFlight := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "secflow_validator_workers_in_flight",
+		Help: "Workers currently processing a message.",
+	}, func() float64 {
+		return float64(v.pool.InFlight())
+	})
+	dropped := prometheus.NewCounterFunc(prometheus.CounterOpts{
+		Name: "secflow_validator_messages_dropped_total",
+		Help: "Messages dropped by the core NATS subscription as a slow consumer.",
+	}, func() float64 {
+		return float64(v.droppedMessages())
+	})
+	return []prometheus.Collector{
+		v.processor.metrics.processed,
+		v.processor.metrics.checkDuration,
+		inFlight,
+		dropped,
+		v.checker.clients.Collector(),
+	}
+}
@@ -0,0 +1,89 @@
+package validator
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+// errPoolStopped is returned when submitting to a stopped worker pool
+var errPoolStopped = errors.New("worker pool stopped")
+
+// workerPool runs jobs on a fixed number of goroutines fed from a bounded
+// queue. Submit blocks while the queue is full, which pushes backpressure
+// back to the NATS subscription or consumer feeding the pool.
+type workerPool struct {
+	jobs     chan func()
+	wg       sync.WaitGroup
+	mu       sync.RWMutex
+	stopped  bool
+	inFlight atomic.Int64
+}
+
+// newWorkerPool starts size workers reading from a queue of queueSize jobs
+func newWorkerPool(size, queueSize int) *workerPool {
+	if size < 1 {
+		size = 1
+	}
+	if queueSize < 0 {
+		queueSize = 0
+	}
+
+	p := &workerPool{
+		jobs: make(chan func(), queueSize),
+	}
+
+	p.wg.Add(size)
+	for i := 0; i < size; i++ {
+		go p.work()
+	}
+
+	return p
+}
+
+// work runs queued jobs until the queue is closed
+func (p *workerPool) work() {
+	defer p.wg.Done()
+
+	for job := range p.jobs {
+		p.inFlight.Add(1)
+		job()
+		p.inFlight.Add(-1)
+	}
+}
+
+// Submit queues a job, blocking until there is room in the queue or ctx is
+// done
+func (p *workerPool) Submit(ctx context.Context, job func()) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.stopped {
+		return errPoolStopped
+	}
+
+	select {
+	case p.jobs <- job:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// InFlight returns the number of jobs currently being run
+func (p *workerPool) InFlight() int {
+	return int(p.inFlight.Load())
+}
+
+// Stop stops accepting jobs and waits for queued and running jobs to finish
+func (p *workerPool) Stop() {
+	p.mu.Lock()
+	if !p.stopped {
+		p.stopped = true
+		close(p.jobs)
+	}
+	p.mu.Unlock()
+
+	p.wg.Wait()
+}
@@ -0,0 +1,82 @@
+package validator
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWorkerPoolConcurrencyLimit(t *testing.T) {
+	pool := newWorkerPool(3, 10)
+
+	var running, maxRunning atomic.Int64
+	var wg sync.WaitGroup
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		err := pool.Submit(context.Background(), func() {
+			defer wg.Done()
+
+			n := running.Add(1)
+			for {
+				m := maxRunning.Load()
+				if n <= m || maxRunning.CompareAndSwap(m, n) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+			running.Add(-1)
+		})
+		if err != nil {
+			t.Fatalf("Submit() unexpected error: %v", err)
+		}
+	}
+
+	wg.Wait()
+	pool.Stop()
+
+	if got := maxRunning.Load(); got > 3 {
+		t.Errorf("Max concurrent jobs = %d, want at most 3", got)
+	}
+}
+
+func TestWorkerPoolBackpressure(t *testing.T) {
+	pool := newWorkerPool(1, 1)
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+
+	// Occupy the single worker
+	if err := pool.Submit(context.Background(), func() {
+		close(started)
+		<-release
+	}); err != nil {
+		t.Fatalf("Submit() unexpected error: %v", err)
+	}
+	<-started
+
+	if pool.InFlight() != 1 {
+		t.Errorf("InFlight() = %d, want 1", pool.InFlight())
+	}
+
+	// Fill the queue
+	if err := pool.Submit(context.Background(), func() {}); err != nil {
+		t.Fatalf("Submit() unexpected error: %v", err)
+	}
+
+	// A saturated pool blocks until the context is done
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := pool.Submit(ctx, func() {}); err != context.DeadlineExceeded {
+		t.Errorf("Submit() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	close(release)
+	pool.Stop()
+
+	if err := pool.Submit(context.Background(), func() {}); err != errPoolStopped {
+		t.Errorf("Submit() after Stop error = %v, want %v", err, errPoolStopped)
+	}
+}
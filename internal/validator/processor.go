@@ -4,12 +4,32 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
+	"net/url"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/klimeurt/secflow-collector/internal/collector"
 	"github.com/klimeurt/secflow-collector/internal/config"
+	"github.com/klimeurt/secflow-collector/internal/tracing"
 	"github.com/nats-io/nats.go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is the instrumentation scope of the spans of processed messages
+// and their checks
+const tracerName = "github.com/klimeurt/secflow-collector/internal/validator"
+
+// Headers set on messages routed to the dead-letter subject
+const (
+	HeaderError         = "Secflow-Error"
+	HeaderTransient     = "Secflow-Error-Transient"
+	HeaderAttempts      = "Secflow-Attempts"
+	HeaderSourceSubject = "Secflow-Source-Subject"
+	HeaderFailedAt      = "Secflow-Failed-At"
 )
 
 // Processor handles message processing and routing
@@ -17,6 +37,7 @@ type Processor struct {
 	config  *config.Config
 	checker *Checker
 	nc      *nats.Conn
+	metrics *processorMetrics
 }
 
 // NewProcessor creates a new Processor instance
@@ -25,78 +46,208 @@ func NewProcessor(cfg *config.Config, checker *Checker, nc *nats.Conn) *Processo
 		config:  cfg,
 		checker: checker,
 		nc:      nc,
+		metrics: newProcessorMetrics(),
 	}
 }
 
-// ProcessMessage processes a repository message and routes it to appropriate queue
+// ProcessMessage processes a repository message and routes it to appropriate
+// queue. The span of the message continues the trace of the collector, and
+// the routed message carries it on to the downstream scanners.
 func (p *Processor) ProcessMessage(ctx context.Context, msg *nats.Msg) error {
+	ctx, span := otel.Tracer(tracerName).Start(tracing.Extract(ctx, msg), "process "+msg.Subject,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			tracing.MessagingSystem,
+			tracing.MessagingDestination.String(msg.Subject),
+			tracing.RunID.String(msg.Header.Get(collector.HeaderRunID)),
+		))
+
+	outcome, err := p.process(ctx, msg)
+	if err != nil {
+		outcome = outcomeError
+	}
+	p.metrics.processed.WithLabelValues(outcome).Inc()
+
+	span.SetAttributes(attribute.String("secflow.outcome", outcome))
+	tracing.End(span, err)
+	return err
+}
+
+// process checks and routes a repository message, and returns the outcome.
+// Messages routed to the dead-letter subject are an error outcome.
+func (p *Processor) process(ctx context.Context, msg *nats.Msg) (string, error) {
 	// Parse the repository message
 	var repo collector.Repository
 	if err := json.Unmarshal(msg.Data, &repo); err != nil {
-		return fmt.Errorf("failed to unmarshal repository message: %w", err)
+		return "", fmt.Errorf("failed to unmarshal repository message: %w", err)
 	}
 
-	log.Printf("Processing repository: %s", repo.Name)
+	logger := slog.With("provider", repo.Provider, "repo", repo.FullName,
+		"run_id", msg.Header.Get(collector.HeaderRunID), "subject", msg.Subject)
+	logger.Debug("Processing repository")
+	trace.SpanFromContext(ctx).SetAttributes(
+		tracing.Provider.String(repo.Provider),
+		tracing.Repository.String(repo.FullName),
+		tracing.RepositoryID.Int64(repo.ID),
+	)
 
-	// Extract owner from clone URL
-	owner, err := p.extractOwnerFromURL(repo.CloneURL)
-	if err != nil {
-		return fmt.Errorf("failed to extract owner from URL %s: %w", repo.CloneURL, err)
+	// Messages from older collectors carry no owner, which is then
+	// extracted from the clone URL together with the repository name
+	owner, name := repo.Owner, repo.Name
+	if owner == "" {
+		var err error
+		if owner, name, err = parseRepoURL(repo.CloneURL); err != nil {
+			return "", fmt.Errorf("failed to extract owner from URL %s: %w", repo.CloneURL, err)
+		}
 	}
 
-	// Check if repository has appsec-config.yml
-	hasConfig, err := p.checker.HasAppSecConfig(ctx, owner, repo.Name)
+	// Check if repository has appsec-config.yml, retrying transient errors
+	hasConfig, attempts, err := p.checkWithRetry(ctx, repo.Provider, owner, name)
 	if err != nil {
-		log.Printf("Error checking appsec-config.yml for %s/%s: %v", owner, repo.Name, err)
-		// Route to invalid queue on error
-		hasConfig = false
+		if ctx.Err() != nil {
+			return "", fmt.Errorf("check for %s/%s interrupted: %w", owner, name, err)
+		}
+		logger.Warn("Failed to check appsec-config.yml, routing to the dead-letter subject",
+			"attempts", attempts, "dead_letter_subject", p.config.DeadLetterSubject, "error", err)
+		return outcomeError, p.publishDeadLetter(ctx, msg, err, attempts)
 	}
 
 	// Route message to appropriate queue
-	var targetSubject string
+	targetSubject, outcome := p.config.InvalidReposSubject, outcomeInvalid
 	if hasConfig {
-		targetSubject = p.config.ValidReposSubject
-		log.Printf("Repository %s has appsec-config.yml - routing to %s", repo.Name, targetSubject)
-	} else {
-		targetSubject = p.config.InvalidReposSubject
-		log.Printf("Repository %s missing appsec-config.yml - routing to %s", repo.Name, targetSubject)
+		targetSubject, outcome = p.config.ValidReposSubject, outcomeValid
+	}
+
+	// Publish to target queue, keeping the run ID of the scan and the trace
+	routed := nats.NewMsg(targetSubject)
+	routed.Data = msg.Data
+	copyRunID(routed, msg)
+	tracing.Inject(ctx, routed)
+	if err := p.nc.PublishMsg(routed); err != nil {
+		return "", fmt.Errorf("failed to publish to %s: %w", targetSubject, err)
 	}
 
-	// Publish to target queue
-	if err := p.nc.Publish(targetSubject, msg.Data); err != nil {
-		return fmt.Errorf("failed to publish to %s: %w", targetSubject, err)
+	logger.Debug("Routed repository", "outcome", outcome, "target_subject", targetSubject)
+	return outcome, nil
+}
+
+// checkWithRetry checks the repository with the provider's checker, retrying
+// transient errors with exponential backoff. It returns the number of
+// attempts made.
+func (p *Processor) checkWithRetry(ctx context.Context, provider, owner, repo string) (bool, int, error) {
+	maxAttempts := p.config.CheckMaxAttempts
+	if maxAttempts < 1 {
+		maxAttempts = 1
 	}
+	backoff := p.config.CheckRetryBackoff
+
+	for attempt := 1; ; attempt++ {
+		hasConfig, err := p.timedCheck(ctx, provider, owner, repo)
+		if err == nil {
+			return hasConfig, attempt, nil
+		}
+		if !IsTransient(err) || attempt >= maxAttempts {
+			return false, attempt, err
+		}
+
+		slog.Warn("Transient error checking repository, retrying", "provider", provider, "repo", owner+"/"+repo,
+			"attempt", attempt, "max_attempts", maxAttempts, "backoff", backoff.String(), "error", err)
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return false, attempt, ctx.Err()
+		}
 
+		backoff *= 2
+		if p.config.CheckRetryMaxBackoff > 0 && backoff > p.config.CheckRetryMaxBackoff {
+			backoff = p.config.CheckRetryMaxBackoff
+		}
+	}
+}
+
+// timedCheck checks the repository and records how long the check took
+func (p *Processor) timedCheck(ctx context.Context, provider, owner, repo string) (bool, error) {
+	start := time.Now()
+	hasConfig, err := p.checker.Check(ctx, provider, owner, repo)
+
+	if provider == "" {
+		provider = config.ProviderGitHub
+	}
+	result := "missing"
+	switch {
+	case err != nil:
+		result = "error"
+	case hasConfig:
+		result = "found"
+	}
+	p.metrics.checkDuration.WithLabelValues(provider, result).Observe(time.Since(start).Seconds())
+	return hasConfig, err
+}
+
+// publishDeadLetter publishes a message whose check could not be completed to
+// the dead-letter subject, with headers describing the failure
+func (p *Processor) publishDeadLetter(ctx context.Context, msg *nats.Msg, checkErr error, attempts int) error {
+	dlq := nats.NewMsg(p.config.DeadLetterSubject)
+	dlq.Data = msg.Data
+	dlq.Header.Set(HeaderError, checkErr.Error())
+	dlq.Header.Set(HeaderTransient, strconv.FormatBool(IsTransient(checkErr)))
+	dlq.Header.Set(HeaderAttempts, strconv.Itoa(attempts))
+	dlq.Header.Set(HeaderSourceSubject, msg.Subject)
+	dlq.Header.Set(HeaderFailedAt, time.Now().UTC().Format(time.RFC3339))
+	copyRunID(dlq, msg)
+	tracing.Inject(ctx, dlq)
+
+	if err := p.nc.PublishMsg(dlq); err != nil {
+		return fmt.Errorf("failed to publish to %s: %w", p.config.DeadLetterSubject, err)
+	}
 	return nil
 }
 
-// extractOwnerFromURL extracts the owner/organization from a GitHub clone URL
-func (p *Processor) extractOwnerFromURL(cloneURL string) (string, error) {
+// copyRunID copies the scan run ID header of the collector, if any, from msg
+// to routed
+func copyRunID(routed, msg *nats.Msg) {
+	if runID := msg.Header.Get(collector.HeaderRunID); runID != "" {
+		routed.Header.Set(collector.HeaderRunID, runID)
+	}
+}
+
+// parseRepoURL extracts the owner and repository name from a clone URL on any
+// host, such as github.com or a GitHub Enterprise Server instance. The owner
+// is every path segment before the repository name.
+func parseRepoURL(cloneURL string) (string, string, error) {
 	// Example URLs:
 	// https://github.com/owner/repo.git
+	// https://ghes.example.com:8443/owner/repo.git
+	// ssh://git@ghes.example.com:2222/owner/repo.git
 	// git@github.com:owner/repo.git
-	
-	if strings.HasPrefix(cloneURL, "https://github.com/") {
-		// Remove prefix and suffix
-		path := strings.TrimPrefix(cloneURL, "https://github.com/")
-		path = strings.TrimSuffix(path, ".git")
-		
-		// Split by / and get the first part (owner)
-		parts := strings.Split(path, "/")
-		if len(parts) >= 1 {
-			return parts[0], nil
+
+	var path string
+	if strings.Contains(cloneURL, "://") {
+		u, err := url.Parse(cloneURL)
+		if err != nil || u.Host == "" {
+			return "", "", fmt.Errorf("unable to parse owner from URL: %s", cloneURL)
 		}
-	} else if strings.HasPrefix(cloneURL, "git@github.com:") {
-		// Remove prefix and suffix
-		path := strings.TrimPrefix(cloneURL, "git@github.com:")
-		path = strings.TrimSuffix(path, ".git")
-		
-		// Split by / and get the first part (owner)
-		parts := strings.Split(path, "/")
-		if len(parts) >= 1 {
-			return parts[0], nil
+		path = u.Path
+	} else {
+		// scp-like syntax: [user@]host:owner/repo.git
+		host, rest, ok := strings.Cut(cloneURL, ":")
+		if !ok || host == "" || strings.Contains(host, "/") {
+			return "", "", fmt.Errorf("unable to parse owner from URL: %s", cloneURL)
 		}
+		path = rest
 	}
-	
-	return "", fmt.Errorf("unable to parse owner from URL: %s", cloneURL)
-}
\ No newline at end of file
+
+	path = strings.TrimSuffix(strings.Trim(path, "/"), ".git")
+	parts := strings.Split(path, "/")
+	if len(parts) < 2 {
+		return "", "", fmt.Errorf("unable to parse owner from URL: %s", cloneURL)
+	}
+	for _, part := range parts {
+		if part == "" {
+			return "", "", fmt.Errorf("unable to parse owner from URL: %s", cloneURL)
+		}
+	}
+
+	return strings.Join(parts[:len(parts)-1], "/"), parts[len(parts)-1], nil
+}
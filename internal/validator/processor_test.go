@@ -1,54 +1,91 @@
 package validator
 
 import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/klimeurt/secflow-collector/internal/collector"
+	"github.com/klimeurt/secflow-collector/internal/config"
+	"github.com/klimeurt/secflow-collector/internal/tracing"
+	"github.com/nats-io/nats.go"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
 )
 
-func TestExtractOwnerFromURL(t *testing.T) {
-	processor := &Processor{}
-	
+func TestParseRepoURL(t *testing.T) {
 	tests := []struct {
-		name     string
-		url      string
-		expected string
-		hasError bool
+		name         string
+		url          string
+		expected     string
+		expectedRepo string
+		hasError     bool
 	}{
 		{
-			name:     "HTTPS URL",
-			url:      "https://github.com/klimeurt/secflow-collector.git",
-			expected: "klimeurt",
-			hasError: false,
+			name:         "HTTPS URL",
+			url:          "https://github.com/klimeurt/secflow-collector.git",
+			expected:     "klimeurt",
+			expectedRepo: "secflow-collector",
+		},
+		{
+			name:         "SSH URL",
+			url:          "git@github.com:klimeurt/secflow-collector.git",
+			expected:     "klimeurt",
+			expectedRepo: "secflow-collector",
+		},
+		{
+			name:         "HTTPS URL without .git",
+			url:          "https://github.com/klimeurt/secflow-collector",
+			expected:     "klimeurt",
+			expectedRepo: "secflow-collector",
+		},
+		{
+			name:         "SSH URL without .git",
+			url:          "git@github.com:klimeurt/secflow-collector",
+			expected:     "klimeurt",
+			expectedRepo: "secflow-collector",
 		},
 		{
-			name:     "SSH URL",
-			url:      "git@github.com:klimeurt/secflow-collector.git",
-			expected: "klimeurt",
-			hasError: false,
+			name:         "Enterprise HTTPS URL with port",
+			url:          "https://ghes.example.com:8443/platform/service.git",
+			expected:     "platform",
+			expectedRepo: "service",
 		},
 		{
-			name:     "HTTPS URL without .git",
-			url:      "https://github.com/klimeurt/secflow-collector",
-			expected: "klimeurt",
-			hasError: false,
+			name:         "Enterprise SSH URL",
+			url:          "git@ghes.example.com:platform/service.git",
+			expected:     "platform",
+			expectedRepo: "service",
 		},
 		{
-			name:     "SSH URL without .git",
-			url:      "git@github.com:klimeurt/secflow-collector",
-			expected: "klimeurt",
-			hasError: false,
+			name:         "SSH scheme URL with port",
+			url:          "ssh://git@ghes.example.com:2222/platform/service.git",
+			expected:     "platform",
+			expectedRepo: "service",
 		},
 		{
 			name:     "Invalid URL",
 			url:      "invalid-url",
-			expected: "",
+			hasError: true,
+		},
+		{
+			name:     "URL without repository",
+			url:      "https://ghes.example.com/platform",
 			hasError: true,
 		},
 	}
-	
+
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			owner, err := processor.extractOwnerFromURL(tt.url)
-			
+			owner, repo, err := parseRepoURL(tt.url)
+
 			if tt.hasError {
 				if err == nil {
 					t.Errorf("Expected error for URL %s, but got none", tt.url)
@@ -60,7 +97,356 @@ func TestExtractOwnerFromURL(t *testing.T) {
 				if owner != tt.expected {
 					t.Errorf("Expected owner %s for URL %s, but got %s", tt.expected, tt.url, owner)
 				}
+				if repo != tt.expectedRepo {
+					t.Errorf("Expected repository %s for URL %s, but got %s", tt.expectedRepo, tt.url, repo)
+				}
+			}
+		})
+	}
+}
+
+func TestProcessMessageRouting(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []int // status per attempt, the last one repeats
+		wantSubject  string
+		wantOutcome  string
+		wantAttempts int
+		wantHeaders  map[string]string
+	}{
+		{
+			name:         "config present",
+			statuses:     []int{http.StatusOK},
+			wantSubject:  "repos.valid",
+			wantOutcome:  outcomeValid,
+			wantAttempts: 1,
+		},
+		{
+			name:         "config missing",
+			statuses:     []int{http.StatusNotFound},
+			wantSubject:  "repos.invalid",
+			wantOutcome:  outcomeInvalid,
+			wantAttempts: 1,
+		},
+		{
+			name:         "transient errors then success",
+			statuses:     []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusOK},
+			wantSubject:  "repos.valid",
+			wantOutcome:  outcomeValid,
+			wantAttempts: 3,
+		},
+		{
+			name:         "transient errors exhaust retries",
+			statuses:     []int{http.StatusServiceUnavailable},
+			wantSubject:  "repos.deadletter",
+			wantOutcome:  outcomeError,
+			wantAttempts: 3,
+			wantHeaders: map[string]string{
+				HeaderAttempts:      "3",
+				HeaderTransient:     "true",
+				HeaderSourceSubject: "github.repositories",
+			},
+		},
+		{
+			name:         "permanent error is not retried",
+			statuses:     []int{http.StatusUnauthorized},
+			wantSubject:  "repos.deadletter",
+			wantOutcome:  outcomeError,
+			wantAttempts: 1,
+			wantHeaders: map[string]string{
+				HeaderAttempts:  "1",
+				HeaderTransient: "false",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			ghServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := int(calls.Add(1))
+				status := tt.statuses[len(tt.statuses)-1]
+				if n <= len(tt.statuses) {
+					status = tt.statuses[n-1]
+				}
+
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(status)
+				if status == http.StatusOK {
+					_ = json.NewEncoder(w).Encode(map[string]string{"type": "file", "name": "appsec-config.yml"})
+					return
+				}
+				_ = json.NewEncoder(w).Encode(map[string]string{"message": http.StatusText(status)})
+			}))
+			defer ghServer.Close()
+
+			natsServer := runMockJetStreamServer(t)
+			defer natsServer.Shutdown()
+
+			nc, err := nats.Connect(natsServer.ClientURL())
+			if err != nil {
+				t.Fatalf("Failed to connect to NATS: %v", err)
+			}
+			defer nc.Close()
+
+			cfg := &config.Config{
+				GitHubToken:          "test-token",
+				ValidReposSubject:    "repos.valid",
+				InvalidReposSubject:  "repos.invalid",
+				DeadLetterSubject:    "repos.deadletter",
+				CheckMaxAttempts:     3,
+				CheckRetryBackoff:    time.Millisecond,
+				CheckRetryMaxBackoff: 5 * time.Millisecond,
+			}
+
+			checker, err := NewChecker(cfg)
+			if err != nil {
+				t.Fatalf("Failed to create checker: %v", err)
+			}
+			checker.ghClient.BaseURL = mustParseURL(ghServer.URL + "/")
+
+			messages := make(chan *nats.Msg, 10)
+			if _, err := nc.ChanSubscribe("repos.>", messages); err != nil {
+				t.Fatalf("Failed to subscribe: %v", err)
+			}
+
+			data, _ := json.Marshal(collector.Repository{
+				Name:     "repo",
+				CloneURL: "https://github.com/org/repo.git",
+			})
+			msg := nats.NewMsg("github.repositories")
+			msg.Data = data
+			msg.Header.Set(collector.HeaderRunID, "run-1")
+
+			processor := NewProcessor(cfg, checker, nc)
+			if err := processor.ProcessMessage(context.Background(), msg); err != nil {
+				t.Fatalf("ProcessMessage() unexpected error: %v", err)
+			}
+
+			select {
+			case routed := <-messages:
+				if routed.Subject != tt.wantSubject {
+					t.Errorf("Routed to %s, want %s", routed.Subject, tt.wantSubject)
+				}
+				for k, want := range tt.wantHeaders {
+					if got := routed.Header.Get(k); got != want {
+						t.Errorf("Header %s = %q, want %q", k, got, want)
+					}
+				}
+				if tt.wantHeaders != nil && routed.Header.Get(HeaderError) == "" {
+					t.Errorf("Header %s not set", HeaderError)
+				}
+				if got := routed.Header.Get(collector.HeaderRunID); got != "run-1" {
+					t.Errorf("Header %s = %q, want %q", collector.HeaderRunID, got, "run-1")
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("Timeout waiting for routed message")
+			}
+
+			if got := int(calls.Load()); got != tt.wantAttempts {
+				t.Errorf("GitHub calls = %d, want %d", got, tt.wantAttempts)
+			}
+			if got := testutil.ToFloat64(processor.metrics.processed.WithLabelValues(tt.wantOutcome)); got != 1 {
+				t.Errorf("%s messages processed = %v, want 1", tt.wantOutcome, got)
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+
+func TestProcessMessageEnterprise(t *testing.T) {
+	// Stand-in for a GitHub Enterprise Server instance, which serves the API
+	// under /api/v3/
+	ghServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path != "/api/v3/repos/platform/service/contents/appsec-config.yml" {
+			w.WriteHeader(http.StatusNotFound)
+			_ = json.NewEncoder(w).Encode(map[string]string{"message": "Not Found"})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"type": "file", "name": "appsec-config.yml"})
+	}))
+	defer ghServer.Close()
+
+	natsServer := runMockJetStreamServer(t)
+	defer natsServer.Shutdown()
+
+	nc, err := nats.Connect(natsServer.ClientURL())
+	if err != nil {
+		t.Fatalf("Failed to connect to NATS: %v", err)
+	}
+	defer nc.Close()
+
+	cfg := &config.Config{
+		GitHubToken:         "test-token",
+		GitHubAPIURL:        ghServer.URL,
+		ValidReposSubject:   "repos.valid",
+		InvalidReposSubject: "repos.invalid",
+		DeadLetterSubject:   "repos.deadletter",
+		CheckMaxAttempts:    1,
+	}
+
+	checker, err := NewChecker(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create checker: %v", err)
+	}
+
+	messages := make(chan *nats.Msg, 10)
+	if _, err := nc.ChanSubscribe("repos.>", messages); err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+
+	data, _ := json.Marshal(collector.Repository{
+		Name:     "service",
+		CloneURL: "https://ghes.example.com/platform/service.git",
+	})
+	processor := NewProcessor(cfg, checker, nc)
+	if err := processor.ProcessMessage(context.Background(), &nats.Msg{Subject: "github.repositories", Data: data}); err != nil {
+		t.Fatalf("ProcessMessage() unexpected error: %v", err)
+	}
+
+	select {
+	case routed := <-messages:
+		if routed.Subject != "repos.valid" {
+			t.Errorf("Routed to %s, want repos.valid", routed.Subject)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timeout waiting for routed message")
+	}
+}
+
+func TestProcessMessageUsesOwner(t *testing.T) {
+	ghServer := newMockGitHubServer(t)
+	defer ghServer.Close()
+
+	natsServer := runMockJetStreamServer(t)
+	defer natsServer.Shutdown()
+
+	nc, err := nats.Connect(natsServer.ClientURL())
+	if err != nil {
+		t.Fatalf("Failed to connect to NATS: %v", err)
+	}
+	defer nc.Close()
+
+	cfg := &config.Config{
+		GitHubToken:         "test-token",
+		ValidReposSubject:   "repos.valid",
+		InvalidReposSubject: "repos.invalid",
+		DeadLetterSubject:   "repos.deadletter",
+		CheckMaxAttempts:    1,
+	}
+
+	checker, err := NewChecker(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create checker: %v", err)
+	}
+	checker.ghClient.BaseURL = mustParseURL(ghServer.URL + "/")
+
+	messages := make(chan *nats.Msg, 10)
+	if _, err := nc.ChanSubscribe("repos.>", messages); err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+
+	// The owner and name are taken from the message, not the clone URL
+	data, _ := json.Marshal(collector.Repository{
+		Name:     "with-config",
+		Owner:    "team",
+		CloneURL: "https://mirror.example.com/unparseable",
+	})
+	processor := NewProcessor(cfg, checker, nc)
+	if err := processor.ProcessMessage(context.Background(), &nats.Msg{Subject: "github.repositories", Data: data}); err != nil {
+		t.Fatalf("ProcessMessage() unexpected error: %v", err)
+	}
+
+	select {
+	case routed := <-messages:
+		if routed.Subject != "repos.valid" {
+			t.Errorf("Routed to %s, want repos.valid", routed.Subject)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timeout waiting for routed message")
+	}
+}
+
+func TestProcessMessageTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(previous)
+	if _, err := tracing.Setup(context.Background(), "test", "1.0.0", "", 1); err != nil {
+		t.Fatalf("Setup() unexpected error: %v", err)
+	}
+
+	ghServer := newMockGitHubServer(t)
+	defer ghServer.Close()
+
+	natsServer := runMockJetStreamServer(t)
+	defer natsServer.Shutdown()
+
+	nc, err := nats.Connect(natsServer.ClientURL())
+	if err != nil {
+		t.Fatalf("Failed to connect to NATS: %v", err)
+	}
+	defer nc.Close()
+
+	cfg := &config.Config{
+		GitHubToken:         "test-token",
+		ValidReposSubject:   "repos.valid",
+		InvalidReposSubject: "repos.invalid",
+		DeadLetterSubject:   "repos.deadletter",
+		CheckMaxAttempts:    1,
+	}
+	checker, err := NewChecker(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create checker: %v", err)
+	}
+	checker.ghClient.BaseURL = mustParseURL(ghServer.URL + "/")
+
+	messages := make(chan *nats.Msg, 10)
+	if _, err := nc.ChanSubscribe("repos.>", messages); err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+
+	// The collector's publish span is the parent of the processing span
+	_, publish := otel.Tracer("test").Start(context.Background(), "publish github.repositories")
+	data, _ := json.Marshal(collector.Repository{Name: "with-config", Owner: "team"})
+	msg := nats.NewMsg("github.repositories")
+	msg.Data = data
+	tracing.Inject(trace.ContextWithSpan(context.Background(), publish), msg)
+	publish.End()
+
+	processor := NewProcessor(cfg, checker, nc)
+	if err := processor.ProcessMessage(context.Background(), msg); err != nil {
+		t.Fatalf("ProcessMessage() unexpected error: %v", err)
+	}
+
+	traceID := publish.SpanContext().TraceID()
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	process, ok := spans["process github.repositories"]
+	if !ok {
+		t.Fatalf("no process span in %v", spans)
+	}
+	if process.Parent().SpanID() != publish.SpanContext().SpanID() || process.SpanContext().TraceID() != traceID {
+		t.Errorf("process span parent = %v, want the publish span", process.Parent())
+	}
+	check, ok := spans["validator.HasAppSecConfig"]
+	if !ok {
+		t.Fatalf("no check span in %v", spans)
+	}
+	if check.Parent().SpanID() != process.SpanContext().SpanID() {
+		t.Errorf("check span parent = %v, want the process span", check.Parent())
+	}
+
+	// The routed message continues the trace for the downstream scanners
+	select {
+	case routed := <-messages:
+		sc := trace.SpanContextFromContext(tracing.Extract(context.Background(), routed))
+		if sc.TraceID() != traceID || sc.SpanID() != process.SpanContext().SpanID() {
+			t.Errorf("routed trace context = %v, want the process span", sc)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timeout waiting for routed message")
+	}
+}
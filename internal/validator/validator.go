@@ -2,31 +2,42 @@ package validator
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/klimeurt/secflow-collector/internal/collector"
 	"github.com/klimeurt/secflow-collector/internal/config"
 	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
 )
 
 // Validator is the main validator service
 type Validator struct {
-	config    *config.Config
-	checker   *Checker
-	processor *Processor
-	nc        *nats.Conn
-	sub       *nats.Subscription
-	ctx       context.Context
-	cancel    context.CancelFunc
-	wg        sync.WaitGroup
+	config     *config.Config
+	checker    *Checker
+	processor  *Processor
+	nc         *nats.Conn
+	subs       []*nats.Subscription
+	consumeCtx jetstream.ConsumeContext
+	pool       *workerPool
+	ctx        context.Context
+	cancel     context.CancelFunc
+	// dropped is the highest count of messages the subscriptions dropped
+	dropped atomic.Int64
 }
 
 // New creates a new Validator instance
 func New(cfg *config.Config) (*Validator, error) {
+	if err := cfg.ValidateValidator(); err != nil {
+		return nil, err
+	}
+
 	// Connect to NATS
-	nc, err := nats.Connect(cfg.NATSUrl)
+	nc, err := nats.Connect(cfg.NATSUrl, nats.ErrorHandler(handleAsyncError))
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to NATS: %w", err)
 	}
@@ -49,119 +60,354 @@ func New(cfg *config.Config) (*Validator, error) {
 		checker:   checker,
 		processor: processor,
 		nc:        nc,
-		ctx:       ctx,
-		cancel:    cancel,
+		// The pool is created up front so its metrics can be registered
+		// before the validator starts
+		pool:   newWorkerPool(cfg.WorkerPoolSize, cfg.WorkerQueueSize),
+		ctx:    ctx,
+		cancel: cancel,
 	}, nil
 }
 
 // Start begins processing messages from the source queue
 func (v *Validator) Start() error {
-	log.Printf("Starting validator service...")
-	log.Printf("Subscribing to subject: %s", v.config.SourceSubject)
-	log.Printf("Valid repos will be sent to: %s", v.config.ValidReposSubject)
-	log.Printf("Invalid repos will be sent to: %s", v.config.InvalidReposSubject)
-
-	// Process any existing messages in the queue first
-	if err := v.ProcessExistingMessages(); err != nil {
-		return fmt.Errorf("failed to process existing messages: %w", err)
-	}
-
-	// Subscribe to the source subject
-	sub, err := v.nc.Subscribe(v.config.SourceSubject, func(msg *nats.Msg) {
-		v.wg.Add(1)
-		go func() {
-			defer v.wg.Done()
-			
-			// Process the message
-			if err := v.processor.ProcessMessage(v.ctx, msg); err != nil {
-				log.Printf("Error processing message: %v", err)
-			}
-		}()
+	slog.Info("Starting validator service", "subjects", v.config.SourceSubjects(),
+		"valid_subject", v.config.ValidReposSubject, "invalid_subject", v.config.InvalidReposSubject,
+		"workers", v.config.WorkerPoolSize, "queue_size", v.config.WorkerQueueSize)
+
+	// Consume through a durable JetStream consumer if enabled
+	if v.config.NATSJetStream {
+		if err := v.startConsumer(); err != nil {
+			return err
+		}
+		slog.Info("Validator service started successfully")
+		return nil
+	}
+
+	// Subscribe to the source subjects. The callback blocks while the pool
+	// is saturated, so messages back up in the subscription's pending
+	// buffer. Core NATS cannot slow down the publisher: once that buffer
+	// is full the messages that do not fit are dropped, so it keeps the
+	// client's large default limits.
+	for _, subject := range v.config.SourceSubjects() {
+		sub, err := v.nc.Subscribe(subject, v.handleMessage)
+		if err != nil {
+			return fmt.Errorf("failed to subscribe to %s: %w", subject, err)
+		}
+		v.subs = append(v.subs, sub)
+	}
+	slog.Info("Validator service started successfully")
+	return nil
+}
+
+// handleMessage hands a core NATS message to the worker pool, blocking while
+// the pool is saturated
+func (v *Validator) handleMessage(msg *nats.Msg) {
+	err := v.pool.Submit(v.ctx, func() {
+		if err := v.processor.ProcessMessage(v.ctx, msg); err != nil {
+			logProcessError(msg, err)
+		}
 	})
 	if err != nil {
-		return fmt.Errorf("failed to subscribe to %s: %w", v.config.SourceSubject, err)
+		slog.Warn("Dropping message, worker pool unavailable", "subject", msg.Subject, "error", err)
+	}
+}
+
+// startConsumer binds a durable pull consumer to the collector's stream and
+// starts consuming from it. Because the consumer is durable, a restart
+// resumes from the last acknowledged message.
+func (v *Validator) startConsumer() error {
+	js, err := jetstream.New(v.nc)
+	if err != nil {
+		return fmt.Errorf("failed to create JetStream context: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(v.ctx, 10*time.Second)
+	defer cancel()
+
+	// Create the stream if the collector has not done so yet. An existing
+	// stream is left alone, since the collector owns its subjects.
+	if _, err := js.Stream(ctx, v.config.NATSStream); err != nil {
+		if !errors.Is(err, jetstream.ErrStreamNotFound) {
+			return fmt.Errorf("failed to look up stream %s: %w", v.config.NATSStream, err)
+		}
+		subjects := v.config.SourceSubjects()
+		if _, err := collector.EnsureStream(ctx, js, v.config.NATSStream, subjects, v.config.NATSDuplicateWindow); err != nil {
+			return err
+		}
+	}
+
+	consumer, err := v.ensureConsumer(ctx, js)
+	if err != nil {
+		return err
+	}
+
+	// Pull one message at a time: the client only asks for the next one
+	// once the handler returned, so no message waits in its buffer without
+	// being kept in progress. The worker pool's queue provides the
+	// read-ahead.
+	cc, err := consumer.Consume(v.handleJetStreamMessage, jetstream.PullMaxMessages(1))
+	if err != nil {
+		return fmt.Errorf("failed to consume from %s: %w", v.config.ConsumerName, err)
 	}
 
-	v.sub = sub
-	log.Printf("Validator service started successfully")
+	v.consumeCtx = cc
+	slog.Info("Consuming from stream", "stream", v.config.NATSStream, "consumer", v.config.ConsumerName)
 	return nil
 }
 
-// ProcessExistingMessages processes any existing messages in the queue at startup
-func (v *Validator) ProcessExistingMessages() error {
+// ensureConsumer creates or updates the validator's durable consumer, which
+// filters on every source subject. The deliver policy can only be chosen
+// when the consumer is first created: with startup message processing
+// disabled, a new consumer skips the backlog.
+func (v *Validator) ensureConsumer(ctx context.Context, js jetstream.JetStream) (jetstream.Consumer, error) {
+	cfg := jetstream.ConsumerConfig{
+		Durable:       v.config.ConsumerName,
+		AckPolicy:     jetstream.AckExplicitPolicy,
+		AckWait:       v.config.ConsumerAckWait,
+		MaxDeliver:    v.config.ConsumerMaxDeliver,
+		DeliverPolicy: jetstream.DeliverAllPolicy,
+	}
 	if !v.config.ProcessStartupMessages {
-		log.Printf("Startup message processing disabled, skipping...")
-		return nil
+		cfg.DeliverPolicy = jetstream.DeliverNewPolicy
+	}
+	if subjects := v.config.SourceSubjects(); len(subjects) == 1 {
+		cfg.FilterSubject = subjects[0]
+	} else {
+		cfg.FilterSubjects = subjects
 	}
 
-	log.Printf("Processing existing messages from queue: %s", v.config.SourceSubject)
-	
-	// Create a synchronous subscription for startup processing
-	sub, err := v.nc.SubscribeSync(v.config.SourceSubject)
+	existing, err := js.Consumer(ctx, v.config.NATSStream, v.config.ConsumerName)
+	switch {
+	case err == nil:
+		cfg.DeliverPolicy = existing.CachedInfo().Config.DeliverPolicy
+	case !errors.Is(err, jetstream.ErrConsumerNotFound):
+		return nil, fmt.Errorf("failed to look up consumer %s: %w", v.config.ConsumerName, err)
+	}
+
+	consumer, err := js.CreateOrUpdateConsumer(ctx, v.config.NATSStream, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create consumer %s: %w", v.config.ConsumerName, err)
+	}
+	return consumer, nil
+}
+
+// handleJetStreamMessage hands a JetStream message to the worker pool,
+// blocking while the pool is saturated. The message is kept in progress
+// until it is acknowledged.
+func (v *Validator) handleJetStreamMessage(jsMsg jetstream.Msg) {
+	done := v.keepInProgress(jsMsg)
+	err := v.pool.Submit(v.ctx, func() {
+		v.processJetStreamMessage(jsMsg, done)
+	})
 	if err != nil {
-		return fmt.Errorf("failed to create sync subscription for startup processing: %w", err)
+		done()
+		slog.Warn("Returning message, worker pool unavailable", "subject", jsMsg.Subject(), "error", err)
+		v.nak(jsMsg)
 	}
-	defer func() {
-		if err := sub.Unsubscribe(); err != nil {
-			log.Printf("Warning: failed to unsubscribe during startup processing: %v", err)
+}
+
+// nak negatively acknowledges a message, asking JetStream to redeliver it
+// after a backoff that grows with its delivery count. Redelivering it right
+// away would use up the consumer's max deliver count within moments of an
+// outage.
+func (v *Validator) nak(jsMsg jetstream.Msg) {
+	var delivered uint64 = 1
+	if meta, err := jsMsg.Metadata(); err == nil {
+		delivered = meta.NumDelivered
+	}
+	if err := jsMsg.NakWithDelay(v.redeliveryDelay(delivered)); err != nil {
+		slog.Warn("Failed to nak message", "subject", jsMsg.Subject(), "error", err)
+	}
+}
+
+// redeliveryDelay returns the backoff before the next delivery of a message
+// delivered the given number of times: CheckRetryBackoff after the first
+// delivery, doubled after each further one up to CheckRetryMaxBackoff
+func (v *Validator) redeliveryDelay(delivered uint64) time.Duration {
+	maxDelay := v.config.CheckRetryMaxBackoff
+	if maxDelay <= 0 {
+		maxDelay = time.Hour
+	}
+	delay := v.config.CheckRetryBackoff
+	for i := uint64(1); i < delivered && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxDelay)
+}
+
+// keepInProgress tells JetStream every third of the ack wait that the message
+// is still being worked on, until the returned function is called. Without
+// it, a message waiting in the pool queue or for a check retry or a rate
+// limit longer than the ack wait would be redelivered while it is processed.
+func (v *Validator) keepInProgress(jsMsg jetstream.Msg) func() {
+	interval := v.config.ConsumerAckWait / 3
+	if interval <= 0 {
+		// The server's default ack wait is 30s
+		interval = 10 * time.Second
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := jsMsg.InProgress(); err != nil {
+					slog.Warn("Failed to mark message in progress", "subject", jsMsg.Subject(), "error", err)
+				}
+			case <-stop:
+				return
+			}
 		}
 	}()
 
-	processedCount := 0
-	timeout := 1 * time.Second // Short timeout to detect empty queue
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(stop)
+			<-done
+		})
+	}
+}
 
-	for {
-		// Try to get next message with timeout
-		msg, err := sub.NextMsg(timeout)
-		if err != nil {
-			if err == nats.ErrTimeout {
-				// No more messages available, queue is empty
-				log.Printf("No more existing messages found. Processed %d messages during startup.", processedCount)
-				break
+// processJetStreamMessage processes a JetStream message, calls done to stop
+// keeping it in progress and acknowledges it. Failed messages are negatively
+// acknowledged so JetStream redelivers them until the consumer's max deliver
+// count is reached.
+func (v *Validator) processJetStreamMessage(jsMsg jetstream.Msg, done func()) {
+	msg := &nats.Msg{
+		Subject: jsMsg.Subject(),
+		Header:  jsMsg.Headers(),
+		Data:    jsMsg.Data(),
+	}
+
+	err := v.processor.ProcessMessage(v.ctx, msg)
+	done()
+	if err != nil {
+		logProcessError(msg, err)
+		v.nak(jsMsg)
+		return
+	}
+
+	if err := jsMsg.Ack(); err != nil {
+		slog.Warn("Failed to ack message", "subject", msg.Subject, "error", err)
+	}
+}
+
+// Stop gracefully shuts down the validator service. It stops receiving
+// messages, waits for the messages already received to be processed and
+// drains the NATS connection, until ctx is done. Messages still being
+// processed then are interrupted: JetStream redelivers them, while those of
+// a core NATS subscription are lost. It returns an error if work was
+// abandoned.
+func (v *Validator) Stop(ctx context.Context) error {
+	slog.Info("Stopping validator service")
+
+	var errs []error
+	if err := v.stopReceiving(ctx); err != nil {
+		errs = append(errs, err)
+	}
+
+	// Wait for queued and running messages to finish
+	stopped := make(chan struct{})
+	go func() {
+		v.pool.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		errs = append(errs, fmt.Errorf("interrupted %d messages in flight: %w", v.pool.InFlight(), ctx.Err()))
+		v.cancel()
+		<-stopped
+	}
+	v.cancel()
+
+	// Flush the routed messages and acknowledgements
+	if err := collector.DrainConn(ctx, v.nc); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+	slog.Info("Validator service stopped")
+	return nil
+}
+
+// stopReceiving drains the JetStream consumer or the subscriptions, handing
+// the messages already delivered to the worker pool, and waits until no
+// more messages are received
+func (v *Validator) stopReceiving(ctx context.Context) error {
+	switch {
+	case v.consumeCtx != nil:
+		v.consumeCtx.Drain()
+		select {
+		case <-v.consumeCtx.Closed():
+		case <-ctx.Done():
+			return fmt.Errorf("consumer %s did not drain in time: %w", v.config.ConsumerName, ctx.Err())
+		}
+	case len(v.subs) > 0:
+		closed := make([]<-chan nats.SubStatus, len(v.subs))
+		for i, sub := range v.subs {
+			closed[i] = sub.StatusChanged(nats.SubscriptionClosed)
+			if err := sub.Drain(); err != nil {
+				return fmt.Errorf("failed to drain subscription to %s: %w", sub.Subject, err)
 			}
-			// Other error occurred
-			return fmt.Errorf("error receiving message during startup processing: %w", err)
 		}
-
-		// Process the message using existing processor logic
-		if err := v.processor.ProcessMessage(v.ctx, msg); err != nil {
-			log.Printf("Error processing startup message: %v", err)
-			// Continue processing other messages even if one fails
-		} else {
-			processedCount++
+		for i, sub := range v.subs {
+			select {
+			case <-closed[i]:
+			case <-ctx.Done():
+				return fmt.Errorf("subscription to %s did not drain in time: %w", sub.Subject, ctx.Err())
+			}
 		}
 	}
-
-	log.Printf("Startup message processing completed. Processed %d messages.", processedCount)
 	return nil
 }
 
-// Stop gracefully shuts down the validator service
-func (v *Validator) Stop() {
-	log.Printf("Stopping validator service...")
-	
-	// Cancel the context to signal shutdown
-	v.cancel()
-	
-	// Unsubscribe from NATS
-	if v.sub != nil {
-		if err := v.sub.Unsubscribe(); err != nil {
-			log.Printf("Warning: failed to unsubscribe: %v", err)
+// handleAsyncError logs the asynchronous errors of the NATS connection, such
+// as a subscription falling behind and dropping messages as a slow consumer
+func handleAsyncError(_ *nats.Conn, sub *nats.Subscription, err error) {
+	if sub == nil {
+		slog.Error("NATS connection error", "error", err)
+		return
+	}
+	if errors.Is(err, nats.ErrSlowConsumer) {
+		dropped, _ := sub.Dropped()
+		slog.Error("Slow consumer, dropping messages", "subject", sub.Subject, "dropped", dropped, "error", err)
+		return
+	}
+	slog.Error("NATS subscription error", "subject", sub.Subject, "error", err)
+}
+
+// droppedMessages returns the number of messages the core NATS subscriptions
+// dropped as slow consumers. The count is kept once the subscriptions are
+// closed.
+func (v *Validator) droppedMessages() int64 {
+	var total int64
+	for _, sub := range v.subs {
+		if n, err := sub.Dropped(); err == nil {
+			total += int64(n)
 		}
 	}
-	
-	// Wait for all goroutines to finish
-	v.wg.Wait()
-	
-	// Close NATS connection
-	if v.nc != nil {
-		v.nc.Close()
+	if total > v.dropped.Load() {
+		v.dropped.Store(total)
 	}
-	
-	log.Printf("Validator service stopped")
+	return v.dropped.Load()
+}
+
+// logProcessError logs a message that failed to process, with its subject
+// and the run ID of the scan that published it
+func logProcessError(msg *nats.Msg, err error) {
+	slog.Error("Error processing message", "subject", msg.Subject,
+		"run_id", msg.Header.Get(collector.HeaderRunID), "outcome", outcomeError, "error", err)
 }
 
 // Wait blocks until the service is stopped
 func (v *Validator) Wait() {
 	<-v.ctx.Done()
-}
\ No newline at end of file
+}
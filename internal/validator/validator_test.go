@@ -0,0 +1,559 @@
+package validator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/klimeurt/secflow-collector/internal/collector"
+	"github.com/klimeurt/secflow-collector/internal/config"
+	natsserver "github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+func TestValidatorDurableConsumer(t *testing.T) {
+	ghServer := newMockGitHubServer(t)
+	defer ghServer.Close()
+
+	server := runMockJetStreamServer(t)
+	defer server.Shutdown()
+
+	cfg := &config.Config{
+		GitHubToken:            "test-token",
+		NATSUrl:                server.ClientURL(),
+		NATSJetStream:          true,
+		NATSStream:             "GITHUB_REPOSITORIES",
+		NATSDuplicateWindow:    time.Hour,
+		SourceSubject:          "github.repositories",
+		ValidReposSubject:      "repos.valid",
+		InvalidReposSubject:    "repos.invalid",
+		ProcessStartupMessages: true,
+		ConsumerName:           "secflow-validator",
+		ConsumerMaxDeliver:     5,
+		ConsumerAckWait:        30 * time.Second,
+		WorkerPoolSize:         2,
+		WorkerQueueSize:        10,
+		GitHubOrgs: []config.OrgConfig{
+			{Name: "org"},
+			{Name: "org-two", Subject: "org-two.repositories"},
+		},
+	}
+
+	nc, err := nats.Connect(server.ClientURL())
+	if err != nil {
+		t.Fatalf("Failed to connect to NATS: %v", err)
+	}
+	defer nc.Close()
+
+	js, err := jetstream.New(nc)
+	if err != nil {
+		t.Fatalf("Failed to create JetStream context: %v", err)
+	}
+
+	ctx := context.Background()
+	if _, err := collector.EnsureStream(ctx, js, cfg.NATSStream, cfg.SourceSubjects(), cfg.NATSDuplicateWindow); err != nil {
+		t.Fatalf("Failed to create stream: %v", err)
+	}
+
+	valid := make(chan *nats.Msg, 10)
+	invalid := make(chan *nats.Msg, 10)
+	if _, err := nc.ChanSubscribe(cfg.ValidReposSubject, valid); err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+	if _, err := nc.ChanSubscribe(cfg.InvalidReposSubject, invalid); err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+
+	// Messages published while the validator is offline
+	publishRepo(t, js, cfg.SourceSubject, "with-config")
+	publishRepo(t, js, cfg.SourceSubject, "without-config")
+
+	v := startValidator(t, cfg, ghServer.URL)
+
+	expectRepo(t, valid, "with-config")
+	expectRepo(t, invalid, "without-config")
+
+	consumer, err := js.Consumer(ctx, cfg.NATSStream, cfg.ConsumerName)
+	if err != nil {
+		t.Fatalf("Failed to look up consumer: %v", err)
+	}
+	info := consumer.CachedInfo()
+	if info.Config.AckPolicy != jetstream.AckExplicitPolicy {
+		t.Errorf("AckPolicy = %v, want %v", info.Config.AckPolicy, jetstream.AckExplicitPolicy)
+	}
+	if info.Config.MaxDeliver != cfg.ConsumerMaxDeliver {
+		t.Errorf("MaxDeliver = %d, want %d", info.Config.MaxDeliver, cfg.ConsumerMaxDeliver)
+	}
+	if info.Config.AckWait != cfg.ConsumerAckWait {
+		t.Errorf("AckWait = %v, want %v", info.Config.AckWait, cfg.ConsumerAckWait)
+	}
+	if len(info.Config.FilterSubjects) != 2 {
+		t.Errorf("FilterSubjects = %v, want %v", info.Config.FilterSubjects, cfg.SourceSubjects())
+	}
+
+	// Repositories published on an organization's subject are validated too
+	publishRepo(t, js, "org-two.repositories", "on-org-subject")
+	expectRepo(t, invalid, "on-org-subject")
+
+	// The validator is ready while connected and consuming
+	checks := v.ReadinessChecks()
+	for _, c := range checks[:2] {
+		if err := c.Check(ctx); err != nil {
+			t.Errorf("%s check unexpected error: %v", c.Name, err)
+		}
+	}
+
+	if err := v.Stop(ctx); err != nil {
+		t.Errorf("Stop() unexpected error: %v", err)
+	}
+	if err := checks[0].Check(ctx); err == nil {
+		t.Error("NATS check expected error after Stop(), got nil")
+	}
+
+	// A restarted validator resumes where the previous one left off
+	publishRepo(t, js, cfg.SourceSubject, "added-while-down")
+
+	v = startValidator(t, cfg, ghServer.URL)
+	defer func() { _ = v.Stop(ctx) }()
+
+	expectRepo(t, invalid, "added-while-down")
+
+	select {
+	case msg := <-valid:
+		t.Errorf("Unexpected redelivery to %s: %s", cfg.ValidReposSubject, msg.Data)
+	case msg := <-invalid:
+		t.Errorf("Unexpected redelivery to %s: %s", cfg.InvalidReposSubject, msg.Data)
+	case <-time.After(500 * time.Millisecond):
+	}
+}
+
+func TestValidatorInProgress(t *testing.T) {
+	// A check that takes longer than the ack wait
+	var requests atomic.Int32
+	ghServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		select {
+		case <-time.After(600 * time.Millisecond):
+		case <-r.Context().Done():
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer ghServer.Close()
+
+	server := runMockJetStreamServer(t)
+	defer server.Shutdown()
+
+	cfg := &config.Config{
+		GitHubToken:            "test-token",
+		NATSUrl:                server.ClientURL(),
+		NATSJetStream:          true,
+		NATSStream:             "GITHUB_REPOSITORIES",
+		NATSDuplicateWindow:    time.Hour,
+		SourceSubject:          "github.repositories",
+		ValidReposSubject:      "repos.valid",
+		InvalidReposSubject:    "repos.invalid",
+		ProcessStartupMessages: true,
+		ConsumerName:           "secflow-validator",
+		ConsumerMaxDeliver:     5,
+		ConsumerAckWait:        500 * time.Millisecond,
+		WorkerPoolSize:         1,
+		WorkerQueueSize:        4,
+	}
+
+	nc, err := nats.Connect(server.ClientURL())
+	if err != nil {
+		t.Fatalf("Failed to connect to NATS: %v", err)
+	}
+	defer nc.Close()
+	js, err := jetstream.New(nc)
+	if err != nil {
+		t.Fatalf("Failed to create JetStream context: %v", err)
+	}
+	ctx := context.Background()
+	if _, err := collector.EnsureStream(ctx, js, cfg.NATSStream, []string{cfg.SourceSubject}, cfg.NATSDuplicateWindow); err != nil {
+		t.Fatalf("Failed to create stream: %v", err)
+	}
+	invalid := make(chan *nats.Msg, 10)
+	if _, err := nc.ChanSubscribe(cfg.InvalidReposSubject, invalid); err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+
+	v := startValidator(t, cfg, ghServer.URL)
+	defer func() { _ = v.Stop(ctx) }()
+
+	// More messages than the worker and its queue hold, so some wait to be
+	// handed to the pool for several times the ack wait
+	const count = 8
+	for i := 1; i <= count; i++ {
+		publishRepo(t, js, cfg.SourceSubject, fmt.Sprintf("slow-%d", i))
+	}
+	for i := 1; i <= count; i++ {
+		expectRepo(t, invalid, fmt.Sprintf("slow-%d", i))
+	}
+
+	// Every message was kept in progress, so none was redelivered and
+	// checked again
+	select {
+	case msg := <-invalid:
+		t.Errorf("Unexpected redelivery: %s", msg.Data)
+	case <-time.After(time.Second):
+	}
+	if n := requests.Load(); n != count {
+		t.Errorf("GitHub requests = %d, want %d", n, count)
+	}
+}
+
+func TestValidatorStopDrains(t *testing.T) {
+	// A GitHub API stand-in answering once release is closed, and never
+	// for the abandoned repository
+	requested := make(chan struct{}, 10)
+	release := make(chan struct{})
+	ghServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested <- struct{}{}
+		if strings.Contains(r.URL.Path, "/abandoned/") {
+			<-r.Context().Done()
+			return
+		}
+		select {
+		case <-release:
+		case <-r.Context().Done():
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer ghServer.Close()
+
+	server := runMockJetStreamServer(t)
+	defer server.Shutdown()
+
+	cfg := &config.Config{
+		GitHubToken:         "test-token",
+		NATSUrl:             server.ClientURL(),
+		SourceSubject:       "github.repositories",
+		ValidReposSubject:   "repos.valid",
+		InvalidReposSubject: "repos.invalid",
+		WorkerPoolSize:      1,
+		WorkerQueueSize:     10,
+	}
+
+	nc, err := nats.Connect(server.ClientURL())
+	if err != nil {
+		t.Fatalf("Failed to connect to NATS: %v", err)
+	}
+	defer nc.Close()
+	invalid := make(chan *nats.Msg, 10)
+	if _, err := nc.ChanSubscribe(cfg.InvalidReposSubject, invalid); err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+	publish := func(v *Validator, name string) {
+		t.Helper()
+		// Make sure the server registered the validator's subscription
+		if err := v.nc.Flush(); err != nil {
+			t.Fatalf("Failed to flush: %v", err)
+		}
+		data, _ := json.Marshal(collector.Repository{Name: name, Owner: "org"})
+		if err := nc.Publish(cfg.SourceSubject, data); err != nil {
+			t.Fatalf("Failed to publish: %v", err)
+		}
+	}
+
+	// Messages in flight when the validator stops are still routed
+	v := startValidator(t, cfg, ghServer.URL)
+	publish(v, "in-flight")
+	<-requested
+
+	stopped := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		stopped <- v.Stop(ctx)
+	}()
+	select {
+	case err := <-stopped:
+		t.Fatalf("Stop() returned before the message was processed: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(release)
+	expectRepo(t, invalid, "in-flight")
+	if err := <-stopped; err != nil {
+		t.Errorf("Stop() unexpected error: %v", err)
+	}
+
+	// Messages still in flight after the grace period are abandoned
+	v = startValidator(t, cfg, ghServer.URL)
+	publish(v, "abandoned")
+	<-requested
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := v.Stop(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Stop() error = %v, want a deadline exceeded error", err)
+	}
+}
+
+func TestValidatorSlowConsumer(t *testing.T) {
+	// A GitHub API stand-in that never answers, so every worker stays busy
+	ghServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer ghServer.Close()
+
+	server := runMockJetStreamServer(t)
+	defer server.Shutdown()
+
+	cfg := &config.Config{
+		GitHubToken:         "test-token",
+		NATSUrl:             server.ClientURL(),
+		SourceSubject:       "github.repositories",
+		ValidReposSubject:   "repos.valid",
+		InvalidReposSubject: "repos.invalid",
+		WorkerPoolSize:      1,
+		WorkerQueueSize:     1,
+	}
+
+	v := startValidator(t, cfg, ghServer.URL)
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		_ = v.Stop(ctx)
+	}()
+
+	// The subscription buffers far more than the worker queue
+	msgs, _, err := v.subs[0].PendingLimits()
+	if err != nil {
+		t.Fatalf("Failed to get pending limits: %v", err)
+	}
+	if msgs != nats.DefaultSubPendingMsgsLimit {
+		t.Errorf("Pending message limit = %d, want %d", msgs, nats.DefaultSubPendingMsgsLimit)
+	}
+
+	// Messages that overflow a full pending buffer are counted as dropped
+	if err := v.subs[0].SetPendingLimits(2, -1); err != nil {
+		t.Fatalf("Failed to set pending limits: %v", err)
+	}
+	if err := v.nc.Flush(); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+	nc, err := nats.Connect(server.ClientURL())
+	if err != nil {
+		t.Fatalf("Failed to connect to NATS: %v", err)
+	}
+	defer nc.Close()
+	data, _ := json.Marshal(collector.Repository{Name: "repo", Owner: "org"})
+	for i := 0; i < 10; i++ {
+		if err := nc.Publish(cfg.SourceSubject, data); err != nil {
+			t.Fatalf("Failed to publish: %v", err)
+		}
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for v.droppedMessages() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Timeout waiting for dropped messages")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Test helper functions
+
+func TestValidatorOrgSubjects(t *testing.T) {
+	ghServer := newMockGitHubServer(t)
+	defer ghServer.Close()
+
+	server := runMockJetStreamServer(t)
+	defer server.Shutdown()
+
+	cfg := &config.Config{
+		GitHubToken:         "test-token",
+		NATSUrl:             server.ClientURL(),
+		SourceSubject:       "github.repositories",
+		ValidReposSubject:   "repos.valid",
+		InvalidReposSubject: "repos.invalid",
+		WorkerPoolSize:      1,
+		WorkerQueueSize:     10,
+		GitHubOrgs: []config.OrgConfig{
+			{Name: "org"},
+			{Name: "org-two", Subject: "org-two.repositories"},
+		},
+	}
+
+	nc, err := nats.Connect(server.ClientURL())
+	if err != nil {
+		t.Fatalf("Failed to connect to NATS: %v", err)
+	}
+	defer nc.Close()
+	valid := make(chan *nats.Msg, 10)
+	if _, err := nc.ChanSubscribe(cfg.ValidReposSubject, valid); err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+
+	v := startValidator(t, cfg, ghServer.URL)
+	defer func() { _ = v.Stop(context.Background()) }()
+	if err := v.nc.Flush(); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+
+	for _, subject := range []string{cfg.SourceSubject, "org-two.repositories"} {
+		data, _ := json.Marshal(collector.Repository{Name: "with-config", Owner: "org"})
+		if err := nc.Publish(subject, data); err != nil {
+			t.Fatalf("Failed to publish: %v", err)
+		}
+		expectRepo(t, valid, "with-config")
+	}
+}
+
+func TestRedeliveryDelay(t *testing.T) {
+	v := &Validator{config: &config.Config{CheckRetryBackoff: time.Second, CheckRetryMaxBackoff: 30 * time.Second}}
+
+	tests := []struct {
+		delivered uint64
+		want      time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{4, 8 * time.Second},
+		{6, 30 * time.Second},
+		{100, 30 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := v.redeliveryDelay(tt.delivered); got != tt.want {
+			t.Errorf("redeliveryDelay(%d) = %v, want %v", tt.delivered, got, tt.want)
+		}
+	}
+
+	// A failed message is returned with the delay of its delivery count
+	msg := &nakRecorder{delivered: 3}
+	v.nak(msg)
+	if msg.delay != 4*time.Second {
+		t.Errorf("NakWithDelay() delay = %v, want %v", msg.delay, 4*time.Second)
+	}
+}
+
+// nakRecorder is a JetStream message that records the delay it was
+// negatively acknowledged with
+type nakRecorder struct {
+	jetstream.Msg
+	delivered uint64
+	delay     time.Duration
+}
+
+func (m *nakRecorder) Subject() string { return "github.repositories" }
+
+func (m *nakRecorder) Metadata() (*jetstream.MsgMetadata, error) {
+	return &jetstream.MsgMetadata{NumDelivered: m.delivered}, nil
+}
+
+func (m *nakRecorder) NakWithDelay(delay time.Duration) error {
+	m.delay = delay
+	return nil
+}
+
+func startValidator(t *testing.T, cfg *config.Config, githubURL string) *Validator {
+	t.Helper()
+
+	v, err := New(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create validator: %v", err)
+	}
+	v.checker.ghClient.BaseURL = mustParseURL(githubURL + "/")
+
+	if err := v.Start(); err != nil {
+		t.Fatalf("Failed to start validator: %v", err)
+	}
+	return v
+}
+
+func publishRepo(t *testing.T, js jetstream.JetStream, subject, name string) {
+	t.Helper()
+
+	data, err := json.Marshal(collector.Repository{
+		Name:     name,
+		CloneURL: "https://github.com/org/" + name + ".git",
+	})
+	if err != nil {
+		t.Fatalf("Failed to marshal repository: %v", err)
+	}
+	if _, err := js.Publish(context.Background(), subject, data); err != nil {
+		t.Fatalf("Failed to publish repository: %v", err)
+	}
+}
+
+func expectRepo(t *testing.T, messages chan *nats.Msg, name string) {
+	t.Helper()
+
+	select {
+	case msg := <-messages:
+		var repo collector.Repository
+		if err := json.Unmarshal(msg.Data, &repo); err != nil {
+			t.Fatalf("Failed to unmarshal message: %v", err)
+		}
+		if repo.Name != name {
+			t.Errorf("Repository name = %v, want %v", repo.Name, name)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timeout waiting for repository %s", name)
+	}
+}
+
+// newMockGitHubServer serves appsec-config.yml for repositories whose name
+// starts with "with-config" and 404 for every other repository
+func newMockGitHubServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if strings.Contains(r.URL.Path, "/with-config/contents/") {
+			_ = json.NewEncoder(w).Encode(map[string]string{
+				"type": "file",
+				"name": "appsec-config.yml",
+				"path": "appsec-config.yml",
+			})
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(w).Encode(map[string]string{"message": "Not Found"})
+	}))
+}
+
+func runMockJetStreamServer(t *testing.T) *natsserver.Server {
+	t.Helper()
+
+	opts := &natsserver.Options{
+		Host:      "127.0.0.1",
+		Port:      -1, // Use random port
+		JetStream: true,
+		StoreDir:  t.TempDir(),
+	}
+
+	server, err := natsserver.NewServer(opts)
+	if err != nil {
+		t.Fatalf("Failed to create NATS server: %v", err)
+	}
+
+	go server.Start()
+
+	if !server.ReadyForConnections(5 * time.Second) {
+		t.Fatal("NATS server not ready")
+	}
+
+	return server
+}
+
+func mustParseURL(rawURL string) *url.URL {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		panic("Failed to parse URL " + rawURL + ": " + err.Error())
+	}
+	return u
+}